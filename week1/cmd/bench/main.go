@@ -0,0 +1,289 @@
+// Command bench compares DBConnectionPool, SemaphorePool, ShardedPool and
+// SessionPool with database/sql's built-in connection pool. For each
+// concurrency level it runs the same statement through each for a fixed time
+// and reports throughput and acquire latency. DBConnectionPool against
+// SemaphorePool contrasts a mutex-and-waiter-queue design with a semaphore
+// over a free list; high -concurrency with a nonzero -hold shows them under
+// contention. ShardedPool splits the free list over -shards locks, which
+// shows at high -concurrency with -hold 0, where the single lock is the
+// bottleneck rather than the connections.
+//
+// All sides are capped at the same number of database connections: the
+// DBConnectionPool, SemaphorePool and ShardedPool hold -conns handles limited
+// to one connection each, the SessionPool -conns dedicated sessions, and the native
+// side is a single *sql.DB with SetMaxOpenConns(-conns). With more workers
+// than connections, the acquire percentiles show the cost of queueing; with
+// fewer, they show the pool's bookkeeping overhead per checkout.
+//
+//	go run ./cmd/bench -driver sqlite -concurrency 1,8,32,128 -hold 1ms
+//	go run ./cmd/bench -conns 64 -shards 16 -concurrency 64,256,1024 -query ""
+//
+// An empty -query skips the statement, leaving only the acquire and release,
+// to measure the pools' own overhead.
+//
+// The pool package's benchmarks make the same comparison under go test:
+//
+//	go test -run '^$' -bench . ./pool
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/system-design/week1/pool"
+	_ "modernc.org/sqlite"
+)
+
+// result is what one benchmark run measured
+type result struct {
+	ops      int
+	errors   int
+	duration time.Duration
+	acquire  []time.Duration // Time each operation waited for a connection
+}
+
+// acquirer hands out a connection for one operation and returns a function
+// to give it back
+type acquirer func(ctx context.Context) (execer, func(), error)
+
+// execer is what both sides of the benchmark hand out
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func main() {
+	driver := flag.String("driver", "sqlite", "database driver: mysql, postgres or sqlite")
+	dsn := flag.String("dsn", "", "data source name (default: a throwaway sqlite file)")
+	conns := flag.Int("conns", 10, "database connections available to each side")
+	levels := flag.String("concurrency", "1,4,16,64", "comma-separated worker counts to run")
+	duration := flag.Duration("duration", 2*time.Second, "how long to run each case")
+	hold := flag.Duration("hold", 0, "extra time each operation holds its connection, to simulate work")
+	query := flag.String("query", "SELECT 1", "statement each operation executes, or empty to run none")
+	shards := flag.Int("shards", 0, "ShardedPool shard count (default GOMAXPROCS)")
+	flag.Parse()
+
+	if *dsn == "" {
+		if *driver != "sqlite" {
+			fatal("-dsn is required for driver %s", *driver)
+		}
+		dir, err := os.MkdirTemp("", "poolbench")
+		if err != nil {
+			fatal("%v", err)
+		}
+		defer os.RemoveAll(dir)
+		*dsn = "file:" + filepath.Join(dir, "bench.db")
+	}
+	workers, err := parseLevels(*levels)
+	if err != nil {
+		fatal("bad -concurrency: %v", err)
+	}
+
+	handleCfg := pool.PoolConfig{
+		DriverName: *driver,
+		Hooks: pool.Hooks[*sql.DB]{
+			// One server connection per pooled handle, matching the native cap
+			OnCreate: func(ctx context.Context, db *sql.DB) error {
+				db.SetMaxOpenConns(1)
+				return nil
+			},
+		},
+		Settings: pool.Settings{
+			MinConns: *conns,
+			MaxConns: *conns,
+			Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		},
+	}
+	dbPool, err := pool.NewDBConnectionPoolWithConfig(*dsn, handleCfg)
+	if err != nil {
+		fatal("failed to create pool: %v", err)
+	}
+	defer dbPool.Close()
+
+	semPool, err := pool.NewSemaphorePool(*dsn, handleCfg)
+	if err != nil {
+		fatal("failed to create semaphore pool: %v", err)
+	}
+	defer semPool.Close()
+
+	shardPool, err := pool.NewShardedPool(*dsn, handleCfg, *shards)
+	if err != nil {
+		fatal("failed to create sharded pool: %v", err)
+	}
+	defer shardPool.Close()
+
+	sessions, err := pool.NewSessionPool(*dsn, pool.PoolConfig{
+		DriverName: *driver,
+		Settings: pool.Settings{
+			MinConns: *conns,
+			MaxConns: *conns,
+			Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		},
+	})
+	if err != nil {
+		fatal("failed to create session pool: %v", err)
+	}
+	defer sessions.Close()
+
+	native, err := sql.Open(*driver, *dsn)
+	if err != nil {
+		fatal("failed to open database: %v", err)
+	}
+	defer native.Close()
+	native.SetMaxOpenConns(*conns)
+	native.SetMaxIdleConns(*conns)
+	if err := native.Ping(); err != nil {
+		fatal("failed to reach database: %v", err)
+	}
+
+	sides := []struct {
+		name    string
+		acquire acquirer
+	}{
+		{"DBConnectionPool", func(ctx context.Context) (execer, func(), error) {
+			db, err := dbPool.GetConnectionContext(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			return db, func() { dbPool.PutConnection(db) }, nil
+		}},
+		{"SemaphorePool", func(ctx context.Context) (execer, func(), error) {
+			db, err := semPool.GetConnectionContext(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			return db, func() { semPool.PutConnection(db) }, nil
+		}},
+		{"ShardedPool", func(ctx context.Context) (execer, func(), error) {
+			db, err := shardPool.GetConnectionContext(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			return db, func() { shardPool.PutConnection(db) }, nil
+		}},
+		{"SessionPool", func(ctx context.Context) (execer, func(), error) {
+			conn, err := sessions.Get(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			return conn, func() { sessions.Put(conn) }, nil
+		}},
+		{"database/sql", func(ctx context.Context) (execer, func(), error) {
+			conn, err := native.Conn(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			return conn, func() { conn.Close() }, nil
+		}},
+	}
+
+	fmt.Printf("driver=%s conns=%d duration=%s hold=%s query=%q\n\n", *driver, *conns, *duration, *hold, *query)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "pool\tworkers\tops/s\tacquire p50\tacquire p99\tacquire max\terrors\t")
+	for _, n := range workers {
+		for _, side := range sides {
+			r := run(side.acquire, n, *duration, *hold, *query)
+			fmt.Fprintf(w, "%s\t%d\t%.0f\t%s\t%s\t%s\t%d\t\n", side.name, n,
+				float64(r.ops)/r.duration.Seconds(),
+				percentile(r.acquire, 0.50), percentile(r.acquire, 0.99), percentile(r.acquire, 1),
+				r.errors)
+		}
+	}
+	w.Flush()
+}
+
+// run drives acquire from n workers for d and collects what they measured
+func run(acquire acquirer, n int, d, hold time.Duration, query string) result {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	results := make([]result, n)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(r *result) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				t0 := time.Now()
+				conn, release, err := acquire(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						r.errors++
+					}
+					continue
+				}
+				r.acquire = append(r.acquire, time.Since(t0))
+				// Run the statement to completion even if time is up, so every
+				// counted operation did the same work
+				if query == "" {
+					r.ops++
+				} else if _, err := conn.ExecContext(context.Background(), query); err != nil {
+					r.errors++
+				} else {
+					r.ops++
+				}
+				if hold > 0 {
+					time.Sleep(hold)
+				}
+				release()
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	total := result{duration: time.Since(start)}
+	for _, r := range results {
+		total.ops += r.ops
+		total.errors += r.errors
+		total.acquire = append(total.acquire, r.acquire...)
+	}
+	sort.Slice(total.acquire, func(i, j int) bool { return total.acquire[i] < total.acquire[j] })
+	return total
+}
+
+// percentile returns the q-th quantile of sorted durations, rounded for
+// display
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q * float64(len(sorted)-1))
+	d := sorted[i]
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(100 * time.Nanosecond)
+}
+
+// parseLevels parses the -concurrency list
+func parseLevels(s string) ([]int, error) {
+	var levels []int
+	for _, field := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%q is not a positive worker count", field)
+		}
+		levels = append(levels, n)
+	}
+	return levels, nil
+}
+
+// fatal prints an error and exits
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "bench: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,9 @@
+// Package integration exercises the connection pool end-to-end against a
+// real MySQL server started with testcontainers-go: exhaustion, recovery
+// from killed sessions, primary/standby failover and graceful shutdown,
+// along with presence's SQLStore queries on the demo's user_status schema,
+// plus heartbeats on a Postgres server of their own. The tests need Docker
+// and are behind the integration build tag:
+//
+//	go test -tags integration ./integration
+package integration
@@ -0,0 +1,142 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	tcmysql "github.com/testcontainers/testcontainers-go/modules/mysql"
+
+	"github.com/system-design/week1/pool"
+)
+
+// dsn reaches the MySQL container started by TestMain
+var dsn string
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run starts MySQL with the user_status schema, runs the tests and removes
+// the container
+func run(m *testing.M) int {
+	ctx := context.Background()
+	container, err := tcmysql.RunContainer(ctx,
+		tcmysql.WithDatabase("online_status_db"),
+		tcmysql.WithScripts(filepath.Join("testdata", "schema.sql")),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start MySQL (is Docker running?): %v\n", err)
+		return 1
+	}
+	defer container.Terminate(ctx)
+
+	// clientFoundRows: heartbeats within the same second still count as
+	// updating their row
+	dsn, err = container.ConnectionString(ctx, "clientFoundRows=true")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get MySQL address: %v\n", err)
+		return 1
+	}
+	return m.Run()
+}
+
+// newPool creates a fixed pool of size connections to the container and
+// closes it when the test ends
+func newPool(t *testing.T, size int, cfg pool.PoolConfig) *pool.DBConnectionPool {
+	t.Helper()
+	cfg.DriverName = "mysql"
+	cfg.MinConns, cfg.MaxConns = size, size
+	p, err := pool.NewDBConnectionPoolWithConfig(dsn, cfg)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+// serverAddr returns the host:port of the container
+func serverAddr(t *testing.T) string {
+	t.Helper()
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("invalid DSN: %v", err)
+	}
+	return cfg.Addr
+}
+
+// dsnFor returns dsn pointed at addr instead of the container
+func dsnFor(t *testing.T, addr string) string {
+	t.Helper()
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("invalid DSN: %v", err)
+	}
+	cfg.Addr = addr
+	return cfg.FormatDSN()
+}
+
+// heartbeatQuery is the demo's MySQL heartbeat write
+const heartbeatQuery = "UPDATE user_status SET last_seen = ? WHERE user_id = ?"
+
+// heartbeat runs the demo's heartbeat write through p
+func heartbeat(ctx context.Context, p *pool.DBConnectionPool, userID string) error {
+	res, err := p.Exec(ctx, heartbeatQuery, time.Now().Unix(), userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return fmt.Errorf("heartbeat for %s updated %d rows: %v", userID, n, err)
+	}
+	return nil
+}
+
+// eventually polls cond until it holds or timeout passes
+func eventually(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %v waiting for %s", timeout, what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// killSessions kills every server session of the test user except the one
+// doing the killing, like a DBA or a proxy dropping connections
+func killSessions(t *testing.T) int {
+	t.Helper()
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id FROM information_schema.processlist WHERE user = 'test' AND id <> CONNECTION_ID()")
+	if err != nil {
+		t.Fatalf("failed to list sessions: %v", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		if _, err := db.Exec(fmt.Sprintf("KILL %d", id)); err != nil {
+			t.Fatalf("failed to kill session %d: %v", id, err)
+		}
+	}
+	return len(ids)
+}
@@ -0,0 +1,195 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/system-design/week1/pool"
+)
+
+func TestHeartbeats(t *testing.T) {
+	p := newPool(t, 4, pool.PoolConfig{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- heartbeat(context.Background(), p, fmt.Sprintf("user_%d", i%5))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if st := p.Stats(); st.TotalConns != 4 || st.InUseConns != 0 {
+		t.Errorf("pool should be back to 4 idle connections: %+v", st)
+	}
+}
+
+func TestExhaustion(t *testing.T) {
+	p := newPool(t, 2, pool.PoolConfig{Settings: pool.Settings{
+		AcquireTimeout: 300 * time.Millisecond,
+		MaxWaiters:     1,
+	}})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		conn, err := p.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Put(conn)
+	}
+
+	// One caller may wait and times out; the next is shed immediately
+	waitErr := make(chan error, 1)
+	go func() {
+		_, err := p.Get(ctx)
+		waitErr <- err
+	}()
+	eventually(t, time.Second, "a caller to start waiting", func() bool { return p.Stats().Waiters == 1 })
+	if _, err := p.Get(ctx); !errors.Is(err, pool.ErrPoolExhausted) {
+		t.Errorf("Get with MaxWaiters callers waiting: got %v, want ErrPoolExhausted", err)
+	}
+	if err := <-waitErr; !errors.Is(err, pool.ErrAcquireTimeout) {
+		t.Errorf("waiting Get: got %v, want ErrAcquireTimeout", err)
+	}
+	if _, ok := p.TryGet(); ok {
+		t.Error("TryGet succeeded on an exhausted pool")
+	}
+
+	st := p.Stats()
+	if st.WaitersShed != 1 || st.InUseConns != 2 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+func TestRecoveryFromKilledSessions(t *testing.T) {
+	p := newPool(t, 3, pool.PoolConfig{
+		RetryOnServerGone: true,
+		Settings:          pool.Settings{ValidateOnCheckout: true},
+	})
+	ctx := context.Background()
+	if err := heartbeat(ctx, p, "user_0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := killSessions(t); n < 3 {
+		t.Fatalf("killed %d sessions, want at least the pool's 3", n)
+	}
+	for i := 0; i < 10; i++ {
+		if err := heartbeat(ctx, p, "user_1"); err != nil {
+			t.Fatalf("heartbeat %d after sessions were killed: %v", i, err)
+		}
+	}
+	if st := p.Stats(); st.TotalConns != 3 {
+		t.Errorf("pool should have replaced its connections: %+v", st)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	// The primary is reached through a proxy that can be taken down; the
+	// standby is the same server reached directly
+	proxy := newTCPProxy(t, serverAddr(t))
+	p, err := pool.NewFailoverPool(dsnFor(t, proxy.addr), []string{dsn}, pool.PoolConfig{
+		DriverName:        "mysql",
+		HostRetryInterval: 200 * time.Millisecond,
+		Settings: pool.Settings{
+			MinConns:            2,
+			MaxConns:            2,
+			HealthCheckInterval: 100 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	events, stop := p.Events(64)
+	defer stop()
+
+	active := func(i int) func() bool {
+		return func() bool {
+			hosts := p.Stats().Hosts
+			return hosts[i].Active && hosts[i].Conns == 2
+		}
+	}
+	if !active(0)() {
+		t.Fatalf("pool should start on the primary: %+v", p.Stats().Hosts)
+	}
+
+	proxy.stop()
+	eventually(t, 5*time.Second, "failover to the standby", active(1))
+	if err := heartbeat(context.Background(), p, "user_2"); err != nil {
+		t.Errorf("heartbeat after failover: %v", err)
+	}
+
+	proxy.start()
+	eventually(t, 5*time.Second, "fail-back to the primary", active(0))
+	if err := heartbeat(context.Background(), p, "user_2"); err != nil {
+		t.Errorf("heartbeat after fail-back: %v", err)
+	}
+
+	var switches int
+	for len(events) > 0 {
+		if e := <-events; e.Type == pool.EventFailover {
+			switches++
+		}
+	}
+	if switches != 2 {
+		t.Errorf("got %d failover events, want 2", switches)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("waits for in-use connections", func(t *testing.T) {
+		p := newPool(t, 2, pool.PoolConfig{})
+		conn, err := p.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.AfterFunc(100*time.Millisecond, func() { p.Put(conn) })
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := p.Shutdown(shutdownCtx); err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+		if _, err := p.Get(ctx); !errors.Is(err, pool.ErrPoolClosed) {
+			t.Errorf("Get after Shutdown: got %v, want ErrPoolClosed", err)
+		}
+		if st := p.Stats(); st.TotalConns != 0 {
+			t.Errorf("connections left open after Shutdown: %+v", st)
+		}
+	})
+
+	t.Run("force-closes at the deadline", func(t *testing.T) {
+		p := newPool(t, 2, pool.PoolConfig{})
+		conn, err := p.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		if err := p.Shutdown(shutdownCtx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Shutdown with a connection held: got %v, want DeadlineExceeded", err)
+		}
+		if err := conn.PingContext(ctx); err == nil {
+			t.Error("force-closed connection still works")
+		}
+		p.Put(conn)
+	})
+}
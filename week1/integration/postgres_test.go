@@ -0,0 +1,92 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/system-design/week1/pool"
+)
+
+// TestPostgresHeartbeats runs the demo's heartbeats through a pool on the
+// lib/pq driver, against a Postgres container of its own
+func TestPostgresHeartbeats(t *testing.T) {
+	ctx := context.Background()
+	container, err := tcpostgres.RunContainer(ctx,
+		tcpostgres.WithDatabase("online_status_db"),
+		testcontainers.WithWaitStrategy(wait.ForLog("database system is ready to accept connections").
+			WithOccurrence(2).WithStartupTimeout(time.Minute)),
+	)
+	if err != nil {
+		t.Fatalf("failed to start Postgres (is Docker running?): %v", err)
+	}
+	t.Cleanup(func() { container.Terminate(ctx) })
+	pgDSN, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := pool.NewDBConnectionPoolWithConfig(pgDSN, pool.PoolConfig{
+		DriverName: "postgres",
+		Settings:   pool.Settings{MinConns: 4, MaxConns: 4},
+	})
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(p.Close)
+	if _, err := p.Exec(ctx, `CREATE TABLE user_status (
+		user_id   VARCHAR(64) PRIMARY KEY,
+		last_seen BIGINT      NOT NULL,
+		status    VARCHAR(8)  NOT NULL DEFAULT 'online'
+	)`); err != nil {
+		t.Fatalf("failed to create user_status: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := p.Exec(ctx, "INSERT INTO user_status (user_id, last_seen) VALUES ($1, 0)", fmt.Sprintf("user_%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- p.WithConnection(ctx, func(db *sql.DB) error {
+				// The demo's Postgres heartbeat statement
+				res, err := db.ExecContext(ctx, "UPDATE user_status SET last_seen = $1 WHERE user_id = $2", time.Now().Unix(), fmt.Sprintf("user_%d", i%5))
+				if err != nil {
+					return err
+				}
+				if n, err := res.RowsAffected(); err != nil || n != 1 {
+					return fmt.Errorf("heartbeat updated %d rows: %v", n, err)
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if st := p.Stats(); st.TotalConns != 4 || st.InUseConns != 0 {
+		t.Errorf("pool should be back to 4 idle connections: %+v", st)
+	}
+	p.Close()
+	if st := p.Stats(); st.TotalConns != 0 {
+		t.Errorf("Close left %d connections open", st.TotalConns)
+	}
+}
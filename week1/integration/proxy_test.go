@@ -0,0 +1,85 @@
+//go:build integration
+
+package integration
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// tcpProxy forwards connections to a backend and can be taken down and
+// brought back on the same address, to simulate a database host failing
+type tcpProxy struct {
+	t       *testing.T
+	addr    string
+	backend string
+
+	mu    sync.Mutex
+	ln    net.Listener
+	conns []net.Conn
+}
+
+// newTCPProxy starts a proxy to backend on a free local port
+func newTCPProxy(t *testing.T, backend string) *tcpProxy {
+	t.Helper()
+	p := &tcpProxy{t: t, addr: "127.0.0.1:0", backend: backend}
+	p.start()
+	p.addr = p.ln.Addr().String()
+	t.Cleanup(p.stop)
+	return p
+}
+
+// start accepts connections on the proxy's address
+func (p *tcpProxy) start() {
+	p.t.Helper()
+	ln, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		p.t.Fatalf("proxy failed to listen: %v", err)
+	}
+	p.mu.Lock()
+	p.ln = ln
+	p.mu.Unlock()
+	go p.serve(ln)
+}
+
+// stop closes the listener and every proxied connection
+func (p *tcpProxy) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ln != nil {
+		p.ln.Close()
+		p.ln = nil
+	}
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+}
+
+func (p *tcpProxy) serve(ln net.Listener) {
+	for {
+		client, err := ln.Accept()
+		if err != nil {
+			return // Stopped
+		}
+		server, err := net.Dial("tcp", p.backend)
+		if err != nil {
+			client.Close()
+			continue
+		}
+		p.mu.Lock()
+		p.conns = append(p.conns, client, server)
+		p.mu.Unlock()
+		go pipe(client, server)
+		go pipe(server, client)
+	}
+}
+
+// pipe copies src to dst until either side is closed, then closes both
+func pipe(dst, src net.Conn) {
+	io.Copy(dst, src)
+	dst.Close()
+	src.Close()
+}
@@ -0,0 +1,78 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/system-design/week1/pool"
+	"github.com/system-design/week1/presence"
+)
+
+// TestSQLStore runs presence's own MySQL queries against the schema: the
+// heartbeat upsert, the status reads and the offline sweep
+func TestSQLStore(t *testing.T) {
+	ctx := context.Background()
+	p := newPool(t, 2, pool.PoolConfig{})
+	store, err := presence.NewSQLStore(pool.NewSplitPool(p), nil, "mysql", 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Swept by hand below
+	detector := store.DetectOffline(time.Hour, nil)
+	t.Cleanup(detector.Close)
+	var mu sync.Mutex
+	var offline []string
+	defer detector.Subscribe(func(ev presence.OfflineEvent) {
+		mu.Lock()
+		offline = append(offline, ev.UserID)
+		mu.Unlock()
+	})()
+
+	// user_new has no row yet; user_0 was seeded by schema.sql
+	for _, id := range []string{"user_new", "user_0"} {
+		if _, err := store.Heartbeat(ctx, id); err != nil {
+			t.Fatalf("heartbeat for %s: %v", id, err)
+		}
+	}
+	statuses, err := store.BatchStatus(ctx, []string{"user_new", "user_0", "user_never"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Online || !statuses[1].Online {
+		t.Errorf("heartbeating users should be online: %+v", statuses)
+	}
+	if statuses[2].Online || !statuses[2].LastSeen.IsZero() {
+		t.Errorf("user_never should never have been seen: %+v", statuses[2])
+	}
+
+	// Past the online window the sweep marks user_new offline
+	time.Sleep(3 * time.Second)
+	if _, err := store.Heartbeat(ctx, "user_0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := detector.Sweep(ctx); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	st, err := store.Status(ctx, "user_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Online || st.LastSeen.IsZero() {
+		t.Errorf("user_new should be offline, seen before: %+v", st)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range offline {
+		if id == "user_0" {
+			t.Error("user_0 heartbeated and was still marked offline")
+		}
+	}
+	if !slices.Contains(offline, "user_new") {
+		t.Errorf("sweep reported %v offline, want user_new among them", offline)
+	}
+}
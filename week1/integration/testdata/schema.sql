@@ -0,0 +1,12 @@
+-- The demo's user_status: last_seen is the last heartbeat in Unix seconds,
+-- and status is kept by presence's OfflineDetector
+CREATE TABLE user_status (
+    user_id   VARCHAR(64) PRIMARY KEY,
+    last_seen BIGINT      NOT NULL,
+    status    VARCHAR(8)  NOT NULL DEFAULT 'online'
+);
+CREATE INDEX user_status_status_last_seen ON user_status (status, last_seen);
+
+INSERT INTO user_status (user_id, last_seen) VALUES
+    ('user_0', UNIX_TIMESTAMP()), ('user_1', UNIX_TIMESTAMP()), ('user_2', UNIX_TIMESTAMP()),
+    ('user_3', UNIX_TIMESTAMP()), ('user_4', UNIX_TIMESTAMP());
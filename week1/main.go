@@ -1,114 +1,560 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/system-design/week1/pool"
+	"github.com/system-design/week1/presence"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	_ "modernc.org/sqlite"
 )
 
-// DBConnectionPool represents a custom connection pool with a blocking queue
-type DBConnectionPool struct {
-	connections chan *sql.DB // Buffered channel acts as blocking queue
-	dsn         string
-	poolSize    int
+// tracer creates the demo's request spans; the pool adds its own beneath them
+var tracer = otel.Tracer("github.com/system-design/week1")
+
+// requestTimeout is each simulated request's deadline, covering its acquire,
+// update and read back
+const requestTimeout = 2 * time.Second
+
+// sqliteDSN is used when the sqlite driver is picked without a DSN; it needs
+// no server or credentials
+const sqliteDSN = "file:online_status.db?_pragma=busy_timeout(5000)"
+
+// mysqlConfig parses a MySQL DSN into a mysql.Config and fills in the
+// timeouts, TLS and session params the demo wants unless the DSN sets them
+func mysqlConfig(dsn string) (*mysql.Config, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := cfg.Params["charset"]; !ok {
+		if cfg.Params == nil {
+			cfg.Params = map[string]string{}
+		}
+		cfg.Params["charset"] = "utf8mb4"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = 10 * time.Second
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+	if cfg.TLSConfig == "" && cfg.TLS == nil {
+		// Encrypt when the server supports it; use tls=true or a registered
+		// config name in the DSN to require verified TLS in production
+		cfg.TLSConfig = "preferred"
+	}
+	return cfg, nil
+}
+
+// heartbeatQueries is the heartbeat UPDATE for each driver; Postgres uses
+// numbered placeholders instead of ?
+var heartbeatQueries = map[string]string{
+	"mysql":    "UPDATE user_status SET last_seen = ? WHERE user_id = ?",
+	"postgres": "UPDATE user_status SET last_seen = $1 WHERE user_id = $2",
+	"sqlite":   "UPDATE user_status SET last_seen = ? WHERE user_id = ?",
+}
+
+// lastSeenQueries reads a user's last heartbeat back for each driver
+var lastSeenQueries = map[string]string{
+	"mysql":    "SELECT last_seen FROM user_status WHERE user_id = ?",
+	"postgres": "SELECT last_seen FROM user_status WHERE user_id = $1",
+	"sqlite":   "SELECT last_seen FROM user_status WHERE user_id = ?",
 }
 
-// NewDBConnectionPool creates a new connection pool with specified size
-func NewDBConnectionPool(dsn string, poolSize int) (*DBConnectionPool, error) {
-	pool := &DBConnectionPool{
-		connections: make(chan *sql.DB, poolSize), // Buffered channel = blocking queue
-		dsn:         dsn,
-		poolSize:    poolSize,
+func main() {
+	// The same pool works with any database/sql driver. Settings come from
+	// a YAML file (see pool.example.yaml) or DB_* environment variables
+	configPath := flag.String("config", "", "YAML pool config file, re-read on SIGHUP (default: read DB_* environment variables)")
+	driver := flag.String("driver", "", "database driver: mysql, postgres or sqlite (overrides the config)")
+	dsn := flag.String("dsn", "", "data source name (overrides the config)")
+	standbyDSNs := flag.String("standbys", "", "comma-separated standby DSNs to fail over to, in order, when the primary is down")
+	replicaDSNs := flag.String("replicas", "", "comma-separated replica DSNs for last_seen reads (default: read from the primary)")
+	shardDSNs := flag.String("shards", "", "comma-separated DSNs of further user_status databases, same driver as the primary; users are spread across the primary and these by consistent hashing of user_id")
+	verbose := flag.Bool("v", false, "log every acquire and release")
+	adminAddr := flag.String("admin", "", "address to serve /metrics, /debug/pool/, /debug/vars, health probes and, with -shards, /debug/shards on, e.g. localhost:8081")
+	migration := flag.String("migrate", "", "statement, e.g. an ALTER TABLE, to run partway through the demo with heartbeat traffic paused")
+	auditPath := flag.String("audit", "", "file to append an audit trail of every connection checkout to, as JSON lines")
+	listenAddr := flag.String("listen", "", "address to serve the heartbeat API on until SIGINT or SIGTERM, e.g. :8080 (default: run the simulated requests and exit)")
+	grpcAddr := flag.String("grpc", "", "address to serve the presence gRPC service on, alongside or instead of -listen, e.g. :9090")
+	onlineWindow := flag.Duration("online-window", 30*time.Second, "how recent a user's last heartbeat must be for the API to report them online")
+	awayAfter := flag.Duration("away-after", presence.DefaultThresholds.Away, "how long an online user may go without a heartbeat before showing as away, between the clients' heartbeat interval and -online-window, e.g. 2m for clients beating every 30s with -online-window 10m (default: never away)")
+	recentlySeen := flag.Duration("recently-seen-for", presence.DefaultThresholds.RecentlySeen, "how long after going offline a user still shows as recently seen in status and last-seen replies, 0 for never")
+	watchInterval := flag.Duration("watch-interval", time.Second, "how often /v1/status/stream polls its watched users for changes")
+	redisAddr := flag.String("redis", "", "Redis address to keep online status in as expiring keys, with the database kept as the durable last_seen record, e.g. localhost:6379")
+	detectOffline := flag.Duration("detect-offline", 0, "sweep user_status this often, marking users past -online-window offline in its status column, e.g. 5s (default: compute offline from last_seen on every read)")
+	coalesceInterval := flag.Duration("coalesce-interval", 0, "buffer heartbeats and write them as one multi-row upsert this often, e.g. 100ms (default: one UPDATE per heartbeat)")
+	coalesceBatch := flag.Int("coalesce-batch", presence.DefaultCoalesceBatch, "with -coalesce-interval, flush early once this many users have heartbeats buffered")
+	coalesceBacklog := flag.Int("coalesce-backlog", presence.DefaultCoalesceBacklog, "with -coalesce-interval, the most users' heartbeats to hold unwritten while the database fails, refusing new users' beyond it")
+	flag.Parse()
+
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	// Heartbeats are stored in whole seconds
+	if *onlineWindow < time.Second {
+		fatal(logger, "-online-window must be at least 1s", "online_window", *onlineWindow)
+	}
+	// Past the online window users are offline, so they'd never be away
+	if *awayAfter >= *onlineWindow {
+		fatal(logger, "-away-after must be shorter than -online-window", "away_after", *awayAfter, "online_window", *onlineWindow)
+	}
+
+	cfg, err := loadConfig(*configPath, *driver, *dsn)
+	if err != nil {
+		fatal(logger, "Failed to load pool config", "error", err)
+	}
+	if cfg.DSN == "" {
+		fatal(logger, "No DSN configured: set DB_DSN, pass -dsn, or set dsn in the -config file")
+	}
+
+	heartbeatQuery, ok := heartbeatQueries[cfg.DriverName]
+	if !ok {
+		fatal(logger, "Unsupported driver", "driver", cfg.DriverName)
 	}
+	lastSeenQuery := lastSeenQueries[cfg.DriverName]
 
-	// Initialize the pool with connections
-	for i := 0; i < poolSize; i++ {
-		db, err := sql.Open("mysql", dsn)
+	// Settings that are part of the demo rather than the deployment
+	poolCfg := cfg.PoolConfig
+	// Requests hold connections for ~100ms; anything past 5s is a leak
+	poolCfg.LeakDetectionThreshold = 5 * time.Second
+	poolCfg.Logger = logger
+	if *auditPath != "" {
+		audit, err := pool.OpenAuditLog(*auditPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create connection %d: %v", i, err)
+			fatal(logger, "Failed to open audit log", "error", err)
 		}
+		defer audit.Close()
+		poolCfg.Audit = audit
+	}
+	// Fail fast for 5s at a time once 5 dials in a row have failed
+	poolCfg.CircuitBreakerThreshold = 5
+	// Heartbeats may use at most 8 connections, keeping the rest free for
+	// the admin endpoint and any batch work sharing the pool
+	poolCfg.Partitions = map[string]int{"heartbeat": 8}
 
-		// Test the connection
-		if err := db.Ping(); err != nil {
-			return nil, fmt.Errorf("failed to ping connection %d: %v", i, err)
+	var dbPool *pool.DBConnectionPool
+	if *standbyDSNs != "" {
+		dbPool, err = pool.NewFailoverPool(cfg.DSN, strings.Split(*standbyDSNs, ","), poolCfg)
+	} else if cfg.DriverName == "mysql" {
+		var mysqlCfg *mysql.Config
+		if mysqlCfg, err = mysqlConfig(cfg.DSN); err == nil {
+			dbPool, err = pool.NewMySQLPool(mysqlCfg, poolCfg)
 		}
-
-		// Put connection in the pool
-		pool.connections <- db
-		log.Printf("Connection %d initialized and added to pool", i+1)
+	} else {
+		dbPool, err = pool.NewDBConnectionPoolWithConfig(cfg.DSN, poolCfg)
+	}
+	if err != nil {
+		fatal(logger, "Failed to create connection pool", "error", err)
 	}
 
-	return pool, nil
-}
+	// SIGHUP re-reads the config and applies it to the primary pool, e.g.
+	// after rotating the password in its DSN, without a restart. Standbys
+	// sharing the primary's credentials are rotated along with it
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			next, err := loadConfig(*configPath, *driver, *dsn)
+			if err != nil {
+				logger.Error("Failed to reload pool config", "error", err)
+				continue
+			}
+			if err := dbPool.Reload(next); err != nil {
+				logger.Error("Failed to reload pool config", "error", err)
+			}
+		}
+	}()
+	// SIGUSR1 dumps the pool's connections, waiters and recent events to
+	// stderr, for a look inside during an incident
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			dbPool.Dump(os.Stderr)
+		}
+	}()
+	// Registered pools can be looked up by name with pool.Get and are shut
+	// down together at exit
+	if err := pool.Register("primary", dbPool); err != nil {
+		fatal(logger, "Failed to register pool", "error", err)
+	}
 
-// GetConnection retrieves a connection from the pool (blocks if none available)
-func (p *DBConnectionPool) GetConnection() *sql.DB {
-	// This will block if the channel is empty (all connections in use)
-	// Once a connection is available, it will be returned
-	log.Println("Requesting connection from pool...")
-	conn := <-p.connections
-	log.Println("Connection acquired from pool")
-	return conn
-}
+	// Heartbeat writes go to the primary; last_seen reads are spread across
+	// the replicas, which can lag a little behind and are opened read-only so
+	// a stray write fails loudly instead of diverging from the primary
+	var replicas []*pool.DBConnectionPool
+	if *replicaDSNs != "" {
+		replicaCfg := poolCfg
+		replicaCfg.ReadOnly = true
+		for i, replicaDSN := range strings.Split(*replicaDSNs, ",") {
+			replica, err := pool.NewDBConnectionPoolWithConfig(replicaDSN, replicaCfg)
+			if err != nil {
+				fatal(logger, "Failed to create replica pool", "error", err)
+			}
+			if err := pool.Register(fmt.Sprintf("replica-%d", i), replica); err != nil {
+				fatal(logger, "Failed to register pool", "error", err)
+			}
+			replicas = append(replicas, replica)
+		}
+	}
+	split := pool.NewSplitPool(dbPool, replicas...)
+	heartbeats, err := dbPool.Partition("heartbeat")
+	if err != nil {
+		fatal(logger, "Missing pool partition", "error", err)
+	}
+	defer func() {
+		// Give in-flight requests up to 5 seconds to return their connections
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := split.Shutdown(ctx); err != nil {
+			logger.Warn("Pool shutdown", "error", err)
+		}
+	}()
 
-// PutConnection returns a connection back to the pool
-func (p *DBConnectionPool) PutConnection(conn *sql.DB) {
-	// This will block if the channel is full (should never happen in correct usage)
-	log.Println("Returning connection to pool")
-	p.connections <- conn
-}
+	// Publish pool gauges and histograms to the default Prometheus registry
+	if err := dbPool.EnableMetrics(prometheus.DefaultRegisterer); err != nil {
+		fatal(logger, "Failed to enable pool metrics", "error", err)
+	}
+	var adminMux *http.ServeMux // Set with -admin, for routes added further on
+	if *adminAddr != "" {
+		mux := http.NewServeMux()
+		adminMux = mux
+		mux.Handle("/metrics", promhttp.Handler())
+		mux.Handle("/debug/pool/", http.StripPrefix("/debug/pool", dbPool.AdminHandler()))
+		mux.Handle("/debug/vars", expvar.Handler())
+		// Liveness and readiness probes for Kubernetes
+		health := dbPool.HealthHandler(time.Second)
+		mux.Handle("/livez", health)
+		mux.Handle("/readyz", health)
+		mux.Handle("/healthz", health)
+		go func() {
+			if err := http.ListenAndServe(*adminAddr, mux); err != nil {
+				logger.Error("Admin server stopped", "error", err)
+			}
+		}()
+	}
 
-// Close closes all connections in the pool
-func (p *DBConnectionPool) Close() {
-	close(p.connections)
-	for conn := range p.connections {
-		conn.Close()
+	if *listenAddr != "" || *grpcAddr != "" {
+		var (
+			detectors  []*presence.OfflineDetector
+			coalescers []*presence.Coalescer
+		)
+		defer func() {
+			for _, detector := range detectors {
+				detector.Close()
+			}
+		}()
+		// newSQLStore builds the store over one database, with the offline
+		// detector and heartbeat buffer the flags ask for
+		newSQLStore := func(split *pool.SplitPool, heartbeats presence.Acquirer, metrics prometheus.Registerer) *presence.SQLStore {
+			sqlStore, err := presence.NewSQLStore(split, heartbeats, cfg.DriverName, *onlineWindow)
+			if err != nil {
+				split.Close()
+				fatal(logger, "Failed to create presence store", "error", err)
+			}
+			if *detectOffline > 0 {
+				detector := sqlStore.DetectOffline(*detectOffline, logger)
+				detectors = append(detectors, detector)
+				detector.Subscribe(func(e presence.OfflineEvent) {
+					logger.Info("User went offline", "user_id", e.UserID, "last_seen", e.LastSeen)
+				})
+			}
+			if *coalesceInterval > 0 {
+				coalescer := sqlStore.Coalesce(*coalesceInterval, *coalesceBatch, *coalesceBacklog, logger)
+				if err := coalescer.EnableMetrics(metrics, "presence"); err != nil {
+					split.Close()
+					fatal(logger, "Failed to enable heartbeat buffer metrics", "error", err)
+				}
+				coalescers = append(coalescers, coalescer)
+			}
+			return sqlStore
+		}
+		var store presence.Store
+		if *shardDSNs == "" {
+			store = newSQLStore(split, heartbeats, prometheus.DefaultRegisterer)
+		} else {
+			// The primary, with its replicas, is shard-0; each further DSN
+			// is a database of its own. Metrics are told apart by shard
+			shardMetrics := func(name string) prometheus.Registerer {
+				return prometheus.WrapRegistererWith(prometheus.Labels{"shard": name}, prometheus.DefaultRegisterer)
+			}
+			shards := []presence.Shard{{Name: "shard-0", Store: newSQLStore(split, heartbeats, shardMetrics("shard-0"))}}
+			for i, shardDSN := range strings.Split(*shardDSNs, ",") {
+				name := fmt.Sprintf("shard-%d", i+1)
+				shardPool, err := pool.NewDBConnectionPoolWithConfig(shardDSN, poolCfg)
+				if err != nil {
+					fatal(logger, "Failed to create shard pool", "shard", name, "error", err)
+				}
+				if err := pool.Register(name, shardPool); err != nil {
+					fatal(logger, "Failed to register pool", "error", err)
+				}
+				shardSplit := pool.NewSplitPool(shardPool)
+				defer func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					if err := shardSplit.Shutdown(ctx); err != nil {
+						logger.Warn("Pool shutdown", "pool", name, "error", err)
+					}
+				}()
+				shardHeartbeats, err := shardPool.Partition("heartbeat")
+				if err != nil {
+					fatal(logger, "Missing pool partition", "error", err)
+				}
+				shards = append(shards, presence.Shard{Name: name, Store: newSQLStore(shardSplit, shardHeartbeats, shardMetrics(name))})
+			}
+			sharded, err := presence.NewShardedStore(shards...)
+			if err != nil {
+				fatal(logger, "Failed to create sharded store", "error", err)
+			}
+			if adminMux != nil {
+				adminMux.Handle("/debug/shards", sharded.HealthHandler())
+			}
+			store = sharded
+			logger.Info("Sharding users across databases", "shards", len(shards))
+		}
+		var changes presence.ChangeBackend
+		if *redisAddr != "" {
+			rdb := redis.NewClient(&redis.Options{Addr: *redisAddr})
+			defer rdb.Close()
+			store = presence.NewRedisStore(rdb, *onlineWindow, store)
+			changes = presence.NewRedisChanges(rdb, "presence:changes")
+			logger.Info("Keeping online status in Redis", "addr", *redisAddr)
+		}
+		// Announce transitions for other components; here they are logged
+		publisher := presence.NewPublisher(store, *onlineWindow, *awayAfter, changes, logger)
+		defer publisher.Close()
+		if err := publisher.EnableMetrics(prometheus.DefaultRegisterer, "presence"); err != nil {
+			fatal(logger, "Failed to enable presence metrics", "error", err)
+		}
+		store = publisher
+		transitions, _ := publisher.Subscribe(256)
+		go func() {
+			for c := range transitions {
+				logger.Debug("User presence changed", "user_id", c.UserID, "state", c.State, "last_seen", c.LastSeen)
+			}
+		}()
+		thresholds := presence.DefaultThresholds
+		thresholds.Away = *awayAfter
+		thresholds.RecentlySeen = *recentlySeen
+		watcher := presence.NewWatcher(store, thresholds, *watchInterval, logger)
+		defer watcher.Close()
+		srv := &heartbeatServer{store: store, thresholds: thresholds, onlineWindow: *onlineWindow, watcher: watcher, logger: logger}
+		err = srv.serve(*listenAddr, *grpcAddr, 5*time.Second)
+		for _, coalescer := range coalescers {
+			// Write the heartbeats still buffered before the pools close
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := coalescer.Close(ctx); err != nil {
+				logger.Error("Failed to flush buffered heartbeats", "error", err, "stats", coalescer.Stats())
+			}
+			cancel()
+		}
+		if err != nil {
+			split.Close()
+			fatal(logger, "Heartbeat API stopped", "error", err)
+		}
+		return // The deferred Shutdown closes the pools
 	}
-	log.Println("All connections closed")
-}
 
-func main() {
-	// Example DSN (Data Source Name) for MySQL
-	// Format: username:password@tcp(host:port)/database
-	dsn := "user:password@tcp(localhost:3306)/online_status_db"
+	// handleHeartbeat serves one simulated heartbeat request. ctx carries
+	// the request's deadline through the acquire, the update and the read
+	// back, so a slow pool or database fails the request instead of
+	// stalling it
+	handleHeartbeat := func(ctx context.Context, requestID int) error {
+		// Each request is its own trace: acquire, update and release spans
+		// all hang off this root span
+		ctx, span := tracer.Start(ctx, "heartbeat")
+		defer span.End()
 
-	// Create a connection pool with 10 connections
-	pool, err := NewDBConnectionPool(dsn, 10)
-	if err != nil {
-		log.Fatalf("Failed to create connection pool: %v", err)
+		// Get a connection to the primary (blocks if the heartbeat
+		// partition's 8 are in use); With returns it when the callback is done
+		userID := fmt.Sprintf("user_%d", requestID)
+		reqLog := logger.With("request_id", requestID, "user_id", userID)
+		// Shows up as the holder in /debug/pool/conns and leak reports
+		ctx = pool.WithHolder(ctx, fmt.Sprintf("heartbeat request %d", requestID))
+		err := heartbeats.With(ctx, func(conn *sql.DB) error {
+			reqLog.Debug("Using connection for heartbeat update")
+
+			execCtx, execSpan := tracer.Start(ctx, "heartbeat.update")
+			defer execSpan.End()
+			execSpan.SetAttributes(
+				attribute.String("db.system", cfg.DriverName),
+				attribute.String("db.statement", heartbeatQuery),
+				attribute.String("user.id", userID),
+			)
+			// Prepared once per pooled connection, then reused
+			stmt, err := split.Primary().Stmt(execCtx, conn, heartbeatQuery)
+			if err == nil {
+				_, err = stmt.ExecContext(execCtx, time.Now().Unix(), userID)
+			}
+			if err != nil {
+				execSpan.RecordError(err)
+				execSpan.SetStatus(codes.Error, err.Error())
+				return err
+			}
+
+			// Simulate some work, giving up with the request
+			select {
+			case <-time.After(100 * time.Millisecond):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("request %d: heartbeat update: %w", requestID, err)
+		}
+
+		// Read the heartbeat back from a replica
+		conn, err := split.GetReadConnection(ctx)
+		if err != nil {
+			return fmt.Errorf("request %d: no read connection: %w", requestID, err)
+		}
+		defer split.PutConnection(conn)
+		var lastSeen int64
+		if err := conn.QueryRowContext(ctx, lastSeenQuery, userID).Scan(&lastSeen); err != nil {
+			return fmt.Errorf("request %d: reading last_seen: %w", requestID, err)
+		}
+		reqLog.Info("Completed", "last_seen", lastSeen)
+		return nil
 	}
-	defer pool.Close()
 
-	// Example usage: Simulate multiple concurrent requests
+	// Example usage: simulate concurrent requests, each with its own
+	// deadline, all cancelled together on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []error
+	)
 	for i := 0; i < 15; i++ {
+		wg.Add(1)
 		go func(requestID int) {
-			// Get a connection from the pool (blocks if all 10 are in use)
-			conn := pool.GetConnection()
-			
-			// Use the connection to perform DB operations
-			log.Printf("Request %d: Using connection for heartbeat update", requestID)
-			
-			// Simulate DB operation
-			_, err := conn.Exec("UPDATE user_status SET last_seen = ? WHERE user_id = ?", 
-				time.Now().Unix(), fmt.Sprintf("user_%d", requestID))
-			if err != nil {
-				log.Printf("Request %d: Error: %v", requestID, err)
-			}
-			
-			// Simulate some work
-			time.Sleep(100 * time.Millisecond)
-			
-			// Return the connection back to the pool
-			pool.PutConnection(conn)
-			log.Printf("Request %d: Completed", requestID)
+			defer wg.Done()
+			reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+			defer cancel()
+			if err := handleHeartbeat(reqCtx, requestID); err != nil {
+				mu.Lock()
+				failed = append(failed, err)
+				mu.Unlock()
+			}
 		}(i)
 	}
+	// With -migrate, the schema change runs while the requests are in
+	// flight: those already holding a connection finish, later ones wait
+	// for it instead of racing it
+	if *migration != "" {
+		time.Sleep(50 * time.Millisecond)
+		if err := migrate(ctx, dbPool, *migration, logger); err != nil {
+			logger.Error("Migration failed", "error", err)
+		}
+	}
+	wg.Wait()
 
-	// Wait for all goroutines to complete
-	time.Sleep(3 * time.Second)
-	log.Println("All requests completed")
+	for name, stats := range pool.Stats() {
+		logger.Info("Pool stats", "pool", name, "stats", fmt.Sprintf("%+v", stats))
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pool.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Pools did not shut down cleanly", "error", err)
+	}
+	if err := errors.Join(failed...); err != nil {
+		logger.Error("Some requests failed", "failed", len(failed), "error", err)
+		os.Exit(1)
+	}
+	logger.Info("All requests completed")
 }
 
+// migrate runs a schema change on p with new acquisitions paused, once the
+// connections already checked out have been returned
+func migrate(ctx context.Context, p *pool.DBConnectionPool, statement string, logger *slog.Logger) error {
+	// Taken before pausing, as Pause holds back every new acquisition
+	conn, err := p.GetConnectionContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.PutConnection(conn)
+	if err := p.Pause(pool.PauseWait); err != nil {
+		return err
+	}
+	defer p.Resume()
+
+	// Quiesce: wait for the other checkouts, whose requests are bounded by
+	// their own deadlines
+	ctx, cancel := context.WithTimeout(ctx, 2*requestTimeout)
+	defer cancel()
+	for p.Stats().InUseConns > 1 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for in-flight requests: %w", ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	start := time.Now()
+	if _, err := conn.ExecContext(ctx, statement); err != nil {
+		return err
+	}
+	logger.Info("Migration applied with acquisitions paused", "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// loadConfig reads the pool config from the YAML file at path, or from the
+// environment if path is empty, and applies the -driver and -dsn overrides
+func loadConfig(path, driver, dsn string) (pool.DBConfig, error) {
+	var cfg pool.DBConfig
+	var err error
+	if path != "" {
+		cfg, err = pool.ConfigFromYAML(path)
+	} else {
+		cfg, err = pool.ConfigFromEnv()
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if driver != "" {
+		cfg.DriverName = driver
+	}
+	if cfg.DriverName == "" {
+		cfg.DriverName = "mysql"
+	}
+	if dsn != "" {
+		cfg.DSN = dsn
+	}
+	if cfg.DSN == "" && cfg.DriverName == "sqlite" {
+		cfg.DSN = sqliteDSN
+	}
+	return cfg, nil
+}
+
+// fatal logs an error and exits, like log.Fatal for a slog.Logger
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,216 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultDrainTimeout is how long a drain request waits for in-use
+// connections unless it passes ?timeout=
+const defaultDrainTimeout = 30 * time.Second
+
+// Holder describes a connection currently checked out of the pool
+type Holder struct {
+	ConnID     int64         `json:"conn_id"`
+	Holder     string        `json:"holder,omitempty"` // Set with WithHolder
+	AcquiredAt time.Time     `json:"acquired_at"`
+	HeldFor    time.Duration `json:"held_for_ns"`
+	Stack      string        `json:"stack,omitempty"` // Only with LeakDetectionThreshold set
+}
+
+// Holders lists the connections currently checked out, longest held first
+func (p *Pool[T]) Holders() []Holder {
+	p.mu.Lock()
+	now := time.Now()
+	holders := []Holder{}
+	for _, info := range p.conns {
+		if info.state != connInUse {
+			continue
+		}
+		holders = append(holders, Holder{
+			ConnID:     info.id,
+			Holder:     info.holder,
+			AcquiredAt: info.acquiredAt,
+			HeldFor:    now.Sub(info.acquiredAt),
+			Stack:      string(info.acquireStack),
+		})
+	}
+	p.mu.Unlock()
+
+	sort.Slice(holders, func(i, j int) bool { return holders[i].HeldFor > holders[j].HeldFor })
+	return holders
+}
+
+// AdminHandler returns an HTTP handler for inspecting and operating the pool,
+// to be mounted into an existing server, e.g.
+//
+//	mux.Handle("/debug/pool/", http.StripPrefix("/debug/pool", p.AdminHandler()))
+//
+// It serves:
+//
+//	GET  /                         pool stats as JSON
+//	GET  /holders                  checked out connections and how long they've been held
+//	GET  /conns                    every connection: state, age, use count, holder and activity
+//	GET  /dump                     human-readable snapshot of connections, waiters and events (see Dump)
+//	POST /resize?size=N            change MaxConns (see Resize)
+//	POST /drain?timeout=30s        shut the pool down gracefully (see Shutdown)
+//	POST /pause?timeout=30s        pause the pool for maintenance (see Drain)
+//	POST /quiesce?policy=wait      hold new acquisitions, keeping connections open (see Pause)
+//	POST /resume                   reopen a paused or quiesced pool (see Resume)
+//
+// The handler has no authentication of its own; only expose it on an
+// internal listener
+func (p *Pool[T]) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "" {
+			http.NotFound(w, r)
+			return
+		}
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Stats())
+	})
+	mux.HandleFunc("/holders", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Holders())
+	})
+	mux.HandleFunc("/conns", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Connections())
+	})
+	mux.HandleFunc("/dump", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		p.Dump(w)
+	})
+	mux.HandleFunc("/resize", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		size, err := strconv.Atoi(r.URL.Query().Get("size"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid size: %v", err))
+			return
+		}
+		if err := p.Resize(size); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Stats())
+	})
+	mux.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		timeout, ok := drainTimeout(w, r)
+		if !ok {
+			return
+		}
+		// Not tied to the request: a client hanging up must not cut the
+		// drain short and force-close connections
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := p.Shutdown(ctx); err != nil {
+			writeError(w, http.StatusGatewayTimeout, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Stats())
+	})
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		timeout, ok := drainTimeout(w, r)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		if err := p.Drain(ctx); err != nil {
+			writeError(w, http.StatusGatewayTimeout, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Stats())
+	})
+	mux.HandleFunc("/quiesce", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		var policy PausePolicy
+		switch v := r.URL.Query().Get("policy"); v {
+		case "", "wait":
+			policy = PauseWait
+		case "fail":
+			policy = PauseFail
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid policy %q: want wait or fail", v))
+			return
+		}
+		if err := p.Pause(policy); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Stats())
+	})
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		if err := p.Resume(); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Stats())
+	})
+	return mux
+}
+
+// drainTimeout reads a drain or pause request's ?timeout=, writing an error
+// response if it is invalid
+func drainTimeout(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	v := r.URL.Query().Get("timeout")
+	if v == "" {
+		return defaultDrainTimeout, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout: %v", err))
+		return 0, false
+	}
+	return d, true
+}
+
+// allowMethod rejects requests that don't use the given method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+	return false
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error as a JSON response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
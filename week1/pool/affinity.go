@@ -0,0 +1,65 @@
+package pool
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// GetFor retrieves a connection like Get, preferring the one key (e.g. a
+// user ID) consistently maps to, so session state such as temporary tables
+// or user variables is found again on later calls. If that connection is in
+// use or gone, any connection is handed out instead. Keys are spread with
+// rendezvous hashing, so growing or shrinking the pool only remaps the keys
+// of the connections that were added or removed
+func (p *Pool[T]) GetFor(ctx context.Context, key string) (T, error) {
+	return p.acquireThrough(ctx, func(ctx context.Context) (T, error) {
+		return p.get(ctx, PriorityNormal, key, true)
+	})
+}
+
+// takeAffine takes the connection key maps to out of the idle queue, if it
+// is idle. It reports false if the connection is busy or the pool is closed
+func (p *Pool[T]) takeAffine(key string) (T, bool) {
+	var zero T
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unavailable() != nil {
+		return zero, false
+	}
+
+	// The connection with the highest hash of (key, connection id) wins
+	var best T
+	var bestInfo *connInfo
+	var bestScore uint64
+	for conn, info := range p.conns {
+		if info.state == connForceClosed {
+			continue
+		}
+		if score := affinityScore(key, info.id); bestInfo == nil || score > bestScore {
+			best, bestInfo, bestScore = conn, info, score
+		}
+	}
+	if bestInfo == nil || bestInfo.state != connIdle {
+		return zero, false
+	}
+
+	for i, conn := range p.idle {
+		if conn == best {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			bestInfo.state = connInUse
+			return conn, true
+		}
+	}
+	return zero, false
+}
+
+// affinityScore hashes a key together with a connection id
+func affinityScore(key string, id int64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(id))
+	h.Write(buf[:])
+	return h.Sum64()
+}
@@ -0,0 +1,160 @@
+package pool
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit operations, as recorded in AuditRecord.Op
+const (
+	AuditAcquire = "acquire"
+	AuditRelease = "release"
+	AuditDiscard = "discard"
+)
+
+// AuditRecord is one entry of a pool's audit trail: a checkout, or a
+// return of one, with where in the program it happened
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`      // AuditAcquire, AuditRelease or AuditDiscard
+	ConnID int64     `json:"conn_id"` // 0 for a rejected return of a connection the pool doesn't know
+	// Caller is the first function outside this package on the stack, with
+	// its file and line, e.g. "main.handle main.go:42"
+	Caller string `json:"caller"`
+	Holder string `json:"holder,omitempty"` // WithHolder label of the checkout
+	// HeldFor is how long the checkout lasted (returns only)
+	HeldFor time.Duration `json:"held_for_ns,omitempty"`
+	// Statements is how many statements the checkout ran, for pools that
+	// count them (DBConnectionPool; returns only)
+	Statements int64 `json:"statements,omitempty"`
+	// Error is why a return was rejected, e.g. a double return
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink receives a pool's audit trail (see Settings.Audit). Record is
+// called on the goroutine acquiring or returning the connection, outside
+// the pool's lock, so it must be quick and safe for concurrent use
+type AuditSink interface {
+	Record(r AuditRecord)
+}
+
+// AuditLog is an AuditSink writing each record as a line of JSON
+type AuditLog struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+	err    error // First write error; later records are dropped
+}
+
+// NewAuditLog returns an AuditLog writing to w
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{enc: json.NewEncoder(w)}
+}
+
+// OpenAuditLog returns an AuditLog appending to the file at path, created
+// readable by its owner only if it doesn't exist, since the trail names
+// code paths and holders. Close closes the file
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l := NewAuditLog(f)
+	l.closer = f
+	return l, nil
+}
+
+// Record writes r
+func (l *AuditLog) Record(r AuditRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = l.enc.Encode(r)
+	}
+}
+
+// Err returns the first error writing the log, after which it stopped
+func (l *AuditLog) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Close closes the file an OpenAuditLog log writes to; for NewAuditLog it
+// does nothing
+func (l *AuditLog) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// auditPackage is this package's import path plus ".", the prefix of its
+// functions' names, which auditCaller skips
+var auditPackage = reflect.TypeOf(AuditRecord{}).PkgPath() + "."
+
+// auditCaller describes the first function outside this package on the
+// calling goroutine's stack
+func auditCaller() string {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, auditPackage) {
+			return frame.Function + " " + filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// statementsRunLocked is how many statements conn has run, for pools that
+// count them. Requires p.mu
+func (p *Pool[T]) statementsRunLocked(conn T) int64 {
+	if p.connMeta == nil {
+		return 0
+	}
+	var meta ConnMeta
+	p.connMeta(conn, &meta)
+	if meta.Activity == nil {
+		return 0
+	}
+	return meta.Activity.Queries
+}
+
+// auditReleaseLocked builds the record of a checkout ending now. Requires
+// p.mu, and info to still describe the checkout
+func (p *Pool[T]) auditReleaseLocked(op string, conn T, info *connInfo, now time.Time) AuditRecord {
+	return AuditRecord{
+		Time:       now,
+		Op:         op,
+		ConnID:     info.id,
+		Holder:     info.holder,
+		HeldFor:    now.Sub(info.acquiredAt),
+		Statements: p.statementsRunLocked(conn) - info.auditStatements,
+	}
+}
+
+// auditRecord fills in the caller and hands r to the audit sink, if any.
+// Must not be called with p.mu held
+func (p *Pool[T]) auditRecord(r AuditRecord) {
+	if p.audit == nil {
+		return
+	}
+	r.Caller = auditCaller()
+	p.audit.Record(r)
+}
+
+// auditRejected records a return that was refused with err
+func (p *Pool[T]) auditRejected(op string, conn T, err error) {
+	p.auditRecord(AuditRecord{Time: time.Now(), Op: op, ConnID: p.connID(conn), Error: err.Error()})
+}
@@ -0,0 +1,120 @@
+package pool
+
+import (
+	"time"
+)
+
+// Defaults for the auto-tuner
+const (
+	defaultAutoTuneTargetWait = 10 * time.Millisecond
+	autoTuneSlowdown          = 2.0              // Hold time vs baseline that counts as a slow database
+	autoTuneBaselineWeight    = 0.1              // How fast the hold time baseline follows the database
+	autoTuneMinHold           = time.Millisecond // Shorter hold times are noise, not a slow database
+)
+
+// autoTuner adjusts the pool's MaxConns between MinConns and a ceiling with
+// additive increase, multiplicative decrease: it adds a connection at a time
+// while callers wait on a healthy database, and cuts back by a quarter when
+// the database itself slows down, since more connections would only add to
+// its load. Guarded by p.mu
+type autoTuner struct {
+	ceiling    int // Configured MaxConns, or the size set by Resize
+	targetWait time.Duration
+
+	baselineHold time.Duration // Moving average of hold time, i.e. DB latency
+
+	// Counters at the end of the previous window
+	acquires     int64
+	waitDuration time.Duration
+	holds        int64
+	holdDuration time.Duration
+}
+
+// autoTuneLoop re-evaluates the pool size every AutoTuneInterval until the
+// pool is closed
+func (p *Pool[T]) autoTuneLoop(interval time.Duration) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.autoTune()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// autoTune looks at the acquisitions since the last call and grows or
+// shrinks MaxConns accordingly
+func (p *Pool[T]) autoTune() {
+	p.mu.Lock()
+	t := p.tuner
+	acquires := p.acquireCount - t.acquires
+	waited := p.waitDuration - t.waitDuration
+	holds := p.holdCount - t.holds
+	held := p.holdDuration - t.holdDuration
+	t.acquires, t.waitDuration = p.acquireCount, p.waitDuration
+	t.holds, t.holdDuration = p.holdCount, p.holdDuration
+	peak := p.peakInUse
+	p.peakInUse = len(p.conns) - len(p.idle)
+	waiting := p.waiters.len()
+	if acquires == 0 && waiting == 0 {
+		p.mu.Unlock()
+		return // Nothing to learn from an idle window
+	}
+
+	var avgWait, avgHold time.Duration
+	if acquires > 0 {
+		avgWait = waited / time.Duration(acquires)
+	}
+	if holds > 0 {
+		avgHold = held / time.Duration(holds)
+	}
+	slowDB := t.baselineHold > 0 && avgHold > autoTuneMinHold &&
+		float64(avgHold) > autoTuneSlowdown*float64(t.baselineHold)
+	if holds > 0 {
+		// After a slowdown, cut once and take the new latency as normal
+		// rather than cutting again every window until the average catches up
+		if t.baselineHold == 0 || slowDB {
+			t.baselineHold = avgHold
+		} else {
+			t.baselineHold += time.Duration(autoTuneBaselineWeight * float64(avgHold-t.baselineHold))
+		}
+	}
+
+	size := p.maxConns
+	target, reason := size, ""
+	switch {
+	case slowDB:
+		target, reason = size*3/4, "database slowed down"
+	case avgWait > t.targetWait || waiting > 0:
+		target, reason = size+1, "callers waiting"
+	case peak < size-1:
+		target, reason = size-1, "connections unused"
+	}
+	if target > t.ceiling {
+		target = t.ceiling
+	}
+	if target < p.minConns {
+		target = p.minConns
+	}
+	if target < 1 {
+		target = 1
+	}
+	if target == size {
+		p.mu.Unlock()
+		return
+	}
+	retired := p.setMaxConnsLocked(target)
+	p.mu.Unlock()
+
+	for _, conn := range retired {
+		p.closeConnection(conn)
+	}
+	p.logger.Info("Auto-tuned pool size", "from", size, "to", target, "reason", reason,
+		"avg_wait", avgWait.Round(time.Microsecond), "avg_hold", avgHold.Round(time.Microsecond))
+}
@@ -0,0 +1,44 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// backfillLoop dials the initial connections that failed at startup, retrying
+// with backoff until the pool reaches MinConns or is closed
+func (p *Pool[T]) backfillLoop(b backoff) {
+	defer p.wg.Done()
+
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-time.After(b.delay(attempt)):
+		case <-p.stop:
+			return
+		}
+
+		// On-demand dials may already have filled the gap
+		p.mu.Lock()
+		if p.unavailable() != nil {
+			p.mu.Unlock()
+			continue // Paused; Resume refills the pool
+		}
+		if p.numOpen >= p.minConns {
+			p.degraded = false
+			p.mu.Unlock()
+			p.logger.Info("Pool backfilled to MinConns, no longer degraded")
+			return
+		}
+		p.numOpen++
+		p.mu.Unlock()
+
+		conn, err := p.openConnection(context.Background())
+		if err != nil {
+			p.releaseSlot()
+			p.logger.Warn("Backfill dial failed", "attempt", attempt+1, "error", err)
+			continue
+		}
+		p.putConn(conn)
+		attempt = -1 // Progress; dial the next one without growing the delay
+	}
+}
@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Defaults for backoffs whose delays are not configured
+const (
+	defaultBackoffBase = 100 * time.Millisecond
+	defaultBackoffMax  = 5 * time.Second
+)
+
+// backoff computes exponentially growing retry delays with full jitter, so
+// many instances retrying against the same database spread out their attempts
+type backoff struct {
+	base time.Duration // Delay ceiling for the first retry
+	max  time.Duration // Never wait longer than this
+}
+
+// newBackoff returns a backoff, filling in defaults for zero values
+func newBackoff(base, max time.Duration) backoff {
+	if base <= 0 {
+		base = defaultBackoffBase
+	}
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+	return backoff{base: base, max: max}
+}
+
+// delay returns how long to wait before retry number attempt (starting at 0):
+// a random duration between 0 and min(max, base * 2^attempt)
+func (b backoff) delay(attempt int) time.Duration {
+	ceiling := b.max
+	if attempt < 32 { // Beyond this the shift overflows; we're at max anyway
+		if d := b.base << attempt; d > 0 && d < b.max {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// openConnectionWithRetry is openConnection retried up to retries times with
+// backoff between attempts
+func (p *Pool[T]) openConnectionWithRetry(retries int, b backoff) (T, error) {
+	conn, err := p.openConnection(context.Background())
+	for attempt := 0; err != nil && attempt < retries; attempt++ {
+		wait := b.delay(attempt)
+		p.logger.Warn("Dial failed, retrying", "attempt", attempt+1, "attempts", retries+1, "retry_in", wait.Round(time.Millisecond), "error", err)
+		time.Sleep(wait)
+		conn, err = p.openConnection(context.Background())
+	}
+	return conn, err
+}
@@ -0,0 +1,219 @@
+package pool_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/system-design/week1/pool"
+)
+
+// The benchmarks reproduce cmd/bench's report with go test:
+//
+//	go test -run '^$' -bench . -benchtime 2s ./pool
+//
+// Every side holds benchConns connections to the same SQLite file and runs
+// benchQuery per operation. Each runs at several SetParallelism levels,
+// goroutines per GOMAXPROCS, reporting ops/s besides ns/op, and ns/acquire
+// for the time spent waiting for a connection
+const (
+	benchConns = 8
+	benchQuery = "SELECT 1"
+)
+
+var benchParallelism = []int{1, 8, 32, 128}
+
+// contendedParallelism is BenchmarkContention's goroutines per GOMAXPROCS,
+// far more than benchConns, so every acquire fights over the pool's lock
+const contendedParallelism = 256
+
+// benchAcquirer checks out a connection and returns a function giving it
+// back, like cmd/bench's acquirer
+type benchAcquirer func(ctx context.Context) (benchExecer, func(), error)
+
+// benchExecer is what every side hands out
+type benchExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// benchConfig returns a throwaway SQLite DSN and a config capping each
+// pooled handle at one connection, matching the native side's cap
+func benchConfig(b *testing.B) (string, pool.PoolConfig) {
+	b.Helper()
+	dsn := "file:" + filepath.Join(b.TempDir(), "bench.db") + "?_pragma=busy_timeout(5000)"
+	return dsn, pool.PoolConfig{
+		DriverName: "sqlite",
+		Hooks: pool.Hooks[*sql.DB]{
+			OnCreate: func(ctx context.Context, db *sql.DB) error {
+				db.SetMaxOpenConns(1)
+				return nil
+			},
+		},
+		Settings: pool.Settings{
+			MinConns: benchConns,
+			MaxConns: benchConns,
+			Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		},
+	}
+}
+
+// runBench drives acquire at each parallelism level
+func runBench(b *testing.B, acquire benchAcquirer) {
+	for _, n := range benchParallelism {
+		b.Run(fmt.Sprintf("parallelism=%d", n), func(b *testing.B) {
+			drive(b, n, benchQuery, acquire)
+		})
+	}
+}
+
+// drive runs acquire, query and release from n goroutines per GOMAXPROCS.
+// An empty query leaves only the acquire and release
+func drive(b *testing.B, n int, query string, acquire benchAcquirer) {
+	b.SetParallelism(n)
+	var waited atomic.Int64
+	ctx := context.Background()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			t0 := time.Now()
+			conn, release, err := acquire(ctx)
+			waited.Add(int64(time.Since(t0)))
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			if query != "" {
+				if _, err := conn.ExecContext(ctx, query); err != nil {
+					b.Error(err)
+				}
+			}
+			release()
+		}
+	})
+	b.ReportMetric(float64(waited.Load())/float64(b.N), "ns/acquire")
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+}
+
+// BenchmarkDBConnectionPool measures the mutex-and-waiter-queue pool
+func BenchmarkDBConnectionPool(b *testing.B) {
+	runBench(b, dbPoolAcquirer(b))
+}
+
+// BenchmarkSemaphorePool measures the semaphore over a free list
+func BenchmarkSemaphorePool(b *testing.B) {
+	runBench(b, semaphoreAcquirer(b))
+}
+
+// BenchmarkShardedPool splits the free list over GOMAXPROCS locks
+func BenchmarkShardedPool(b *testing.B) {
+	runBench(b, shardedAcquirer(b, 0))
+}
+
+// BenchmarkShards shows what sharding the free list buys under high
+// contention: one shard is the unsharded semaphore pool's single lock
+func BenchmarkShards(b *testing.B) {
+	for _, shards := range []int{1, 2, 4, benchConns} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			drive(b, contendedParallelism, "", shardedAcquirer(b, shards))
+		})
+	}
+}
+
+// BenchmarkContention pits the pools against each other under high
+// contention, without a statement, so only their own locking is measured
+func BenchmarkContention(b *testing.B) {
+	sides := []struct {
+		name    string
+		acquire func(*testing.B) benchAcquirer
+	}{
+		{"DBConnectionPool", dbPoolAcquirer},
+		{"SemaphorePool", semaphoreAcquirer},
+		{"ShardedPool", func(b *testing.B) benchAcquirer { return shardedAcquirer(b, 0) }},
+	}
+	for _, side := range sides {
+		b.Run(side.name, func(b *testing.B) {
+			drive(b, contendedParallelism, "", side.acquire(b))
+		})
+	}
+}
+
+// dbPoolAcquirer opens a DBConnectionPool for b
+func dbPoolAcquirer(b *testing.B) benchAcquirer {
+	dsn, cfg := benchConfig(b)
+	p, err := pool.NewDBConnectionPoolWithConfig(dsn, cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(p.Close)
+	return func(ctx context.Context) (benchExecer, func(), error) {
+		db, err := p.GetConnectionContext(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, func() { p.PutConnection(db) }, nil
+	}
+}
+
+// semaphoreAcquirer opens a SemaphorePool for b
+func semaphoreAcquirer(b *testing.B) benchAcquirer {
+	dsn, cfg := benchConfig(b)
+	p, err := pool.NewSemaphorePool(dsn, cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(p.Close)
+	return func(ctx context.Context) (benchExecer, func(), error) {
+		db, err := p.GetConnectionContext(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, func() { p.PutConnection(db) }, nil
+	}
+}
+
+// shardedAcquirer opens a ShardedPool of shards shards for b, GOMAXPROCS
+// if not positive
+func shardedAcquirer(b *testing.B, shards int) benchAcquirer {
+	dsn, cfg := benchConfig(b)
+	p, err := pool.NewShardedPool(dsn, cfg, shards)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(p.Close)
+	return func(ctx context.Context) (benchExecer, func(), error) {
+		db, err := p.GetConnectionContext(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, func() { p.PutConnection(db) }, nil
+	}
+}
+
+// BenchmarkNativeDB measures database/sql's own pool, a single *sql.DB
+// with as many connections, checked out with Conn
+func BenchmarkNativeDB(b *testing.B) {
+	dsn, _ := benchConfig(b)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(benchConns)
+	db.SetMaxIdleConns(benchConns)
+	if err := db.Ping(); err != nil {
+		b.Fatal(err)
+	}
+	runBench(b, func(ctx context.Context) (benchExecer, func(), error) {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, func() { conn.Close() }, nil
+	})
+}
@@ -0,0 +1,132 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by acquisitions while the circuit breaker is
+// open because the server has been failing
+var ErrCircuitOpen = errors.New("circuit breaker is open: server is failing")
+
+// defaultCircuitBreakerCooldown is how long an open circuit fails fast
+// before probing the server, unless configured
+const defaultCircuitBreakerCooldown = 5 * time.Second
+
+// circuitBreaker tracks consecutive failures talking to the server. Once
+// threshold is reached the circuit opens and acquisitions fail fast; after
+// each cooldown one acquisition probes the server with a fresh connection,
+// and the circuit closes again once a probe succeeds
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    Logger
+
+	mu       sync.Mutex
+	failures int // Consecutive failures while closed
+	open     bool
+	openedAt time.Time // When the circuit opened or last failed a probe
+	probing  bool      // A probe is in flight; others keep failing fast
+}
+
+// newCircuitBreaker returns a breaker, or nil if threshold disables it
+func newCircuitBreaker(threshold int, cooldown time.Duration, logger Logger) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	if cooldown <= 0 {
+		cooldown = defaultCircuitBreakerCooldown
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, logger: logger}
+}
+
+// record counts the outcome of talking to the server, opening the circuit
+// after threshold failures in a row
+func (b *circuitBreaker) record(err error) {
+	if errors.Is(err, context.Canceled) {
+		return // The caller gave up; says nothing about the server
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if !b.open && b.failures >= b.threshold {
+		b.open = true
+		b.openedAt = time.Now()
+		b.logger.Error("Circuit breaker opened", "consecutive_failures", b.failures, "error", err)
+	}
+}
+
+// isOpen reports whether acquisitions are currently failing fast
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// allow returns nil if an acquisition may proceed. While the circuit is open
+// it fails fast, except that once per cooldown it runs probe and closes the
+// circuit if the probe succeeds
+func (b *circuitBreaker) allow(probe func() error) error {
+	b.mu.Lock()
+	if !b.open {
+		b.mu.Unlock()
+		return nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		b.mu.Unlock()
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	b.mu.Unlock()
+
+	err := probe()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err != nil {
+		b.openedAt = time.Now()
+		b.logger.Warn("Circuit breaker probe failed, staying open", "error", err)
+		return ErrCircuitOpen
+	}
+	b.open = false
+	b.failures = 0
+	b.logger.Info("Circuit breaker probe succeeded, circuit closed")
+	return nil
+}
+
+// allowAcquire checks the circuit breaker, if enabled, before an acquisition
+func (p *Pool[T]) allowAcquire(ctx context.Context) error {
+	if p.breaker == nil {
+		return nil
+	}
+	return p.breaker.allow(func() error { return p.probe(ctx) })
+}
+
+// probe dials a throwaway connection outside the pool's limits to check
+// whether the server is back
+func (p *Pool[T]) probe(ctx context.Context) error {
+	conn, err := p.factory(ctx)
+	if err != nil {
+		return err
+	}
+	err = p.validate(ctx, conn)
+	p.closeFn(conn)
+	return err
+}
+
+// ReportResult feeds the outcome of a statement run on a pooled connection
+// to the circuit breaker, so failing queries open it just like failing
+// dials do. It is a no-op when the breaker is disabled
+func (p *Pool[T]) ReportResult(err error) {
+	if p.breaker != nil {
+		p.breaker.record(err)
+	}
+}
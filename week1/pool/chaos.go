@@ -0,0 +1,92 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Chaos injects faults into a DBConnectionPool so tests can exercise
+// retries, health checks and reconnects without a misbehaving database.
+// Faults are drawn from a random source seeded with Seed, so a test making
+// the same calls in the same order sees the same faults. For tests only:
+// never enable it in production
+type Chaos struct {
+	Seed int64
+
+	// KillRate is the fraction of acquisitions whose connection is killed
+	// before it is handed out: from then on every statement and probe on it
+	// fails with driver.ErrBadConn, like a connection the server dropped
+	KillRate float64
+	// LatencyRate is the fraction of acquisitions delayed by Latency
+	LatencyRate float64
+	Latency     time.Duration
+	// ExecErrorRate is the fraction of statements run with Exec (including
+	// probes) that fail with a MySQL deadlock error, which is transient,
+	// without reaching the database
+	ExecErrorRate float64
+}
+
+// errChaosDeadlock is the transient error ExecErrorRate injects
+var errChaosDeadlock = &mysql.MySQLError{
+	Number:  mysqlDeadlock,
+	Message: "Deadlock found when trying to get lock; try restarting transaction (injected by Chaos)",
+}
+
+// chaos is the running form of a Chaos config
+type chaos struct {
+	Chaos
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newChaos(cfg Chaos) *chaos {
+	return &chaos{Chaos: cfg, rng: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// roll reports whether a fault with the given rate happens this time
+func (c *chaos) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rng.Float64() < rate
+}
+
+// execFault returns the error to fail an Exec with, or nil
+func (c *chaos) execFault() error {
+	if c == nil || !c.roll(c.ExecErrorRate) {
+		return nil
+	}
+	return errChaosDeadlock
+}
+
+// middleware delays and kills acquisitions; activity finds the connection
+// state to kill
+func (c *chaos) middleware(activity *activitySet, logger Logger) Middleware[*sql.DB] {
+	return Middleware[*sql.DB]{
+		Acquire: func(next AcquireFunc[*sql.DB]) AcquireFunc[*sql.DB] {
+			return func(ctx context.Context) (*sql.DB, error) {
+				if c.roll(c.LatencyRate) {
+					select {
+					case <-time.After(c.Latency):
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+				}
+				db, err := next(ctx)
+				if err == nil && c.roll(c.KillRate) {
+					logger.Debug("Chaos: killed connection")
+					activity.kill(db)
+				}
+				return db, err
+			}
+		},
+	}
+}
@@ -0,0 +1,188 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DBConfig is a database connection pool configuration loaded from a file or
+// the environment, so credentials and sizing live outside the code
+type DBConfig struct {
+	DSN string
+	PoolConfig
+}
+
+// fileConfig is the on-disk and environment form of a DBConfig. Durations
+// are written like "2s" or "10m"
+type fileConfig struct {
+	Driver                      string        `yaml:"driver"`
+	DSN                         string        `yaml:"dsn"`
+	MinConns                    int           `yaml:"min_conns"`
+	MaxConns                    int           `yaml:"max_conns"`
+	AcquireTimeout              time.Duration `yaml:"acquire_timeout"`
+	MaxWaiters                  int           `yaml:"max_waiters"`
+	Overflow                    int           `yaml:"overflow"`
+	ValidateOnCheckout          bool          `yaml:"validate_on_checkout"`
+	ValidationQuery             string        `yaml:"validation_query"`
+	ValidationTimeout           time.Duration `yaml:"validation_timeout"`
+	InitRetries                 int           `yaml:"init_retries"`
+	HealthCheckInterval         time.Duration `yaml:"health_check_interval"`
+	HealthCheckFailureThreshold int           `yaml:"health_check_failure_threshold"`
+	MaxConnLifetime             time.Duration `yaml:"max_conn_lifetime"`
+	MaxConnUses                 int           `yaml:"max_conn_uses"`
+	MaxIdleTime                 time.Duration `yaml:"max_idle_time"`
+	KeepaliveInterval           time.Duration `yaml:"keepalive_interval"`
+	QuarantineInterval          time.Duration `yaml:"quarantine_interval"`
+	QuarantineMaxInterval       time.Duration `yaml:"quarantine_max_interval"`
+	ReconnectBackoff            time.Duration `yaml:"reconnect_backoff"`
+	ReconnectMaxBackoff         time.Duration `yaml:"reconnect_max_backoff"`
+	LeaseDuration               time.Duration `yaml:"lease_duration"`
+	LongHoldThreshold           time.Duration `yaml:"long_hold_threshold"`
+	SlowQueryThreshold          time.Duration `yaml:"slow_query_threshold"`
+	StatementTimeout            time.Duration `yaml:"statement_timeout"`
+	ReadOnly                    bool          `yaml:"read_only"`
+	AutoTuneInterval            time.Duration `yaml:"auto_tune_interval"`
+}
+
+// ConfigFromYAML loads a pool configuration from a YAML file, e.g.
+//
+//	driver: mysql
+//	dsn: user:password@tcp(localhost:3306)/online_status_db
+//	min_conns: 2
+//	max_conns: 10
+//	acquire_timeout: 2s
+//	health_check_interval: 30s
+func ConfigFromYAML(path string) (DBConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DBConfig{}, err
+	}
+	var fc fileConfig
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return DBConfig{}, fmt.Errorf("invalid pool config %s: %v", path, err)
+	}
+	return fc.dbConfig(), nil
+}
+
+// ConfigFromEnv loads a pool configuration from environment variables:
+// DB_DRIVER and DB_DSN, plus DB_POOL_MIN_CONNS, DB_POOL_MAX_CONNS,
+// DB_POOL_ACQUIRE_TIMEOUT, DB_POOL_MAX_WAITERS, DB_POOL_OVERFLOW,
+// DB_POOL_VALIDATE_ON_CHECKOUT, DB_POOL_VALIDATION_QUERY,
+// DB_POOL_VALIDATION_TIMEOUT, DB_POOL_INIT_RETRIES,
+// DB_POOL_HEALTH_CHECK_INTERVAL, DB_POOL_HEALTH_CHECK_FAILURE_THRESHOLD,
+// DB_POOL_MAX_CONN_LIFETIME, DB_POOL_MAX_CONN_USES, DB_POOL_MAX_IDLE_TIME,
+// DB_POOL_KEEPALIVE_INTERVAL, DB_POOL_QUARANTINE_INTERVAL,
+// DB_POOL_QUARANTINE_MAX_INTERVAL, DB_POOL_RECONNECT_BACKOFF,
+// DB_POOL_RECONNECT_MAX_BACKOFF, DB_POOL_LEASE_DURATION,
+// DB_POOL_LONG_HOLD_THRESHOLD, DB_POOL_SLOW_QUERY_THRESHOLD,
+// DB_POOL_STATEMENT_TIMEOUT, DB_POOL_READ_ONLY and DB_POOL_AUTO_TUNE_INTERVAL.
+// Unset variables keep the pool's defaults
+func ConfigFromEnv() (DBConfig, error) {
+	fc := fileConfig{
+		Driver: os.Getenv("DB_DRIVER"),
+		DSN:    os.Getenv("DB_DSN"),
+	}
+	var errs []error
+	envInt := func(name string, dst *int) {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+			*dst = n
+		}
+	}
+	envDuration := func(name string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+			*dst = d
+		}
+	}
+	envBool := func(name string, dst *bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+			*dst = b
+		}
+	}
+	envInt("DB_POOL_MIN_CONNS", &fc.MinConns)
+	envInt("DB_POOL_MAX_CONNS", &fc.MaxConns)
+	envDuration("DB_POOL_ACQUIRE_TIMEOUT", &fc.AcquireTimeout)
+	envInt("DB_POOL_MAX_WAITERS", &fc.MaxWaiters)
+	envInt("DB_POOL_OVERFLOW", &fc.Overflow)
+	envBool("DB_POOL_VALIDATE_ON_CHECKOUT", &fc.ValidateOnCheckout)
+	fc.ValidationQuery = os.Getenv("DB_POOL_VALIDATION_QUERY")
+	envDuration("DB_POOL_VALIDATION_TIMEOUT", &fc.ValidationTimeout)
+	envInt("DB_POOL_INIT_RETRIES", &fc.InitRetries)
+	envDuration("DB_POOL_HEALTH_CHECK_INTERVAL", &fc.HealthCheckInterval)
+	envInt("DB_POOL_HEALTH_CHECK_FAILURE_THRESHOLD", &fc.HealthCheckFailureThreshold)
+	envDuration("DB_POOL_MAX_CONN_LIFETIME", &fc.MaxConnLifetime)
+	envInt("DB_POOL_MAX_CONN_USES", &fc.MaxConnUses)
+	envDuration("DB_POOL_MAX_IDLE_TIME", &fc.MaxIdleTime)
+	envDuration("DB_POOL_KEEPALIVE_INTERVAL", &fc.KeepaliveInterval)
+	envDuration("DB_POOL_QUARANTINE_INTERVAL", &fc.QuarantineInterval)
+	envDuration("DB_POOL_QUARANTINE_MAX_INTERVAL", &fc.QuarantineMaxInterval)
+	envDuration("DB_POOL_RECONNECT_BACKOFF", &fc.ReconnectBackoff)
+	envDuration("DB_POOL_RECONNECT_MAX_BACKOFF", &fc.ReconnectMaxBackoff)
+	envDuration("DB_POOL_LEASE_DURATION", &fc.LeaseDuration)
+	envDuration("DB_POOL_LONG_HOLD_THRESHOLD", &fc.LongHoldThreshold)
+	envDuration("DB_POOL_SLOW_QUERY_THRESHOLD", &fc.SlowQueryThreshold)
+	envDuration("DB_POOL_STATEMENT_TIMEOUT", &fc.StatementTimeout)
+	envBool("DB_POOL_READ_ONLY", &fc.ReadOnly)
+	envDuration("DB_POOL_AUTO_TUNE_INTERVAL", &fc.AutoTuneInterval)
+	if len(errs) > 0 {
+		return DBConfig{}, fmt.Errorf("invalid pool environment: %v", errors.Join(errs...))
+	}
+	return fc.dbConfig(), nil
+}
+
+// dbConfig converts a loaded configuration into a DBConfig. Without sizes it
+// is a fixed pool of 10 connections, like NewDBConnectionPool
+func (fc fileConfig) dbConfig() DBConfig {
+	if fc.MaxConns == 0 && fc.MinConns == 0 {
+		fc.MinConns, fc.MaxConns = defaultPoolSize, defaultPoolSize
+	}
+	return DBConfig{
+		DSN: fc.DSN,
+		PoolConfig: PoolConfig{
+			DriverName:         fc.Driver,
+			ValidationQuery:    fc.ValidationQuery,
+			ValidationTimeout:  fc.ValidationTimeout,
+			SlowQueryThreshold: fc.SlowQueryThreshold,
+			StatementTimeout:   fc.StatementTimeout,
+			ReadOnly:           fc.ReadOnly,
+			Settings: Settings{
+				MinConns:                    fc.MinConns,
+				MaxConns:                    fc.MaxConns,
+				AcquireTimeout:              fc.AcquireTimeout,
+				MaxWaiters:                  fc.MaxWaiters,
+				Overflow:                    fc.Overflow,
+				ValidateOnCheckout:          fc.ValidateOnCheckout,
+				InitRetries:                 fc.InitRetries,
+				HealthCheckInterval:         fc.HealthCheckInterval,
+				HealthCheckFailureThreshold: fc.HealthCheckFailureThreshold,
+				MaxConnLifetime:             fc.MaxConnLifetime,
+				MaxConnUses:                 fc.MaxConnUses,
+				MaxIdleTime:                 fc.MaxIdleTime,
+				KeepaliveInterval:           fc.KeepaliveInterval,
+				QuarantineInterval:          fc.QuarantineInterval,
+				QuarantineMaxInterval:       fc.QuarantineMaxInterval,
+				ReconnectBackoff:            fc.ReconnectBackoff,
+				ReconnectMaxBackoff:         fc.ReconnectMaxBackoff,
+				LeaseDuration:               fc.LeaseDuration,
+				LongHoldThreshold:           fc.LongHoldThreshold,
+				AutoTuneInterval:            fc.AutoTuneInterval,
+			},
+		},
+	}
+}
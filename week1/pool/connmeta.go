@@ -0,0 +1,84 @@
+package pool
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// holderKey is the context key WithHolder stores a holder label under
+type holderKey struct{}
+
+// WithHolder labels the connections acquired with ctx, e.g. with a request
+// ID or job name, so Connections and the admin endpoint can say who holds
+// each one
+func WithHolder(ctx context.Context, holder string) context.Context {
+	return context.WithValue(ctx, holderKey{}, holder)
+}
+
+// holderFrom returns the holder label set on ctx by WithHolder, if any
+func holderFrom(ctx context.Context) string {
+	holder, _ := ctx.Value(holderKey{}).(string)
+	return holder
+}
+
+// ConnMeta describes one connection the pool holds
+type ConnMeta struct {
+	ID        int64         `json:"id"`
+	State     string        `json:"state"`
+	CreatedAt time.Time     `json:"created_at"`
+	LastUsed  time.Time     `json:"last_used"` // Last returned to the pool
+	Uses      int64         `json:"uses"`      // Checkouts served so far
+	Holder    string        `json:"holder,omitempty"`
+	HeldFor   time.Duration `json:"held_for_ns,omitempty"` // Only while checked out
+	// Activity counts the statements the connection has run, for pools
+	// that track it (DBConnectionPool)
+	Activity *ConnActivity `json:"activity,omitempty"`
+}
+
+// Connections describes every connection the pool holds, oldest first
+func (p *Pool[T]) Connections() []ConnMeta {
+	p.mu.Lock()
+	now := time.Now()
+	conns := make([]ConnMeta, 0, len(p.conns))
+	for conn, info := range p.conns {
+		meta := ConnMeta{
+			ID:        info.id,
+			State:     info.state.String(),
+			CreatedAt: info.createdAt,
+			LastUsed:  info.lastUsed,
+			Uses:      info.uses,
+			Holder:    info.holder,
+		}
+		if info.state == connInUse {
+			meta.HeldFor = now.Sub(info.acquiredAt)
+		}
+		if p.connMeta != nil {
+			p.connMeta(conn, &meta)
+		}
+		conns = append(conns, meta)
+	}
+	p.mu.Unlock()
+
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+	return conns
+}
+
+// String returns the state's name, as shown by Connections
+func (s connState) String() string {
+	switch s {
+	case connIdle:
+		return "idle"
+	case connInUse:
+		return "in_use"
+	case connChecking:
+		return "checking"
+	case connReturning:
+		return "returning"
+	case connForceClosed:
+		return "force_closed"
+	case connQuarantined:
+		return "quarantined"
+	}
+	return "unknown"
+}
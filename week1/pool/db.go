@@ -0,0 +1,393 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// PoolConfig holds the settings used to build a DBConnectionPool
+type PoolConfig struct {
+	// DriverName is the database/sql driver used to open connections
+	// (default "mysql"). The driver package must be imported by the program
+	DriverName string
+
+	// Validate is the probe used by ValidateOnCheckout and the health checker
+	// (default: run ValidationQuery)
+	Validate func(ctx context.Context, db *sql.DB) error
+	// ValidationQuery is the statement the default probe runs (default
+	// "SELECT 1"). A real round trip catches a dead backend behind a proxy
+	// that answers pings itself; a stored procedure call can check more
+	ValidationQuery string
+	// ValidationTimeout bounds each probe, including a custom Validate
+	// (0 = only the caller's deadline applies)
+	ValidationTimeout time.Duration
+
+	// Hooks run application code at connection lifecycle points, e.g.
+	// setting session variables when a connection is created
+	Hooks Hooks[*sql.DB]
+	// SessionHooks are Hooks for NewSessionPool, whose connections are
+	// dedicated *sql.Conn sessions, e.g. an OnCreate setting time_zone once
+	// per session
+	SessionHooks Hooks[*sql.Conn]
+
+	// StatementCacheSize is how many prepared statements Stmt keeps per
+	// connection before evicting the least recently used (default 32)
+	StatementCacheSize int
+
+	// ExecRetries is how many times Exec and Query retry a statement that
+	// failed with a transient error, such as a deadlock (0 = no retries)
+	ExecRetries int
+	// ExecRetryBackoff is the delay ceiling before the first retry; it
+	// doubles on each further retry, up to 1s (default 10ms)
+	ExecRetryBackoff time.Duration
+	// RetryBudgetRatio caps retries at this fraction of calls, plus a small
+	// reserve, so retries can't multiply the load on a struggling database
+	// (default 0.1)
+	RetryBudgetRatio float64
+
+	// RetryOnServerGone retries an Exec or Query once, on a freshly dialed
+	// connection, when its connection turns out to be dead (MySQL errors
+	// 2006/2013 or a dropped connection). Dead connections are discarded
+	// either way. Leave it off for statements that must not run twice
+	RetryOnServerGone bool
+
+	// StatementTimeout makes the server abort statements running longer than
+	// this, on every session the pool opens, so runaway queries can't tie up
+	// the pool's few connections (0 = no limit). Postgres applies it to all
+	// statements (statement_timeout); MySQL only to SELECTs
+	// (max_execution_time). Other drivers ignore it
+	StatementTimeout time.Duration
+
+	// ReadOnly makes every session the pool opens read-only on the server
+	// (MySQL SESSION TRANSACTION READ ONLY, Postgres
+	// default_transaction_read_only), makes Exec and ExecWithDeadline reject
+	// statements that write with ErrReadOnly, and WithTx start read-only
+	// transactions. Meant for pools of replicas
+	ReadOnly bool
+
+	// SlowQueryThreshold logs statements run through Exec, Query,
+	// ExecWithDeadline and PooledConn that take at least this long, with a
+	// normalized form of the query and the connection that ran it
+	// (0 = no slow query log)
+	SlowQueryThreshold time.Duration
+
+	// HostRetryInterval is how long a host of a multi-host pool is skipped
+	// after a failed dial or probe before it is tried again (default 5s)
+	HostRetryInterval time.Duration
+	// TopologyInterval makes multi-host and failover pools on a MySQL Group
+	// Replication cluster read performance_schema.replication_group_members
+	// this often, to find the current primary and secondaries and move
+	// connections when they change (0 = not watched). Hosts are matched by
+	// the address members report, so DSNs should use the same names
+	TopologyInterval time.Duration
+
+	// Chaos injects faults into the pool's connections, for tests only
+	// (nil = none)
+	Chaos *Chaos
+
+	Settings
+}
+
+// defaultValidationQuery is the probe run on connections unless PoolConfig
+// says otherwise
+const defaultValidationQuery = "SELECT 1"
+
+// DBConnectionPool is a Pool of database/sql handles, one per pooled
+// connection, keeping the original *sql.DB based API
+type DBConnectionPool struct {
+	*Pool[*sql.DB]
+
+	stmts *stmtCache
+
+	execRetries     int
+	execBackoff     backoff
+	budget          *retryBudget
+	retryServerGone bool
+
+	slowQueryThreshold time.Duration
+	readOnly           bool
+
+	shadows *shadowSlot
+
+	session sessionSettings // What sessions start with, unless target says otherwise
+	target  redialer        // nil for connector pools, which Reload can't redial
+}
+
+// NewDBConnectionPool creates a new connection pool configured by options.
+// Without any, it keeps a fixed 10 connections open
+func NewDBConnectionPool(dsn string, opts ...Option) (*DBConnectionPool, error) {
+	cfg := PoolConfig{Settings: Settings{MinConns: defaultPoolSize, MaxConns: defaultPoolSize}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return NewDBConnectionPoolWithConfig(dsn, cfg)
+}
+
+// NewDBConnectionPoolWithConfig creates a new connection pool from a PoolConfig
+func NewDBConnectionPoolWithConfig(dsn string, cfg PoolConfig) (*DBConnectionPool, error) {
+	driverName := cfg.DriverName
+	if driverName == "" {
+		driverName = "mysql"
+	}
+	if driverName == "mysql" {
+		if err := validateMySQLDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+	dialer := &dsnDialer{driverName: driverName}
+	dialer.target.Store(&dsnTarget{dsn: dsn, session: sessionSettingsOf(cfg)})
+	return newDialerPool(dialer, cfg)
+}
+
+// newDialerPool builds a DBConnectionPool dialing through dialer, which
+// Reload can point elsewhere
+func newDialerPool(dialer *dsnDialer, cfg PoolConfig) (*DBConnectionPool, error) {
+	p, err := newDBConnectionPool(dialer.dial, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.target = dialer
+	return p, nil
+}
+
+// NewDBConnectionPoolFromConnector creates a new connection pool that dials
+// through a driver.Connector (e.g. from mysql.NewConnector) instead of a DSN
+// string. The connector is asked for a fresh connection on every dial, so it
+// can use a custom dialer or rotate credentials. cfg.DriverName is ignored
+func NewDBConnectionPoolFromConnector(connector driver.Connector, cfg PoolConfig) (*DBConnectionPool, error) {
+	return newDBConnectionPool(func(ctx context.Context) (*sql.DB, error) {
+		return pingNew(ctx, sql.OpenDB(instrument(sessionSettingsOf(cfg).wrap(connector), connCountersFrom(ctx))))
+	}, cfg, nil)
+}
+
+// openDB opens a database handle and checks that it is reachable. Each of
+// its sessions gets session applied, and counts its statements if the pool
+// dialing it asked for that through ctx
+func openDB(ctx context.Context, driverName, dsn string, session sessionSettings) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	counters := connCountersFrom(ctx)
+	if counters != nil || len(session.statements(db.Driver())) > 0 {
+		connector, err := dsnConnector(db.Driver(), dsn)
+		db.Close()
+		if err != nil {
+			return nil, err
+		}
+		db = sql.OpenDB(instrument(session.wrap(connector), counters))
+	}
+	return pingNew(ctx, db)
+}
+
+// pingNew pings a freshly opened handle, closing it if the database can't be
+// reached
+func pingNew(ctx context.Context, db *sql.DB) (*sql.DB, error) {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// newDBConnectionPool builds a DBConnectionPool whose connections are dialed
+// by factory. For multi-host pools, hosts tracks which host each connection
+// is on and how healthy each host is
+func newDBConnectionPool(factory func(ctx context.Context) (*sql.DB, error), cfg PoolConfig, hosts *hostSet) (*DBConnectionPool, error) {
+	validate := cfg.Validate
+	if validate == nil {
+		query := cfg.ValidationQuery
+		if query == "" {
+			query = defaultValidationQuery
+		}
+		validate = func(ctx context.Context, db *sql.DB) error {
+			_, err := db.ExecContext(ctx, query)
+			return err
+		}
+	}
+	if timeout := cfg.ValidationTimeout; timeout > 0 {
+		probe := validate
+		validate = func(ctx context.Context, db *sql.DB) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return probe(ctx, db)
+		}
+	}
+	stmts := newStmtCache(cfg.StatementCacheSize)
+	shadows := &shadowSlot{}
+	budget := newRetryBudget(cfg.RetryBudgetRatio)
+	execBackoff := cfg.ExecRetryBackoff
+	if execBackoff <= 0 {
+		execBackoff = defaultExecRetryBackoff
+	}
+	var faults *chaos
+	if cfg.Chaos != nil {
+		faults = newChaos(*cfg.Chaos)
+	}
+	activity := newActivitySet(faults)
+	closeDB := func(db *sql.DB) error {
+		stmts.forget(db)
+		activity.forget(db)
+		return db.Close()
+	}
+	if hosts != nil {
+		validate, closeDB = hosts.track(validate, closeDB)
+	}
+	settings := cfg.Settings
+	if settings.MetricsNamespace == "" {
+		settings.MetricsNamespace = "dbpool"
+	}
+
+	poolCfg := Config[*sql.DB]{
+		Factory:  activity.instrument(factory),
+		Validate: validate,
+		Close:    closeDB,
+		Hooks:    cfg.Hooks,
+		Broken:   isServerGone,
+		Settings: settings,
+	}
+	poolCfg.extraStats = func(stats *PoolStats) {
+		stmts.fillStats(stats)
+		budget.fillStats(stats)
+		shadows.fillStats(stats)
+		activity.fillStats(stats)
+		if hosts != nil {
+			stats.Hosts = hosts.stats()
+		}
+	}
+	poolCfg.connMeta = func(db *sql.DB, meta *ConnMeta) {
+		meta.Activity = activity.of(db)
+	}
+	watched := hosts != nil && (hosts.ordered || hosts.topologyInterval > 0)
+	if watched {
+		poolCfg.stale = hosts.stale
+	}
+	pool, err := New(poolCfg)
+	if err != nil {
+		return nil, err
+	}
+	if watched {
+		hosts.watch(pool)
+	}
+	if faults != nil {
+		pool.Use(faults.middleware(activity, pool.logger))
+	}
+	p := &DBConnectionPool{
+		Pool:            pool,
+		stmts:           stmts,
+		execRetries:     cfg.ExecRetries,
+		execBackoff:     newBackoff(execBackoff, maxExecRetryBackoff),
+		budget:          budget,
+		retryServerGone: cfg.RetryOnServerGone,
+
+		slowQueryThreshold: cfg.SlowQueryThreshold,
+		readOnly:           cfg.ReadOnly,
+
+		shadows: shadows,
+		session: sessionSettingsOf(cfg),
+	}
+	if hosts != nil {
+		p.target = hosts
+	}
+	return p, nil
+}
+
+// sessionDefaults returns the settings the pool's sessions are opened with
+func (p *DBConnectionPool) sessionDefaults() sessionSettings {
+	if p.target != nil {
+		return p.target.sessionDefaults()
+	}
+	return p.session
+}
+
+// GetConnection retrieves a connection from the pool (blocks if none available).
+// If the pool has an AcquireTimeout, it returns ErrAcquireTimeout once it expires
+func (p *DBConnectionPool) GetConnection() (*sql.DB, error) {
+	return p.Get(context.Background())
+}
+
+// GetConnectionContext retrieves a connection from the pool, blocking until one
+// is available, the context is cancelled, or the pool's AcquireTimeout expires
+func (p *DBConnectionPool) GetConnectionContext(ctx context.Context) (*sql.DB, error) {
+	return p.Get(ctx)
+}
+
+// GetConnectionWithPriority is GetConnectionContext for callers that should
+// jump ahead of (or yield to) others when the pool is saturated
+func (p *DBConnectionPool) GetConnectionWithPriority(ctx context.Context, priority Priority) (*sql.DB, error) {
+	return p.GetWithPriority(ctx, priority)
+}
+
+// TryGetConnection retrieves a connection from the pool without waiting. The
+// second return value is false if every connection is in use
+func (p *DBConnectionPool) TryGetConnection() (*sql.DB, bool) {
+	return p.TryGet()
+}
+
+// PutConnection returns a connection back to the pool
+func (p *DBConnectionPool) PutConnection(conn *sql.DB) error {
+	return p.Put(conn)
+}
+
+// GetConnectionWithToken is GetConnectionContext that also returns a token
+// proving ownership of the checkout; see GetWithToken
+func (p *DBConnectionPool) GetConnectionWithToken(ctx context.Context) (*sql.DB, Token, error) {
+	return p.GetWithToken(ctx)
+}
+
+// PutConnectionWithToken returns a connection acquired with
+// GetConnectionWithToken, rejecting the return if token is stale
+func (p *DBConnectionPool) PutConnectionWithToken(conn *sql.DB, token Token) error {
+	return p.PutWithToken(conn, token)
+}
+
+// WithConnection acquires a connection, runs fn with it, and returns the
+// connection to the pool afterwards - even if fn panics
+func (p *DBConnectionPool) WithConnection(ctx context.Context, fn func(db *sql.DB) error) error {
+	return p.With(ctx, fn)
+}
+
+// WithTx acquires a connection, runs fn inside a transaction on it, and
+// returns the connection to the pool afterwards. The transaction is committed
+// if fn returns nil and rolled back if fn returns an error or panics. On a
+// ReadOnly pool, the transaction is always read-only
+func (p *DBConnectionPool) WithTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	if p.readOnly {
+		readOnly := sql.TxOptions{ReadOnly: true}
+		if opts != nil {
+			readOnly.Isolation = opts.Isolation
+		}
+		opts = &readOnly
+	}
+	return p.WithConnection(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %v", err)
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+				panic(r)
+			}
+		}()
+
+		if err := fn(tx); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				return fmt.Errorf("%w (rollback also failed: %v)", err, rbErr)
+			}
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// GetConnectionFor retrieves a connection, preferring the one key (e.g. a
+// user ID) consistently maps to; see GetFor. Each *sql.DB can hold several
+// server sessions, so session state only reliably stays put if OnCreate
+// limits the handle to one with SetMaxOpenConns(1)
+func (p *DBConnectionPool) GetConnectionFor(ctx context.Context, key string) (*sql.DB, error) {
+	return p.GetFor(ctx, key)
+}
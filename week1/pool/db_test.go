@@ -0,0 +1,91 @@
+package pool_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/system-design/week1/pool"
+)
+
+// newSQLitePool opens a fixed pool of size connections to a fresh SQLite
+// database holding the user_status table, in-process, with no build tag
+func newSQLitePool(t testing.TB, size int) *pool.DBConnectionPool {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "presence.db") + "?_pragma=busy_timeout(5000)"
+	p, err := pool.NewDBConnectionPoolWithConfig(dsn, pool.PoolConfig{
+		DriverName: "sqlite",
+		Settings:   pool.Settings{MinConns: size, MaxConns: size},
+	})
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(p.Close)
+	conn, err := p.GetConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.PutConnection(conn)
+	if _, err := conn.Exec(`CREATE TABLE user_status (
+		user_id   VARCHAR(64) PRIMARY KEY,
+		last_seen BIGINT      NOT NULL,
+		status    VARCHAR(8)  NOT NULL DEFAULT 'online'
+	)`); err != nil {
+		t.Fatalf("failed to create user_status: %v", err)
+	}
+	return p
+}
+
+func TestSQLiteGetPutClose(t *testing.T) {
+	p := newSQLitePool(t, 2)
+	ctx := context.Background()
+
+	conn, err := p.GetConnectionContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := time.Now().Unix()
+	if _, err := conn.ExecContext(ctx, "INSERT INTO user_status (user_id, last_seen) VALUES (?, ?)", "user_1", seen); err != nil {
+		t.Fatalf("heartbeat insert: %v", err)
+	}
+	if err := p.PutConnection(conn); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	// Both connections reach the same database, and the pool has no third
+	a, err := p.GetConnectionContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.GetConnectionContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.TryGetConnection(); ok {
+		t.Error("TryGetConnection succeeded with every connection in use")
+	}
+	for _, c := range []*sql.DB{a, b} {
+		var got int64
+		if err := c.QueryRowContext(ctx, "SELECT last_seen FROM user_status WHERE user_id = ?", "user_1").Scan(&got); err != nil || got != seen {
+			t.Errorf("last_seen = %d, %v; want %d", got, err, seen)
+		}
+	}
+	p.PutConnection(a)
+	p.PutConnection(b)
+	if st := p.Stats(); st.TotalConns != 2 || st.InUseConns != 0 {
+		t.Errorf("pool should be back to 2 idle connections: %+v", st)
+	}
+
+	p.Close()
+	if _, err := p.GetConnectionContext(ctx); !errors.Is(err, pool.ErrPoolClosed) {
+		t.Errorf("Get after Close = %v, want ErrPoolClosed", err)
+	}
+	if st := p.Stats(); st.TotalConns != 0 {
+		t.Errorf("Close left %d connections open", st.TotalConns)
+	}
+}
@@ -0,0 +1,107 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// resetTimeout bounds restoring a session's timeout after ExecWithDeadline,
+// which runs even when the caller's context has already expired
+const resetTimeout = time.Second
+
+// ExecWithDeadline is Exec for statements that must not outlive ctx's
+// deadline on the server either. Cancelling ctx alone only abandons the
+// statement client-side; the server keeps running it, holding locks and the
+// connection. The remaining time is passed to the server:
+//
+//   - Postgres: as statement_timeout
+//   - MySQL SELECTs: as a MAX_EXECUTION_TIME optimizer hint
+//   - other MySQL statements: as innodb_lock_wait_timeout (whole seconds,
+//     rounded up), since MAX_EXECUTION_TIME only applies to SELECTs and
+//     waiting on row locks is what usually makes an UPDATE slow
+//
+// Other drivers, or a ctx without a deadline, get plain Exec behavior
+func (p *DBConnectionPool) ExecWithDeadline(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return p.Exec(ctx, query, args...)
+	}
+	if err := p.checkWritable(query); err != nil {
+		return nil, err
+	}
+
+	var res sql.Result
+	err := p.withRetry(ctx, func(db *sql.DB) error {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return context.DeadlineExceeded
+		}
+
+		// Pin one server session, so the timeout applies to the statement
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		stmt, set, reset := withServerTimeout(db.Driver(), query, remaining, p.sessionDefaults())
+		if set != "" {
+			if _, err := conn.ExecContext(ctx, set); err != nil {
+				return fmt.Errorf("failed to set statement timeout: %v", err)
+			}
+			defer restoreTimeout(conn, reset)
+		}
+		start := time.Now()
+		res, err = conn.ExecContext(ctx, stmt, args...)
+		p.logIfSlow(db, query, start, err)
+		return err
+	})
+	if err == nil {
+		p.mirror(query, args)
+	}
+	return res, err
+}
+
+// withServerTimeout returns query rewritten to carry a server-side timeout
+// of d, or the statements that set and reset a session timeout around it.
+// The reset goes back to what session opened the session with
+func withServerTimeout(drv driver.Driver, query string, d time.Duration, session sessionSettings) (stmt, set, reset string) {
+	switch drv.(type) {
+	case *pq.Driver:
+		reset = "RESET statement_timeout"
+		if session.statementTimeout > 0 {
+			reset = fmt.Sprintf("SET statement_timeout = %d", session.statementTimeout.Milliseconds())
+		}
+		return query, fmt.Sprintf("SET statement_timeout = %d", d.Milliseconds()), reset
+	case *mysql.MySQLDriver:
+		trimmed := strings.TrimSpace(query)
+		if len(trimmed) >= 6 && strings.EqualFold(trimmed[:6], "SELECT") {
+			ms := d.Milliseconds()
+			if ms < 1 {
+				ms = 1
+			}
+			return fmt.Sprintf("SELECT /*+ MAX_EXECUTION_TIME(%d) */%s", ms, trimmed[6:]), "", ""
+		}
+		secs := int64((d + time.Second - 1) / time.Second)
+		return query, fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", secs),
+			"SET SESSION innodb_lock_wait_timeout = DEFAULT"
+	}
+	return query, "", ""
+}
+
+// restoreTimeout resets the session timeout ExecWithDeadline set. If that
+// fails, the session is thrown away rather than reused with a short timeout
+func restoreTimeout(conn *sql.Conn, reset string) {
+	ctx, cancel := context.WithTimeout(context.Background(), resetTimeout)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, reset); err != nil {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+}
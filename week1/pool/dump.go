@@ -0,0 +1,241 @@
+package pool
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recentEvents is how many of the latest events a pool keeps for Dump
+const recentEvents = 64
+
+// eventRing keeps the latest recentEvents events. Requires eventBus.ringMu
+type eventRing struct {
+	events [recentEvents]Event
+	total  int // Events ever recorded; the next goes at total % recentEvents
+}
+
+// add records e, overwriting the oldest event once the ring is full
+func (r *eventRing) add(e Event) {
+	r.events[r.total%recentEvents] = e
+	r.total++
+}
+
+// list returns the recorded events, oldest first
+func (r *eventRing) list() []Event {
+	n := min(r.total, recentEvents)
+	events := make([]Event, 0, n)
+	for i := r.total - n; i < r.total; i++ {
+		events = append(events, r.events[i%recentEvents])
+	}
+	return events
+}
+
+// String returns the state's name, as shown by Dump
+func (s poolState) String() string {
+	switch s {
+	case poolOpen:
+		return "open"
+	case poolPaused:
+		return "paused"
+	case poolDraining:
+		return "draining"
+	case poolClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// dumpConn is a connection as Dump shows it
+type dumpConn struct {
+	ConnMeta
+	idleFor   time.Duration
+	goroutine int64
+	stack     []byte // Where it was acquired (leak detection only)
+}
+
+// dumpWaiter is a blocked caller as Dump shows it
+type dumpWaiter struct {
+	priority  Priority
+	waiting   time.Duration
+	holder    string
+	goroutine int64
+}
+
+// Dump writes a human-readable snapshot of the pool for debugging an
+// incident, the pool's answer to kill -QUIT: its stats, every connection
+// with its state and holder, the callers waiting in the order they will be
+// served, and the last 64 lifecycle events. In Debug mode, where the pool
+// knows which goroutine holds each connection and which is waiting, it
+// includes those goroutines' current stacks; otherwise, with
+// LeakDetectionThreshold set, the stack each connection was acquired from
+func (p *Pool[T]) Dump(w io.Writer) error {
+	stats := p.Stats()
+	now := time.Now()
+
+	p.mu.Lock()
+	state := poolState(p.state.Load())
+	conns := make([]dumpConn, 0, len(p.conns))
+	for conn, info := range p.conns {
+		c := dumpConn{
+			ConnMeta: ConnMeta{
+				ID:        info.id,
+				State:     info.state.String(),
+				CreatedAt: info.createdAt,
+				LastUsed:  info.lastUsed,
+				Uses:      info.uses,
+				Holder:    info.holder,
+			},
+		}
+		if info.state == connInUse {
+			c.HeldFor = now.Sub(info.acquiredAt)
+			c.goroutine = info.goroutine
+			c.stack = info.acquireStack
+		} else {
+			c.idleFor = now.Sub(info.lastUsed)
+		}
+		if p.connMeta != nil {
+			p.connMeta(conn, &c.ConnMeta)
+		}
+		conns = append(conns, c)
+	}
+	order := waiterHeap[T]{lifo: p.waiters.lifo, waiters: append([]*waiter[T](nil), p.waiters.heap.waiters...)}
+	sort.Slice(order.waiters, order.Less)
+	waiters := make([]dumpWaiter, len(order.waiters))
+	for i, wt := range order.waiters {
+		waiters[i] = dumpWaiter{priority: wt.priority, waiting: now.Sub(wt.since), holder: wt.holder, goroutine: wt.goroutine}
+	}
+	p.mu.Unlock()
+
+	p.events.ringMu.Lock()
+	events := p.events.recent.list()
+	p.events.ringMu.Unlock()
+
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+	var stacks map[int64]string
+	if p.debug {
+		stacks = goroutineStacks()
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "pool snapshot at %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(bw, "state: %s", state)
+	if stats.AcquirePaused {
+		fmt.Fprint(bw, ", acquisitions paused")
+	}
+	if stats.CircuitOpen {
+		fmt.Fprint(bw, ", circuit open")
+	}
+	if stats.Degraded {
+		fmt.Fprint(bw, ", degraded")
+	}
+	fmt.Fprintf(bw, "\nconns: %d of max %d (%d idle, %d in use, %d quarantined), %d waiting\n",
+		stats.TotalConns, stats.MaxConns, stats.IdleConns, stats.InUseConns, stats.Quarantined, stats.Waiters)
+	fmt.Fprintf(bw, "totals: %d acquired, %d waited (%s), %d created, %d destroyed, %d leaks, %d shed\n",
+		stats.AcquireCount, stats.WaitCount, stats.WaitDuration, stats.ConnsCreated, stats.ConnsDestroyed,
+		stats.LeaksDetected, stats.WaitersShed)
+
+	fmt.Fprintf(bw, "\nconnections (%d):\n", len(conns))
+	for _, c := range conns {
+		fmt.Fprintf(bw, "  conn %d  %s  age %s  uses %d", c.ID, c.State, dumpDuration(now.Sub(c.CreatedAt)), c.Uses)
+		if c.State == connInUse.String() {
+			fmt.Fprintf(bw, "  held %s", dumpDuration(c.HeldFor))
+			if c.Holder != "" {
+				fmt.Fprintf(bw, "  holder %q", c.Holder)
+			}
+			if c.goroutine != 0 {
+				fmt.Fprintf(bw, "  goroutine %d", c.goroutine)
+			}
+		} else {
+			fmt.Fprintf(bw, "  idle %s", dumpDuration(c.idleFor))
+		}
+		if a := c.Activity; a != nil && a.Queries > 0 {
+			fmt.Fprintf(bw, "  %d statements, %d failed", a.Queries, a.Errors)
+		}
+		fmt.Fprintln(bw)
+		if stack, ok := stacks[c.goroutine]; ok && c.goroutine != 0 {
+			writeIndented(bw, "now at:", stack)
+		} else if len(c.stack) > 0 {
+			writeIndented(bw, "acquired at:", string(c.stack))
+		}
+	}
+
+	fmt.Fprintf(bw, "\nwaiters (%d, in the order they will be served):\n", len(waiters))
+	for i, wt := range waiters {
+		fmt.Fprintf(bw, "  %d. priority %d  waiting %s", i+1, wt.priority, dumpDuration(wt.waiting))
+		if wt.holder != "" {
+			fmt.Fprintf(bw, "  holder %q", wt.holder)
+		}
+		if wt.goroutine != 0 {
+			fmt.Fprintf(bw, "  goroutine %d", wt.goroutine)
+		}
+		fmt.Fprintln(bw)
+		if stack, ok := stacks[wt.goroutine]; ok && wt.goroutine != 0 {
+			writeIndented(bw, "now at:", stack)
+		}
+	}
+
+	fmt.Fprintf(bw, "\nrecent events (%d):\n", len(events))
+	for _, e := range events {
+		fmt.Fprintf(bw, "  %s  %s", e.Time.Format("15:04:05.000"), e.Type)
+		if e.ConnID != 0 {
+			fmt.Fprintf(bw, "  conn %d", e.ConnID)
+		}
+		if e.Waiters != 0 {
+			fmt.Fprintf(bw, "  waiters %d", e.Waiters)
+		}
+		if e.From != "" || e.To != "" {
+			fmt.Fprintf(bw, "  %s -> %s", e.From, e.To)
+		}
+		if e.Err != nil {
+			fmt.Fprintf(bw, "  error: %v", e.Err)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// goroutineStacks returns the stack of every goroutine, by ID
+func goroutineStacks() map[int64]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[int64]string)
+	for _, block := range bytes.Split(buf, []byte("\n\n")) {
+		header, _, _ := strings.Cut(string(block), " [")
+		id, err := strconv.ParseInt(strings.TrimPrefix(header, "goroutine "), 10, 64)
+		if err == nil {
+			stacks[id] = string(block)
+		}
+	}
+	return stacks
+}
+
+// writeIndented writes a labelled stack trace indented under its entry
+func writeIndented(w io.Writer, label, stack string) {
+	fmt.Fprintf(w, "    %s\n", label)
+	for _, line := range strings.Split(strings.TrimRight(stack, "\n"), "\n") {
+		fmt.Fprintf(w, "      %s\n", line)
+	}
+}
+
+// dumpDuration rounds d for display
+func dumpDuration(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
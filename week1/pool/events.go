@@ -0,0 +1,139 @@
+package pool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType is the kind of lifecycle event a pool emits
+type EventType int
+
+const (
+	EventConnCreated       EventType = iota + 1 // A connection was dialed and added to the pool
+	EventConnDestroyed                          // A connection was closed
+	EventAcquireBlocked                         // A caller found no connection free and started waiting
+	EventPoolExhausted                          // A caller gave up: shed by MaxWaiters or timed out
+	EventHealthCheckFailed                      // A health check or keepalive probe failed
+	EventFailover                               // A failover pool switched hosts
+	EventConfigReloaded                         // Reload applied new settings
+	EventTopologyChanged                        // A watched replication group changed members or primary
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnCreated:
+		return "conn_created"
+	case EventConnDestroyed:
+		return "conn_destroyed"
+	case EventAcquireBlocked:
+		return "acquire_blocked"
+	case EventPoolExhausted:
+		return "pool_exhausted"
+	case EventHealthCheckFailed:
+		return "health_check_failed"
+	case EventFailover:
+		return "failover"
+	case EventConfigReloaded:
+		return "config_reloaded"
+	case EventTopologyChanged:
+		return "topology_changed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a pool lifecycle event, for alerting and dashboards built on
+// Subscribe or Events. Fields that don't apply to the Type are zero
+type Event struct {
+	Type EventType
+	Time time.Time
+	// ConnID is the connection the event is about (ConnCreated,
+	// ConnDestroyed, HealthCheckFailed), as in Connections
+	ConnID int64
+	// Waiters is how many callers are waiting, including this one
+	// (AcquireBlocked)
+	Waiters int
+	// Err is ErrPoolExhausted or ErrAcquireTimeout for PoolExhausted, and
+	// the probe's error for HealthCheckFailed
+	Err error
+	// From and To are the hosts switched between (Failover), or the group's
+	// primary before and after the change (TopologyChanged)
+	From, To string
+}
+
+// eventBus fans events out to subscribers. The zero value has none
+type eventBus struct {
+	mu   sync.RWMutex
+	subs map[int]func(Event)
+	next int
+	n    atomic.Int32 // len(subs), so emitting without subscribers is cheap
+
+	ringMu sync.Mutex
+	recent eventRing // Latest events, for Dump
+}
+
+// Subscribe calls fn for every event the pool emits until the returned
+// function is called. fn runs synchronously on the goroutine that triggered
+// the event, outside the pool's lock, so it must be quick and must not
+// unsubscribe itself
+func (p *Pool[T]) Subscribe(fn func(Event)) (unsubscribe func()) {
+	b := &p.events
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[int]func(Event))
+	}
+	id := b.next
+	b.next++
+	b.subs[id] = fn
+	b.n.Add(1)
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.n.Add(-1)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Events returns a channel receiving the pool's events, buffered to hold
+// buffer of them. Events arriving while the buffer is full are dropped
+// rather than blocking the pool. The returned function unsubscribes and
+// closes the channel
+func (p *Pool[T]) Events(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	unsubscribe := p.Subscribe(func(e Event) {
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			unsubscribe() // No send is in flight once this returns
+			close(ch)
+		})
+	}
+}
+
+// emit delivers e to every subscriber. Must not be called with p.mu held
+func (p *Pool[T]) emit(e Event) {
+	b := &p.events
+	e.Time = time.Now()
+	b.ringMu.Lock()
+	b.recent.add(e)
+	b.ringMu.Unlock()
+	if b.n.Load() == 0 {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.subs {
+		fn(e)
+	}
+}
@@ -0,0 +1,14 @@
+package pool
+
+import "expvar"
+
+// expvarName is the expvar variable the registered pools are published under
+const expvarName = "pools"
+
+// Importing the package publishes the Stats of every pool in
+// DefaultRegistry under expvar, so the standard /debug/vars endpoint shows
+// them, keyed by name, in any service that serves it. Pools only show up
+// once registered (see Register)
+func init() {
+	expvar.Publish(expvarName, expvar.Func(func() any { return Stats() }))
+}
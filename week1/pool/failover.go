@@ -0,0 +1,182 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// NewFailoverPool creates a connection pool for a primary database with
+// standbys to fall back on, tried in order. Every connection goes to the
+// first healthy host: once the primary fails a dial or probe, new
+// connections go to the first standby that answers and the pool rebuilds
+// itself there, closing idle connections to the old host and retiring
+// in-use ones as they are returned. Hosts ahead of the active one are probed
+// every HostRetryInterval, so the pool fails back once the primary recovers.
+// Each switch emits EventFailover; Stats.Hosts reports the active host.
+//
+// Dead connections are noticed by probes and failed statements, so pair
+// this with HealthCheckInterval or ValidateOnCheckout to fail over promptly
+// when the pool is quiet.
+//
+// For a MySQL Group Replication cluster, set TopologyInterval instead of
+// relying on the DSN order: the pool then follows whichever member the
+// group reports as its primary, including members not in the list, and
+// never fails over to a read-only secondary
+func NewFailoverPool(primary string, standbys []string, cfg PoolConfig) (*DBConnectionPool, error) {
+	hosts, err := newHostSet(append([]string{primary}, standbys...), cfg)
+	if err != nil {
+		return nil, err
+	}
+	hosts.ordered = true
+	return newDBConnectionPool(hosts.dial, cfg, hosts)
+}
+
+// shouldSwitchLocked reports whether a connection just opened on h means
+// the pool should switch to h: it has none yet, its active host is down, or
+// h is preferred over it. Once a topology is read, it should if h is the
+// group's primary. Requires s.mu
+func (s *hostSet) shouldSwitchLocked(h *host) bool {
+	a := s.active
+	if s.topology {
+		return a != h && h.role == RolePrimary
+	}
+	return a != h && (a == nil || time.Now().Before(a.downUntil) || h.rank < a.rank)
+}
+
+// switchTo makes h the host new connections go to and retires the
+// connections on the previous one
+func (s *hostSet) switchTo(h *host) {
+	s.mu.Lock()
+	from, p := s.active, s.pool
+	if from == h {
+		s.mu.Unlock()
+		return
+	}
+	s.active = h
+	s.mu.Unlock()
+
+	switch {
+	case from == nil:
+		if h.rank > 0 && !s.topology {
+			s.logger.Warn("Primary unreachable, starting on standby", "host", h.name)
+		}
+		return
+	case s.topology:
+		s.logger.Info("Following new group primary", "from", from.name, "to", h.name)
+	case h.rank < from.rank:
+		s.logger.Info("Failed back", "from", from.name, "to", h.name)
+	default:
+		s.logger.Warn("Failed over", "from", from.name, "to", h.name)
+	}
+	if p != nil {
+		p.retireStale()
+		p.emit(Event{Type: EventFailover, From: from.name, To: h.name})
+	}
+}
+
+// stale reports whether db is on a host other than a failover pool's active
+// one, or on one that left the group
+func (s *hostSet) stale(db *sql.DB) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.onHost[db]
+	if !ok {
+		return false
+	}
+	if s.topology && !s.eligibleLocked(h) {
+		return true
+	}
+	return s.ordered && s.active != nil && h != s.active
+}
+
+// watch hands the hostSet the pool it serves and starts watching the
+// group's topology, or for a failover pool without one, probing for
+// fail-back
+func (s *hostSet) watch(p *Pool[*sql.DB]) {
+	s.mu.Lock()
+	s.pool = p
+	s.mu.Unlock()
+	p.wg.Add(1)
+	if s.topologyInterval > 0 {
+		go s.topologyLoop(p)
+	} else {
+		go s.failbackLoop(p)
+	}
+}
+
+// failbackLoop probes the hosts preferred over the active one every
+// retryInterval until the pool is closed
+func (s *hostSet) failbackLoop(p *Pool[*sql.DB]) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(s.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.tryFailback()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// tryFailback switches to the most preferred host ahead of the active one
+// that accepts a connection
+func (s *hostSet) tryFailback() {
+	s.mu.Lock()
+	var preferred []*host
+	if s.active != nil {
+		preferred = s.hosts[:s.active.rank]
+	}
+	s.mu.Unlock()
+
+	for _, h := range preferred {
+		ctx, cancel := context.WithTimeout(context.Background(), s.retryInterval)
+		dsn, session := s.dialTarget(h)
+		db, err := openDB(ctx, s.driverName, dsn, session)
+		cancel()
+		if err != nil {
+			s.mu.Lock()
+			h.lastErr = err
+			s.mu.Unlock()
+			s.logger.Debug("Fail-back probe failed", "host", h.name, "error", err)
+			continue
+		}
+		db.Close()
+
+		s.mu.Lock()
+		h.failures = 0
+		h.downUntil = time.Time{}
+		s.mu.Unlock()
+		s.switchTo(h)
+		return
+	}
+}
+
+// retireStale closes the idle connections stale reports, e.g. after a
+// failover. Their slots are redialed as needed; in-use stale connections
+// are retired when returned
+func (p *Pool[T]) retireStale() {
+	p.mu.Lock()
+	var retired, kept []T
+	for _, conn := range p.idle {
+		if p.stale(conn) {
+			retired = append(retired, conn)
+		} else {
+			kept = append(kept, conn)
+		}
+	}
+	p.idle = kept
+	p.mu.Unlock()
+
+	for _, conn := range retired {
+		p.closeConnection(conn)
+		p.releaseSlot()
+	}
+	if len(retired) > 0 {
+		p.logger.Info("Closed stale idle connections", "count", len(retired))
+	}
+}
@@ -0,0 +1,90 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// healthCheckLoop periodically probes idle connections until the pool is closed
+func (p *Pool[T]) healthCheckLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.checkIdleConnections()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// checkIdleConnections probes each connection currently sitting in the pool.
+// Connections are taken out one at a time, so at most one idle connection is
+// unavailable to callers while the check runs. It also forgets revoked
+// connections past revokedRetention
+func (p *Pool[T]) checkIdleConnections() {
+	p.mu.Lock()
+	p.pruneRevokedLocked(time.Now())
+	idle := len(p.idle)
+	p.mu.Unlock()
+
+	for i := 0; i < idle; i++ {
+		p.mu.Lock()
+		if p.unavailable() != nil || len(p.idle) == 0 {
+			// Callers grabbed the remaining idle connections; they'll be
+			// checked on a later tick
+			p.mu.Unlock()
+			return
+		}
+		conn := p.idle[0]
+		p.idle = p.idle[1:]
+		p.conns[conn].state = connChecking
+		p.mu.Unlock()
+
+		p.checkConnection(conn)
+	}
+}
+
+// checkConnection probes one idle connection and puts it back in the pool,
+// or evicts or quarantines it once it has failed healthCheckThreshold probes
+// in a row
+func (p *Pool[T]) checkConnection(conn T) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.healthCheckInterval)
+	err := p.validate(ctx, conn)
+	cancel()
+
+	p.mu.Lock()
+	info := p.conns[conn]
+	if err == nil {
+		info.failures = 0
+	} else {
+		info.failures++
+	}
+	failures := info.failures
+	id := info.id
+	p.mu.Unlock()
+
+	if err != nil {
+		p.logger.Warn("Health check failed", "failures", failures, "threshold", p.healthCheckThreshold, "error", err)
+		p.emit(Event{Type: EventHealthCheckFailed, ConnID: id, Err: err})
+	}
+	if failures < p.healthCheckThreshold {
+		p.putConn(conn)
+		return
+	}
+
+	if p.quarantineInterval > 0 {
+		p.quarantine(conn)
+		return
+	}
+
+	// Releasing the slot re-establishes the connection if the pool drops
+	// below MinConns or callers are waiting
+	p.closeConnection(conn)
+	p.releaseSlot()
+	p.logger.Info("Evicted dead connection")
+}
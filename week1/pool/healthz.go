@@ -0,0 +1,75 @@
+package pool
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// defaultHealthTimeout is how long a readiness probe may take by default
+const defaultHealthTimeout = 2 * time.Second
+
+// healthStatus is the body of a health probe response
+type healthStatus struct {
+	Status string `json:"status"` // "ok" or "unavailable"
+	Error  string `json:"error,omitempty"`
+}
+
+// Ready reports whether the pool can serve traffic: it acquires a
+// connection and validates it, both within ctx. A paused or closed pool, an
+// open circuit breaker or a saturated pool is not ready
+func (p *Pool[T]) Ready(ctx context.Context) error {
+	conn, err := p.Get(ctx)
+	if err != nil {
+		return err
+	}
+	err = p.validate(ctx, conn)
+	p.ReportResult(err)
+	if err != nil {
+		p.Discard(conn)
+		return err
+	}
+	return p.Put(conn)
+}
+
+// HealthHandler serves Kubernetes-style probes backed by the pool:
+//
+//	GET /livez    200 unless the pool has been closed; a database outage
+//	              alone must not get the process restarted
+//	GET /readyz   200 only if Ready succeeds within timeout, 503 otherwise,
+//	              so traffic is steered away while the database is unreachable
+//	GET /healthz  same as /readyz
+//
+// A timeout <= 0 means 2s. Keep it below the probe's timeoutSeconds
+func (p *Pool[T]) HealthHandler(timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	ready := func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		if err := p.Ready(ctx); err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, healthStatus{Status: "unavailable", Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		if p.Closed() {
+			writeJSON(w, http.StatusServiceUnavailable, healthStatus{Status: "unavailable", Error: ErrPoolClosed.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+	})
+	mux.HandleFunc("/readyz", ready)
+	mux.HandleFunc("/healthz", ready)
+	return mux
+}
@@ -0,0 +1,17 @@
+package pool
+
+import "context"
+
+// With acquires a connection, runs fn with it, and returns the connection to
+// the pool afterwards - even if fn panics. If fn's error shows the
+// connection is broken (see Config.Broken), it is discarded instead. It
+// returns the acquisition error or whatever fn returns
+func (p *Pool[T]) With(ctx context.Context, fn func(conn T) error) (err error) {
+	conn, err := p.Get(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { p.release(conn, err) }()
+
+	return fn(conn)
+}
@@ -0,0 +1,118 @@
+package pool
+
+import "time"
+
+// waitBuckets are the upper bounds of the acquire wait histogram, shared by
+// Stats and the acquire_duration_seconds metric: 100µs, 400µs, ... ~26s
+var waitBuckets = exponentialBuckets(100 * time.Microsecond)
+
+// holdBuckets are the upper bounds of the hold histogram, shared by Stats
+// and the hold_duration_seconds metric: 1ms, 4ms, ... ~4.4m
+var holdBuckets = exponentialBuckets(time.Millisecond)
+
+// exponentialBuckets returns 10 bucket bounds growing 4x from first
+func exponentialBuckets(first time.Duration) []time.Duration {
+	bounds := make([]time.Duration, 10)
+	d := first
+	for i := range bounds {
+		bounds[i] = d
+		d *= 4
+	}
+	return bounds
+}
+
+// WaitBucket is one bucket of a WaitHistogram: the acquisitions that took
+// longer than the previous bucket's UpperBound, up to this one's
+type WaitBucket struct {
+	UpperBound time.Duration // 0 for the last bucket, which is unbounded
+	Count      int64
+}
+
+// WaitHistogram is how long acquisitions took, from handing out an idle
+// connection right away to waiting for one to be returned. A pool that is
+// too small shows up as a long tail here while queries stay fast; a slow
+// database shows up in query latency first
+type WaitHistogram []WaitBucket
+
+// HoldHistogram is how long callers kept connections checked out. A long
+// tail here with no leaks reported means some callers do slow work, such as
+// remote calls, while holding a connection
+type HoldHistogram = WaitHistogram
+
+// Quantile returns an upper estimate of the q-th quantile (0..1): the upper
+// bound of the bucket it falls in. It returns 0 with no acquisitions, and -1
+// if the quantile lies in the unbounded last bucket
+func (h WaitHistogram) Quantile(q float64) time.Duration {
+	var total int64
+	for _, b := range h {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(q * float64(total))
+	var seen int64
+	for _, b := range h {
+		seen += b.Count
+		if seen > rank || seen == total {
+			if b.UpperBound == 0 {
+				return -1
+			}
+			return b.UpperBound
+		}
+	}
+	return -1
+}
+
+// waitCounts is the pool's running acquire wait histogram, one count per
+// waitBuckets entry plus the unbounded bucket. Guarded by p.mu
+type waitCounts [11]int64
+
+// observe counts one acquisition that took wait
+func (c *waitCounts) observe(wait time.Duration) { observeBucket(waitBuckets, c[:], wait) }
+
+// histogram returns a copy of the counts as a WaitHistogram
+func (c *waitCounts) histogram() WaitHistogram { return bucketHistogram(waitBuckets, c[:]) }
+
+// holdCounts is the pool's running hold histogram, laid out like
+// waitCounts over holdBuckets. Guarded by p.mu
+type holdCounts [11]int64
+
+// observe counts one checkout that held its connection for hold
+func (c *holdCounts) observe(hold time.Duration) { observeBucket(holdBuckets, c[:], hold) }
+
+// histogram returns a copy of the counts as a HoldHistogram
+func (c *holdCounts) histogram() HoldHistogram { return bucketHistogram(holdBuckets, c[:]) }
+
+// observeBucket counts d in the first bucket of bounds it fits in, or the
+// unbounded last one
+func observeBucket(bounds []time.Duration, counts []int64, d time.Duration) {
+	for i, bound := range bounds {
+		if d <= bound {
+			counts[i]++
+			return
+		}
+	}
+	counts[len(bounds)]++
+}
+
+// bucketHistogram copies counts over bounds into a histogram
+func bucketHistogram(bounds []time.Duration, counts []int64) WaitHistogram {
+	h := make(WaitHistogram, len(counts))
+	for i := range counts {
+		if i < len(bounds) {
+			h[i].UpperBound = bounds[i]
+		}
+		h[i].Count = counts[i]
+	}
+	return h
+}
+
+// bucketSeconds returns bucket bounds in seconds, for Prometheus
+func bucketSeconds(bounds []time.Duration) []float64 {
+	secs := make([]float64, len(bounds))
+	for i, bound := range bounds {
+		secs[i] = bound.Seconds()
+	}
+	return secs
+}
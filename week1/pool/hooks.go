@@ -0,0 +1,63 @@
+package pool
+
+import (
+	"context"
+)
+
+// Hooks are application callbacks run at points in a connection's
+// lifecycle. Any of them may be nil. They run outside the pool's lock, on the
+// goroutine that triggered them, so slow hooks slow that caller down
+type Hooks[T comparable] struct {
+	// OnCreate runs when a connection has been dialed, before it is pooled,
+	// e.g. to set session variables. An error discards the connection and
+	// counts as a failed dial
+	OnCreate func(ctx context.Context, conn T) error
+	// OnAcquire runs when a connection is handed to a caller
+	OnAcquire func(ctx context.Context, conn T)
+	// OnRelease runs when a caller returns a connection
+	OnRelease func(conn T)
+	// OnDestroy runs just before the pool closes a connection
+	OnDestroy func(conn T)
+	// Session, if set, prepares the session of each checkout, skipping
+	// connections already in the state it needs
+	Session *SessionSetup[T]
+}
+
+// runOnCreate runs the OnCreate hook, if any, on a freshly dialed connection
+// and closes the connection if the hook rejects it
+func (p *Pool[T]) runOnCreate(ctx context.Context, conn T) error {
+	if p.hooks.OnCreate == nil {
+		return nil
+	}
+	err := p.hooks.OnCreate(ctx, conn)
+	if err != nil {
+		p.closeFn(conn)
+	}
+	return err
+}
+
+// runOnAcquire runs the OnAcquire hook, if any
+func (p *Pool[T]) runOnAcquire(ctx context.Context, conn T) {
+	if p.hooks.OnAcquire != nil {
+		p.hooks.OnAcquire(ctx, conn)
+	}
+}
+
+// runOnRelease runs the OnRelease hook, if any
+func (p *Pool[T]) runOnRelease(conn T) {
+	if p.hooks.OnRelease != nil {
+		p.hooks.OnRelease(conn)
+	}
+}
+
+// destroy runs the OnDestroy hook, if any, closes the connection and emits
+// ConnDestroyed for it. id is its connInfo id
+func (p *Pool[T]) destroy(conn T, id int64) {
+	if p.hooks.OnDestroy != nil {
+		p.hooks.OnDestroy(conn)
+	}
+	if err := p.closeFn(conn); err != nil {
+		p.logger.Warn("Error closing connection", "error", err)
+	}
+	p.emit(Event{Type: EventConnDestroyed, ConnID: id})
+}
@@ -0,0 +1,51 @@
+package pool
+
+import (
+	"time"
+)
+
+// idleReaperLoop periodically closes connections that have been idle longer
+// than MaxIdleTime until the pool is closed
+func (p *Pool[T]) idleReaperLoop() {
+	defer p.wg.Done()
+
+	// Checking twice per MaxIdleTime bounds how long past the limit a
+	// connection can linger
+	ticker := time.NewTicker(p.maxIdleTime / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.closeIdleConnections()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// closeIdleConnections closes connections unused for longer than MaxIdleTime
+// while keeping at least MinConns open
+func (p *Pool[T]) closeIdleConnections() {
+	var expired []T
+
+	p.mu.Lock()
+	kept := p.idle[:0]
+	for _, conn := range p.idle {
+		if p.numOpen > p.minConns && time.Since(p.conns[conn].lastUsed) > p.maxIdleTime {
+			expired = append(expired, conn)
+			p.numOpen--
+			continue
+		}
+		kept = append(kept, conn)
+	}
+	p.idle = kept
+	p.mu.Unlock()
+
+	for _, conn := range expired {
+		p.closeConnection(conn)
+	}
+	if len(expired) > 0 {
+		p.logger.Info("Closed idle connections", "count", len(expired), "max_idle_time", p.maxIdleTime)
+	}
+}
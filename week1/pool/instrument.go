@@ -0,0 +1,485 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnActivity counts the statements run on pooled connections, as seen by
+// the database driver. Byte counts are payload sizes (query text, string and
+// binary values), not wire traffic
+type ConnActivity struct {
+	Queries       int64 `json:"queries"`        // Statements executed or queried
+	Errors        int64 `json:"errors"`         // Statements that failed
+	Rows          int64 `json:"rows"`           // Rows read plus rows affected by writes
+	BytesSent     int64 `json:"bytes_sent"`     // Query text and arguments
+	BytesReceived int64 `json:"bytes_received"` // Values read from result rows
+}
+
+// add sums other into a
+func (a *ConnActivity) add(other ConnActivity) {
+	a.Queries += other.Queries
+	a.Errors += other.Errors
+	a.Rows += other.Rows
+	a.BytesSent += other.BytesSent
+	a.BytesReceived += other.BytesReceived
+}
+
+// connCounters is the live form of a ConnActivity, shared by every server
+// session of one pooled *sql.DB. It also carries the connection's Chaos
+// faults, if the pool injects any
+type connCounters struct {
+	queries       atomic.Int64
+	errors        atomic.Int64
+	rows          atomic.Int64
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+
+	chaos  *chaos      // nil unless PoolConfig.Chaos is set
+	killed atomic.Bool // Killed by Chaos; every session acts dead
+}
+
+// statement counts one statement sent with query and args, and whether it
+// failed
+func (c *connCounters) statement(query string, args []driver.NamedValue, err error) {
+	c.queries.Add(1)
+	sent := int64(len(query))
+	for _, arg := range args {
+		sent += valueSize(arg.Value)
+	}
+	c.bytesSent.Add(sent)
+	if err != nil {
+		c.errors.Add(1)
+	}
+}
+
+func (c *connCounters) snapshot() ConnActivity {
+	return ConnActivity{
+		Queries:       c.queries.Load(),
+		Errors:        c.errors.Load(),
+		Rows:          c.rows.Load(),
+		BytesSent:     c.bytesSent.Load(),
+		BytesReceived: c.bytesReceived.Load(),
+	}
+}
+
+// valueSize approximates how many bytes a driver value takes
+func valueSize(v driver.Value) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case int64, float64, time.Time:
+		return 8
+	case bool:
+		return 1
+	}
+	return 0
+}
+
+// connCountersKey is the context key a connection's counters are passed to
+// its factory under
+type connCountersKey struct{}
+
+// withConnCounters asks the factory dialing a connection with ctx to count
+// the connection's statements into c
+func withConnCounters(ctx context.Context, c *connCounters) context.Context {
+	return context.WithValue(ctx, connCountersKey{}, c)
+}
+
+// connCountersFrom returns the counters set on ctx by withConnCounters, if any
+func connCountersFrom(ctx context.Context) *connCounters {
+	c, _ := ctx.Value(connCountersKey{}).(*connCounters)
+	return c
+}
+
+// activitySet tracks the counters of each open connection of a pool, and
+// the totals of connections already closed, so pool totals never go down
+type activitySet struct {
+	mu      sync.Mutex
+	byDB    map[*sql.DB]*connCounters
+	retired ConnActivity
+	chaos   *chaos // Handed to each connection's counters
+}
+
+func newActivitySet(c *chaos) *activitySet {
+	return &activitySet{byDB: make(map[*sql.DB]*connCounters), chaos: c}
+}
+
+// instrument wraps a connection factory so each connection it dials counts
+// its statements
+func (s *activitySet) instrument(factory func(ctx context.Context) (*sql.DB, error)) func(ctx context.Context) (*sql.DB, error) {
+	return func(ctx context.Context) (*sql.DB, error) {
+		counters := &connCounters{chaos: s.chaos}
+		db, err := factory(withConnCounters(ctx, counters))
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.byDB[db] = counters
+		s.mu.Unlock()
+		return db, nil
+	}
+}
+
+// forget stops tracking a closed connection, folding its counts into the
+// totals
+func (s *activitySet) forget(db *sql.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.byDB[db]; ok {
+		s.retired.add(c.snapshot())
+		delete(s.byDB, db)
+	}
+}
+
+// of returns what has run on db so far, or nil if db isn't tracked
+func (s *activitySet) of(db *sql.DB) *ConnActivity {
+	s.mu.Lock()
+	c, ok := s.byDB[db]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	activity := c.snapshot()
+	return &activity
+}
+
+// kill makes every session of db fail as if the server dropped it
+func (s *activitySet) kill(db *sql.DB) {
+	s.mu.Lock()
+	c, ok := s.byDB[db]
+	s.mu.Unlock()
+	if ok {
+		c.killed.Store(true)
+	}
+}
+
+func (s *activitySet) fillStats(stats *PoolStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.Activity = s.retired
+	for _, c := range s.byDB {
+		stats.Activity.add(c.snapshot())
+	}
+}
+
+// instrument returns connector set up to count the statements run on each
+// session it opens into c, or connector itself if c is nil
+func instrument(connector driver.Connector, c *connCounters) driver.Connector {
+	if c == nil {
+		return connector
+	}
+	return instrumentedConnector{Connector: connector, counters: c}
+}
+
+// instrumentedConnector wraps each session its connector opens in an
+// instrumentedConn. Driver still returns the real driver, so driver
+// specific behavior keyed on it keeps working
+type instrumentedConnector struct {
+	driver.Connector
+	counters *connCounters
+}
+
+func (c instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.counters.killed.Load() {
+		return nil, driver.ErrBadConn
+	}
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, counters: c.counters}, nil
+}
+
+// errNoIsolation and errNoReadOnly are what database/sql itself returns
+// for drivers that can't begin transactions with options
+var (
+	errNoIsolation = errors.New("sql: driver does not support non-default isolation level")
+	errNoReadOnly  = errors.New("sql: driver does not support read-only transactions")
+)
+
+// instrumentedConn counts the statements run on a driver connection. It
+// implements every optional interface database/sql looks for, falling back
+// to what database/sql would do when the wrapped connection doesn't
+type instrumentedConn struct {
+	driver.Conn
+	counters *connCounters
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if c.counters.killed.Load() {
+		return nil, driver.ErrBadConn
+	}
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		// Preparing is where a bad statement with arguments usually fails
+		c.counters.statement(query, nil, err)
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, conn: c, query: query}, nil
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if c.counters.killed.Load() {
+		return nil, driver.ErrBadConn
+	}
+	if err := c.counters.chaos.execFault(); err != nil {
+		c.counters.statement(query, args, err)
+		return nil, err
+	}
+	res, err := execer.ExecContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	c.counters.statement(query, args, err)
+	c.countAffected(res)
+	return res, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if c.counters.killed.Load() {
+		return nil, driver.ErrBadConn
+	}
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	c.counters.statement(query, args, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, counters: c.counters}, nil
+}
+
+// countAffected adds the rows a write changed
+func (c *instrumentedConn) countAffected(res driver.Result) {
+	if res == nil {
+		return
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		c.counters.rows.Add(n)
+	}
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.counters.killed.Load() {
+		return nil, driver.ErrBadConn
+	}
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errNoIsolation
+	}
+	if opts.ReadOnly {
+		return nil, errNoReadOnly
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if c.counters.killed.Load() {
+		return driver.ErrBadConn
+	}
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if c.counters.killed.Load() {
+		return driver.ErrBadConn
+	}
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if c.counters.killed.Load() {
+		return false
+	}
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *instrumentedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// instrumentedStmt counts each run of a prepared statement
+type instrumentedStmt struct {
+	driver.Stmt
+	conn  *instrumentedConn
+	query string
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if s.conn.counters.killed.Load() {
+		return nil, driver.ErrBadConn
+	}
+	if err := s.conn.counters.chaos.execFault(); err != nil {
+		s.conn.counters.statement(s.query, args, err)
+		return nil, err
+	}
+	var res driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = plainValues(args); err == nil {
+			res, err = s.Stmt.Exec(values)
+		}
+	}
+	s.conn.counters.statement(s.query, args, err)
+	s.conn.countAffected(res)
+	return res, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if s.conn.counters.killed.Load() {
+		return nil, driver.ErrBadConn
+	}
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = plainValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+	s.conn.counters.statement(s.query, args, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, counters: s.conn.counters}, nil
+}
+
+// CheckNamedValue defers to the statement's checker, then the connection's,
+// the order database/sql tries them in
+func (s *instrumentedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+// plainValues converts arguments for drivers that predate named arguments
+func plainValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// instrumentedRows counts the rows and bytes read from a result set
+type instrumentedRows struct {
+	driver.Rows
+	counters *connCounters
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	r.counters.rows.Add(1)
+	var received int64
+	for _, v := range dest {
+		received += valueSize(v)
+	}
+	r.counters.bytesReceived.Add(received)
+	return nil
+}
+
+func (r *instrumentedRows) HasNextResultSet() bool {
+	if n, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return n.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *instrumentedRows) NextResultSet() error {
+	if n, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return n.NextResultSet()
+	}
+	return io.EOF
+}
+
+// anyType is the scan type database/sql reports for drivers that don't say
+var anyType = reflect.TypeOf(new(any)).Elem()
+
+func (r *instrumentedRows) ColumnTypeScanType(index int) reflect.Type {
+	if t, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return t.ColumnTypeScanType(index)
+	}
+	return anyType
+}
+
+func (r *instrumentedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if t, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return t.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *instrumentedRows) ColumnTypeLength(index int) (int64, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return t.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *instrumentedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return t.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *instrumentedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return t.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
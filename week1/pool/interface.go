@@ -0,0 +1,20 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ConnectionPool is the part of DBConnectionPool application code needs to
+// borrow connections. Depend on it instead of *DBConnectionPool to swap in
+// mockpool.Pool in unit tests
+type ConnectionPool interface {
+	GetConnection() (*sql.DB, error)
+	GetConnectionContext(ctx context.Context) (*sql.DB, error)
+	PutConnection(conn *sql.DB) error
+	WithConnection(ctx context.Context, fn func(db *sql.DB) error) error
+	Stats() PoolStats
+	Close()
+}
+
+var _ ConnectionPool = (*DBConnectionPool)(nil)
@@ -0,0 +1,98 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// keepaliveLoop periodically pings connections that have sat idle for
+// KeepaliveInterval until the pool is closed
+func (p *Pool[T]) keepaliveLoop() {
+	defer p.wg.Done()
+
+	// Checking twice per interval means no connection goes much more than
+	// KeepaliveInterval without traffic
+	ticker := time.NewTicker(p.keepaliveInterval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.pingIdleConnections()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// pingIdleConnections pings the idle connections that have had no traffic
+// for KeepaliveInterval, one at a time, and evicts those that fail
+func (p *Pool[T]) pingIdleConnections() {
+	p.mu.Lock()
+	var quiet []T
+	for _, conn := range p.idle {
+		if time.Since(p.conns[conn].lastActive()) >= p.keepaliveInterval {
+			quiet = append(quiet, conn)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, conn := range quiet {
+		if !p.takeIdle(conn) {
+			continue // Handed to a caller in the meantime, which is traffic too
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.keepaliveInterval)
+		err := p.validate(ctx, conn)
+		cancel()
+		p.mu.Lock()
+		info := p.conns[conn]
+		if err == nil {
+			info.lastPinged = time.Now()
+		}
+		id := info.id
+		p.mu.Unlock()
+		if err == nil {
+			p.putConn(conn)
+			continue
+		}
+		p.emit(Event{Type: EventHealthCheckFailed, ConnID: id, Err: err})
+		if p.quarantineInterval > 0 {
+			p.quarantine(conn)
+			continue
+		}
+
+		// Releasing the slot dials a replacement if the pool drops below
+		// MinConns or callers are waiting
+		p.logger.Warn("Keepalive ping failed, evicting connection", "error", err)
+		p.closeConnection(conn)
+		p.releaseSlot()
+	}
+}
+
+// takeIdle removes conn from the idle queue for a background check. It
+// reports false if conn is no longer idle or the pool is closed
+func (p *Pool[T]) takeIdle(conn T) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unavailable() != nil {
+		return false
+	}
+	for i, c := range p.idle {
+		if c == conn {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			p.conns[conn].state = connChecking
+			return true
+		}
+	}
+	return false
+}
+
+// lastActive is when the connection last saw traffic: a checkout or a
+// keepalive ping
+func (info *connInfo) lastActive() time.Time {
+	if info.lastPinged.After(info.lastUsed) {
+		return info.lastPinged
+	}
+	return info.lastUsed
+}
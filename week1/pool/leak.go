@@ -0,0 +1,45 @@
+package pool
+
+import (
+	"time"
+)
+
+// leakDetectorLoop periodically looks for connections held past
+// LeakDetectionThreshold until the pool is closed
+func (p *Pool[T]) leakDetectorLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.leakThreshold / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.reportLeaks()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// reportLeaks logs, once per checkout, every connection held longer than
+// LeakDetectionThreshold along with the stack that acquired it
+func (p *Pool[T]) reportLeaks() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, info := range p.conns {
+		if info.state != connInUse || info.leakReported {
+			continue
+		}
+		held := time.Since(info.acquiredAt)
+		if held <= p.leakThreshold {
+			continue
+		}
+
+		info.leakReported = true
+		p.leaksDetected++
+		p.logger.Warn("Possible connection leak", "connection_id", info.id, "holder", info.holder,
+			"held", held.Round(time.Millisecond), "threshold", p.leakThreshold, "acquired_at", string(info.acquireStack))
+	}
+}
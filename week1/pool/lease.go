@@ -0,0 +1,136 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLeaseExpired is returned by Put, Discard and Renew for a connection the
+// pool revoked because its lease ran out (see LeaseDuration)
+var ErrLeaseExpired = errors.New("connection lease expired and the pool revoked it")
+
+// revokedRetention is how long a revoked connection is remembered for its
+// holder's Put. Its holder may never return, so the pool can't wait for it
+const revokedRetention = 10 * time.Minute
+
+// leaseKey is the context key WithLease stores a lease duration under
+type leaseKey struct{}
+
+// WithLease overrides LeaseDuration for the connections acquired with ctx,
+// e.g. to give a batch job longer. 0 means no lease
+func WithLease(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, leaseKey{}, d)
+}
+
+// leaseFor returns the lease a checkout made with ctx gets
+func (p *Pool[T]) leaseFor(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(leaseKey{}).(time.Duration); ok {
+		return d
+	}
+	return p.leaseDuration
+}
+
+// startLeaseLocked starts the lease of a checkout, if it has one.
+// Requires p.mu
+func (p *Pool[T]) startLeaseLocked(conn T, info *connInfo, lease time.Duration) {
+	if lease <= 0 {
+		return
+	}
+	info.lease = lease
+	info.leaseExpires = time.Now().Add(lease)
+	checkout := info.uses
+	info.leaseTimer = time.AfterFunc(lease, func() { p.expireLease(conn, checkout) })
+}
+
+// stopLeaseLocked ends the lease of a checkout being returned. Requires p.mu
+func (info *connInfo) stopLeaseLocked() {
+	if info.leaseTimer != nil {
+		info.leaseTimer.Stop()
+		info.leaseTimer = nil
+	}
+	info.lease = 0
+}
+
+// Renew extends the lease of a checked out connection by another full
+// lease, for holders that legitimately need it longer
+func (p *Pool[T]) Renew(conn T) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, ok := p.conns[conn]
+	if !ok {
+		if _, revoked := p.revoked[conn]; revoked {
+			return ErrLeaseExpired
+		}
+		return ErrForeignConnection
+	}
+	if info.state != connInUse {
+		return ErrDoubleReturn
+	}
+	if info.lease > 0 {
+		// A pending timer notices the new expiry and re-arms itself
+		info.leaseExpires = time.Now().Add(info.lease)
+	}
+	return nil
+}
+
+// expireLease revokes a connection whose lease ran out: it is closed, its
+// slot is refilled, and its holder's Put fails with ErrLeaseExpired.
+// checkout tells the lease's own checkout apart from later ones
+func (p *Pool[T]) expireLease(conn T, checkout int64) {
+	p.mu.Lock()
+	info, ok := p.conns[conn]
+	if !ok || info.state != connInUse || info.uses != checkout {
+		p.mu.Unlock()
+		return
+	}
+	if remaining := time.Until(info.leaseExpires); remaining > 0 {
+		// Renewed since the timer was set
+		info.leaseTimer = time.AfterFunc(remaining, func() { p.expireLease(conn, checkout) })
+		p.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	delete(p.conns, conn)
+	p.pruneRevokedLocked(now)
+	p.revoked[conn] = now
+	p.connsDestroyed++
+	p.leasesExpired++
+	id, holder, held, lease := info.id, info.holder, time.Since(info.acquiredAt), info.lease
+	p.mu.Unlock()
+
+	p.logger.Warn("Revoked connection, lease expired", "connection_id", id, "holder", holder,
+		"held", held.Round(time.Millisecond), "lease", lease)
+	p.destroy(conn, id)
+	p.releaseSlot()
+}
+
+// pruneRevokedLocked forgets connections revoked over revokedRetention
+// before now; their holders' Put gets ErrForeignConnection instead.
+// Requires p.mu
+func (p *Pool[T]) pruneRevokedLocked(now time.Time) {
+	for conn, at := range p.revoked {
+		if now.Sub(at) >= revokedRetention {
+			delete(p.revoked, conn)
+		}
+	}
+}
+
+// revokedConn reports whether conn was revoked by expireLease and its
+// holder hasn't returned it yet
+func (p *Pool[T]) revokedConn(conn T) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.revoked[conn]
+	return ok
+}
+
+// takeRevokedLocked reports whether conn was revoked by expireLease,
+// forgetting it: its holder is returning it now. Requires p.mu
+func (p *Pool[T]) takeRevokedLocked(conn T) bool {
+	if _, ok := p.revoked[conn]; !ok {
+		return false
+	}
+	delete(p.revoked, conn)
+	return true
+}
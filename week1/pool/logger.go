@@ -0,0 +1,22 @@
+package pool
+
+import "log/slog"
+
+// Logger is the structured logger the pool reports through. Messages come
+// with alternating key/value pairs, as with slog; a *slog.Logger satisfies
+// it directly. Per-acquisition messages are logged at Debug, so they are off
+// unless the logger is configured to show them
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// defaultLogger returns logger, or slog's default logger if it is nil
+func defaultLogger(logger Logger) Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
@@ -0,0 +1,61 @@
+package pool
+
+import "time"
+
+// LongHold describes a checkout that has kept its connection longer than
+// LongHoldThreshold
+type LongHold struct {
+	ConnID     int64
+	Holder     string // WithHolder label, if any
+	AcquiredAt time.Time
+	HeldFor    time.Duration // As of the alert; the checkout may go on longer
+}
+
+// longHoldLoop periodically looks for connections held past
+// LongHoldThreshold until the pool is closed
+func (p *Pool[T]) longHoldLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.longHoldThreshold / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.reportLongHolds()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// reportLongHolds alerts, once per checkout, on every connection held longer
+// than LongHoldThreshold. Alerts run outside the lock, so OnLongHold may
+// call back into the pool
+func (p *Pool[T]) reportLongHolds() {
+	now := time.Now()
+	var holds []LongHold
+	p.mu.Lock()
+	for _, info := range p.conns {
+		if info.state != connInUse || info.longHoldReported {
+			continue
+		}
+		held := now.Sub(info.acquiredAt)
+		if held <= p.longHoldThreshold {
+			continue
+		}
+		info.longHoldReported = true
+		p.longHolds++
+		holds = append(holds, LongHold{ConnID: info.id, Holder: info.holder, AcquiredAt: info.acquiredAt, HeldFor: held})
+	}
+	p.mu.Unlock()
+
+	for _, hold := range holds {
+		if p.onLongHold != nil {
+			p.onLongHold(hold)
+			continue
+		}
+		p.logger.Warn("Connection held past long-hold threshold", "connection_id", hold.ConnID, "holder", hold.Holder,
+			"held", hold.HeldFor.Round(time.Millisecond), "threshold", p.longHoldThreshold)
+	}
+}
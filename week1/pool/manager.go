@@ -0,0 +1,153 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownDatabase is returned by PoolManager.Get for a name that was
+// never registered
+var ErrUnknownDatabase = errors.New("unknown database")
+
+// PoolManager owns the connection pools of several databases, keyed by a
+// logical name such as "users" or "presence". Pools share a default
+// configuration, are created on first use, and are shut down together
+type PoolManager struct {
+	defaults PoolConfig
+
+	mu     sync.Mutex
+	dbs    map[string]*managedPool
+	closed bool
+}
+
+// managedPool is one database registered with a PoolManager
+type managedPool struct {
+	dsn string
+	cfg PoolConfig
+
+	mu   sync.Mutex // Serializes creating the pool
+	pool *DBConnectionPool
+}
+
+// NewPoolManager creates a manager whose pools start from defaults
+func NewPoolManager(defaults PoolConfig) *PoolManager {
+	return &PoolManager{defaults: defaults, dbs: make(map[string]*managedPool)}
+}
+
+// Register adds a database under name. Its pool is configured from the
+// manager's defaults with opts applied on top, and isn't created until the
+// first Get
+func (m *PoolManager) Register(name, dsn string, opts ...Option) error {
+	cfg := m.defaults
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrPoolClosed
+	}
+	if _, ok := m.dbs[name]; ok {
+		return fmt.Errorf("database %q is already registered", name)
+	}
+	m.dbs[name] = &managedPool{dsn: dsn, cfg: cfg}
+	return nil
+}
+
+// Get returns the pool for the named database, creating it if this is the
+// first use. A failed creation is retried by the next Get
+func (m *PoolManager) Get(name string) (*DBConnectionPool, error) {
+	m.mu.Lock()
+	db, ok := m.dbs[name]
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return nil, ErrPoolClosed
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDatabase, name)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.pool != nil {
+		return db.pool, nil
+	}
+	pool, err := NewDBConnectionPoolWithConfig(db.dsn, db.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pool for %q: %v", name, err)
+	}
+
+	// Shutdown may have started while the pool was dialing
+	m.mu.Lock()
+	closed = m.closed
+	m.mu.Unlock()
+	if closed {
+		pool.Close()
+		return nil, ErrPoolClosed
+	}
+	db.pool = pool
+	return pool, nil
+}
+
+// Stats returns a snapshot of every pool created so far, keyed by name
+func (m *PoolManager) Stats() map[string]PoolStats {
+	stats := make(map[string]PoolStats)
+	for name, pool := range m.created() {
+		stats[name] = pool.Stats()
+	}
+	return stats
+}
+
+// created returns the pools that exist so far
+func (m *PoolManager) created() map[string]*DBConnectionPool {
+	m.mu.Lock()
+	dbs := make(map[string]*managedPool, len(m.dbs))
+	for name, db := range m.dbs {
+		dbs[name] = db
+	}
+	m.mu.Unlock()
+
+	pools := make(map[string]*DBConnectionPool)
+	for name, db := range dbs {
+		db.mu.Lock()
+		if db.pool != nil {
+			pools[name] = db.pool
+		}
+		db.mu.Unlock()
+	}
+	return pools
+}
+
+// Shutdown stops the manager handing out pools and gracefully shuts down
+// every pool in parallel, sharing one deadline. It returns the errors of
+// the pools that did not drain in time
+func (m *PoolManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+
+	pools := m.created()
+	errs := make(chan error, len(pools))
+	var wg sync.WaitGroup
+	for name, pool := range pools {
+		wg.Add(1)
+		go func(name string, pool *DBConnectionPool) {
+			defer wg.Done()
+			if err := pool.Shutdown(ctx); err != nil {
+				errs <- fmt.Errorf("%s: %w", name, err)
+			}
+		}(name, pool)
+	}
+	wg.Wait()
+	close(errs)
+
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return errors.Join(all...)
+}
@@ -0,0 +1,98 @@
+package pool
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolMetrics holds the Prometheus histograms fed by pool events. Gauges are
+// read from Stats at scrape time instead
+type poolMetrics struct {
+	acquireDuration prometheus.Histogram
+	holdDuration    prometheus.Histogram
+}
+
+// EnableMetrics registers Prometheus metrics for the pool with the given
+// registry, under the pool's MetricsNamespace
+func (p *Pool[T]) EnableMetrics(registry prometheus.Registerer) error {
+	ns := p.metricsNamespace
+	m := &poolMetrics{
+		acquireDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "acquire_duration_seconds",
+			Help:      "Time taken to acquire a connection from the pool.",
+			Buckets:   bucketSeconds(waitBuckets), // Same as Stats().WaitHistogram
+		}),
+		holdDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "hold_duration_seconds",
+			Help:      "Time a connection was held by a caller before being returned.",
+			Buckets:   bucketSeconds(holdBuckets), // Same as Stats().HoldHistogram
+		}),
+	}
+
+	gauge := func(name, help string, value func(PoolStats) int) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(p.Stats())) })
+	}
+	collectors := []prometheus.Collector{
+		m.acquireDuration,
+		m.holdDuration,
+		gauge("in_use_connections", "Connections currently handed out to callers.",
+			func(s PoolStats) int { return s.InUseConns }),
+		gauge("idle_connections", "Connections waiting in the pool.",
+			func(s PoolStats) int { return s.IdleConns }),
+		gauge("waiters", "Callers currently blocked waiting for a connection.",
+			func(s PoolStats) int { return s.Waiters }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "leaked_connections_total",
+			Help:      "Checkouts held longer than the leak detection threshold.",
+		}, func() float64 { return float64(p.Stats().LeaksDetected) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "long_holds_total",
+			Help:      "Checkouts held longer than the long-hold threshold.",
+		}, func() float64 { return float64(p.Stats().LongHolds) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "leases_expired_total",
+			Help:      "Connections revoked because their holder's lease ran out.",
+		}, func() float64 { return float64(p.Stats().LeasesExpired) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "exhausted_total",
+			Help:      "Acquisitions rejected because too many callers were already waiting.",
+		}, func() float64 { return float64(p.Stats().WaitersShed) }),
+	}
+	for _, c := range collectors {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	p.metrics = m
+	p.mu.Unlock()
+	return nil
+}
+
+// observeAcquireLocked records an acquisition in the acquire histogram, if
+// metrics are enabled. Requires p.mu
+func (p *Pool[T]) observeAcquireLocked(wait time.Duration) {
+	if p.metrics != nil {
+		p.metrics.acquireDuration.Observe(wait.Seconds())
+	}
+}
+
+// observeHoldLocked records how long a returned connection was held, if
+// metrics are enabled. Requires p.mu
+func (p *Pool[T]) observeHoldLocked(hold time.Duration) {
+	if p.metrics != nil {
+		p.metrics.holdDuration.Observe(hold.Seconds())
+	}
+}
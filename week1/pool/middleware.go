@@ -0,0 +1,61 @@
+package pool
+
+import "context"
+
+// AcquireFunc acquires a connection, like Get
+type AcquireFunc[T comparable] func(ctx context.Context) (T, error)
+
+// ReleaseFunc gives a connection back, like Put
+type ReleaseFunc[T comparable] func(conn T) error
+
+// Middleware wraps the pool's acquire and release paths, like HTTP
+// middleware wraps a handler, for cross-cutting concerns such as metrics,
+// auth checks, tenant quotas or chaos injection. Either func may be nil.
+// Acquire wraps every checkout: Get, GetWithPriority, GetFor and TryGet,
+// whose next fails with ErrPoolExhausted instead of waiting. Release wraps
+// every return: Put, Discard and their token variants. So each connection
+// an Acquire hands out passes through Release once. A middleware can fail
+// an acquisition by returning an error without calling next, but must call
+// next to release
+type Middleware[T comparable] struct {
+	Acquire func(next AcquireFunc[T]) AcquireFunc[T]
+	Release func(next ReleaseFunc[T]) ReleaseFunc[T]
+}
+
+// Use adds middleware to the pool. The first middleware added is the
+// outermost: it sees acquisitions first and releases last. Safe to call
+// while the pool is in use; calls already in progress keep the old chain
+func (p *Pool[T]) Use(mw ...Middleware[T]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var chain []Middleware[T]
+	if old := p.middleware.Load(); old != nil {
+		chain = append(chain, *old...)
+	}
+	chain = append(chain, mw...)
+	p.middleware.Store(&chain)
+}
+
+// acquireThrough runs acquire behind the acquire middleware, if any
+func (p *Pool[T]) acquireThrough(ctx context.Context, acquire AcquireFunc[T]) (T, error) {
+	if chain := p.middleware.Load(); chain != nil {
+		for i := len(*chain) - 1; i >= 0; i-- {
+			if wrap := (*chain)[i].Acquire; wrap != nil {
+				acquire = wrap(acquire)
+			}
+		}
+	}
+	return acquire(ctx)
+}
+
+// releaseThrough runs release behind the release middleware, if any
+func (p *Pool[T]) releaseThrough(conn T, release ReleaseFunc[T]) error {
+	if chain := p.middleware.Load(); chain != nil {
+		for i := len(*chain) - 1; i >= 0; i-- {
+			if wrap := (*chain)[i].Release; wrap != nil {
+				release = wrap(release)
+			}
+		}
+	}
+	return release(conn)
+}
@@ -0,0 +1,232 @@
+// Package mockpool is an in-memory pool.ConnectionPool for unit testing code
+// that borrows database connections, without a database. Acquisitions can
+// be scripted to be slow, to fail, or to find the pool exhausted:
+//
+//	p := mockpool.New(2)
+//	p.Script(mockpool.Delay(50*time.Millisecond), mockpool.Fail(errBoom), mockpool.Exhausted())
+//	svc := NewService(p) // Takes a pool.ConnectionPool
+//
+// Without a script, it behaves like a fixed-size pool: Get blocks while
+// every connection is checked out, until one is returned, the context ends
+// or AcquireTimeout passes
+package mockpool
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/system-design/week1/pool"
+)
+
+// Step is how one acquisition behaves
+type Step struct {
+	Delay time.Duration // Wait this long first, or until the context ends
+	Err   error         // Then fail with Err (nil = hand out a connection)
+}
+
+// Delay makes an acquisition take d before it gets a connection
+func Delay(d time.Duration) Step {
+	return Step{Delay: d}
+}
+
+// Fail makes an acquisition fail with err
+func Fail(err error) Step {
+	return Step{Err: err}
+}
+
+// Exhausted makes an acquisition fail like a saturated pool past its
+// AcquireTimeout
+func Exhausted() Step {
+	return Step{Err: pool.ErrAcquireTimeout}
+}
+
+// Pool is a scripted pool.ConnectionPool. The zero value is not usable; use
+// New or NewWithConns
+type Pool struct {
+	// AcquireTimeout bounds unscripted acquisitions that find every
+	// connection in use (0 = wait for the context)
+	AcquireTimeout time.Duration
+
+	mu       sync.Mutex
+	script   []Step
+	idle     []*sql.DB
+	inUse    map[*sql.DB]bool
+	owned    map[*sql.DB]bool
+	returned chan struct{} // Closed and replaced whenever a connection is returned
+	closed   bool
+	stats    pool.PoolStats
+}
+
+var _ pool.ConnectionPool = (*Pool)(nil)
+
+// New creates a mock pool of size connections whose statements all succeed
+// and return no rows
+func New(size int) *Pool {
+	conns := make([]*sql.DB, size)
+	for i := range conns {
+		conns[i] = sql.OpenDB(stubConnector{})
+	}
+	return NewWithConns(conns...)
+}
+
+// NewWithConns creates a mock pool handing out conns, e.g. handles from
+// go-sqlmock when the test needs to check statements or script results
+func NewWithConns(conns ...*sql.DB) *Pool {
+	p := &Pool{
+		idle:     conns,
+		inUse:    make(map[*sql.DB]bool),
+		owned:    make(map[*sql.DB]bool),
+		returned: make(chan struct{}),
+	}
+	for _, conn := range conns {
+		p.owned[conn] = true
+	}
+	p.stats.MaxConns = len(conns)
+	return p
+}
+
+// Script queues steps for the next acquisitions, one step each, in order.
+// Once the script runs out, acquisitions behave normally again
+func (p *Pool) Script(steps ...Step) {
+	p.mu.Lock()
+	p.script = append(p.script, steps...)
+	p.mu.Unlock()
+}
+
+// GetConnection acquires a connection, waiting as long as it takes
+func (p *Pool) GetConnection() (*sql.DB, error) {
+	return p.GetConnectionContext(context.Background())
+}
+
+// GetConnectionContext acquires a connection, following the script
+func (p *Pool) GetConnectionContext(ctx context.Context) (*sql.DB, error) {
+	p.mu.Lock()
+	var step Step
+	if len(p.script) > 0 {
+		step = p.script[0]
+		p.script = p.script[1:]
+	}
+	p.mu.Unlock()
+
+	if step.Delay > 0 {
+		timer := time.NewTimer(step.Delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	if step.Err != nil {
+		p.mu.Lock()
+		if step.Err == pool.ErrPoolExhausted {
+			p.stats.WaitersShed++
+		}
+		p.mu.Unlock()
+		return nil, step.Err
+	}
+
+	var timeout <-chan time.Time
+	if p.AcquireTimeout > 0 {
+		timer := time.NewTimer(p.AcquireTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	start := time.Now()
+	waited := false
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, pool.ErrPoolClosed
+		}
+		if len(p.idle) > 0 {
+			conn := p.idle[0]
+			p.idle = p.idle[1:]
+			p.inUse[conn] = true
+			p.stats.AcquireCount++
+			if waited {
+				p.stats.WaitCount++
+				p.stats.WaitDuration += time.Since(start)
+			}
+			p.mu.Unlock()
+			return conn, nil
+		}
+		returned := p.returned
+		p.stats.Waiters++
+		p.mu.Unlock()
+
+		waited = true
+		var err error
+		select {
+		case <-returned:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timeout:
+			err = pool.ErrAcquireTimeout
+		}
+		p.mu.Lock()
+		p.stats.Waiters--
+		p.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// PutConnection returns a connection, rejecting ones the pool did not hand
+// out like the real pool does
+func (p *Pool) PutConnection(conn *sql.DB) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.owned[conn] {
+		return pool.ErrForeignConnection
+	}
+	if !p.inUse[conn] {
+		return pool.ErrDoubleReturn
+	}
+	delete(p.inUse, conn)
+	p.idle = append(p.idle, conn)
+	close(p.returned)
+	p.returned = make(chan struct{})
+	return nil
+}
+
+// WithConnection acquires a connection, runs fn with it and returns it
+func (p *Pool) WithConnection(ctx context.Context, fn func(db *sql.DB) error) error {
+	conn, err := p.GetConnectionContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.PutConnection(conn)
+	return fn(conn)
+}
+
+// Stats reports connection counts and acquisition counters, so tests can
+// check that code returns every connection it takes
+func (p *Pool) Stats() pool.PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.IdleConns = len(p.idle)
+	stats.InUseConns = len(p.inUse)
+	if !p.closed {
+		stats.TotalConns = stats.IdleConns + stats.InUseConns
+	}
+	return stats
+}
+
+// Close makes further acquisitions fail with pool.ErrPoolClosed and wakes
+// callers waiting for a connection
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.returned)
+	p.returned = make(chan struct{})
+}
@@ -0,0 +1,320 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrNoHealthyHosts is returned when every host of a multi-host pool failed
+// recently and none is due for a retry
+var ErrNoHealthyHosts = errors.New("no healthy database hosts")
+
+// defaultHostRetryInterval is how long a failed host is skipped by default
+const defaultHostRetryInterval = 5 * time.Second
+
+// HostStats is the health of one host of a multi-host pool
+type HostStats struct {
+	Host      string // Address of the host (credentials are never included)
+	Healthy   bool   // False while the host is skipped after a failure
+	Active    bool   // Whether a failover pool is currently using this host
+	Conns     int    // Pooled connections currently on this host
+	Failures  int    // Consecutive failed dials and probes
+	LastError string // Most recent failure, if any
+	// Role is the host's Group Replication role, RolePrimary or
+	// RoleSecondary, with TopologyInterval set; "" if it is not an online
+	// member or the topology is not watched
+	Role string
+}
+
+// host is one database node of a multi-host pool
+type host struct {
+	name      string
+	dsn       string
+	rank      int // Position in the DSN list; lower is preferred by failover pools
+	conns     int
+	failures  int
+	downUntil time.Time // Skipped for new dials until then
+	lastErr   error
+	role      string // Group Replication role, "" unless an online member
+}
+
+// hostSet spreads a pool's connections across several hosts and steers new
+// dials away from hosts that are failing
+type hostSet struct {
+	driverName    string
+	retryInterval time.Duration
+	logger        Logger
+
+	// topologyInterval is how often the group's topology is re-read
+	// (0 = not watched), see TopologyInterval
+	topologyInterval time.Duration
+
+	// ordered makes a failover pool: all connections go to the first
+	// healthy host, see NewFailoverPool
+	ordered bool
+
+	mu      sync.Mutex
+	session sessionSettings // Reload can change the statement timeout
+	hosts   []*host
+	onHost  map[*sql.DB]*host // Which host each pooled connection is on
+	active  *host             // Host a failover pool is using, nil until the first dial
+	pool    *Pool[*sql.DB]    // Set once the pool is built, for retiring connections
+	// Whether a topology was read, so roles decide where dials go
+	topology bool
+	// New members memberDSN couldn't build a DSN for, warned about once
+	unreachable map[string]bool
+}
+
+// NewMultiHostPool creates a connection pool spanning several database hosts,
+// e.g. the nodes of a MySQL Galera or Group Replication cluster, given one
+// DSN per host. New connections go to the healthy host with the fewest
+// pooled connections; a host whose dial or probe fails is skipped for
+// HostRetryInterval, and the connections lost with it are redialed against
+// the remaining hosts. Stats reports the health of each host.
+//
+// With TopologyInterval set, the pool also reads the group's membership and
+// only dials its online members, retiring connections to members that left
+func NewMultiHostPool(dsns []string, cfg PoolConfig) (*DBConnectionPool, error) {
+	if len(dsns) == 0 {
+		return nil, errors.New("multi-host pool needs at least one DSN")
+	}
+	hosts, err := newHostSet(dsns, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newDBConnectionPool(hosts.dial, cfg, hosts)
+}
+
+// newHostSet validates dsns and builds the hostSet for them
+func newHostSet(dsns []string, cfg PoolConfig) (*hostSet, error) {
+	hosts := &hostSet{
+		driverName:    cfg.DriverName,
+		session:       sessionSettingsOf(cfg),
+		retryInterval: cfg.HostRetryInterval,
+		logger:        defaultLogger(cfg.Logger),
+		onHost:        make(map[*sql.DB]*host),
+
+		topologyInterval: cfg.TopologyInterval,
+	}
+	if hosts.driverName == "" {
+		hosts.driverName = "mysql"
+	}
+	if hosts.retryInterval <= 0 {
+		hosts.retryInterval = defaultHostRetryInterval
+	}
+	for i, dsn := range dsns {
+		if hosts.driverName == "mysql" {
+			if err := validateMySQLDSN(dsn); err != nil {
+				return nil, err
+			}
+		}
+		hosts.hosts = append(hosts.hosts, &host{name: hostName(hosts.driverName, dsn, i), dsn: dsn, rank: i})
+	}
+	if hosts.topologyInterval > 0 {
+		// So the first connections already go where the topology says
+		hosts.refreshTopology()
+	}
+	return hosts, nil
+}
+
+// hostName extracts a loggable address from a DSN, falling back to the
+// host's position in the list
+func hostName(driverName, dsn string, i int) string {
+	if driverName == "mysql" {
+		if cfg, err := mysql.ParseDSN(dsn); err == nil && cfg.Addr != "" {
+			return cfg.Addr
+		}
+	} else if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return fmt.Sprintf("host %d", i)
+}
+
+// dial opens a connection on the least loaded healthy host, moving on to the
+// next one if the dial fails
+func (s *hostSet) dial(ctx context.Context) (*sql.DB, error) {
+	tried := make(map[*host]bool)
+	lastErr := ErrNoHealthyHosts
+	for {
+		s.mu.Lock()
+		h := s.pickLocked(tried)
+		s.mu.Unlock()
+		if h == nil {
+			return nil, lastErr
+		}
+		tried[h] = true
+
+		dsn, session := s.dialTarget(h)
+		db, err := openDB(ctx, s.driverName, dsn, session)
+		if err != nil {
+			s.fail(h, err)
+			lastErr = fmt.Errorf("%s: %v", h.name, err)
+			continue
+		}
+
+		s.mu.Lock()
+		h.conns++
+		h.failures = 0
+		h.downUntil = time.Time{}
+		s.onHost[db] = h
+		failover := s.ordered && s.shouldSwitchLocked(h)
+		s.mu.Unlock()
+		if failover {
+			s.switchTo(h)
+		}
+		return db, nil
+	}
+}
+
+// dialTarget returns what to dial h with, which Reload can change
+func (s *hostSet) dialTarget(h *host) (string, sessionSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return h.dsn, s.session
+}
+
+// retarget makes dsn the first configured host's, for failover pools: the
+// primary. MySQL standbys sharing its old credentials get the new ones, so
+// rotating a password in the primary's DSN keeps failover working
+func (s *hostSet) retarget(dsn string, statementTimeout time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	primary := s.hosts[0]
+	rotate := dsn != "" && dsn != primary.dsn
+	if rotate {
+		if !s.ordered {
+			return false, ErrReloadDSN
+		}
+		if s.driverName == "mysql" {
+			if err := validateMySQLDSN(dsn); err != nil {
+				return false, err
+			}
+		}
+	}
+	changed := s.session.statementTimeout != statementTimeout
+	s.session.statementTimeout = statementTimeout
+	if !rotate {
+		return changed, nil
+	}
+	if s.driverName == "mysql" {
+		s.rotateCredentialsLocked(primary.dsn, dsn)
+	}
+	primary.dsn = dsn
+	primary.name = hostName(s.driverName, dsn, 0)
+	return true, nil
+}
+
+// rotateCredentialsLocked moves the MySQL hosts other than the first that
+// log in like from over to to's user and password. Requires s.mu
+func (s *hostSet) rotateCredentialsLocked(from, to string) {
+	old, err := mysql.ParseDSN(from)
+	if err != nil {
+		return
+	}
+	next, err := mysql.ParseDSN(to)
+	if err != nil {
+		return
+	}
+	for _, h := range s.hosts[1:] {
+		cfg, err := mysql.ParseDSN(h.dsn)
+		if err != nil || cfg.User != old.User || cfg.Passwd != old.Passwd {
+			continue
+		}
+		cfg.User, cfg.Passwd = next.User, next.Passwd
+		h.dsn = cfg.FormatDSN()
+	}
+}
+
+func (s *hostSet) sessionDefaults() sessionSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.session
+}
+
+// pickLocked returns the healthy host with the fewest connections that has
+// not been tried yet, or nil. Failover pools take the first such host
+// instead. Once a topology is read, only the hosts it allows are considered.
+// Requires s.mu
+func (s *hostSet) pickLocked(tried map[*host]bool) *host {
+	now := time.Now()
+	var best *host
+	for _, h := range s.hosts {
+		if tried[h] || now.Before(h.downUntil) || !s.eligibleLocked(h) {
+			continue
+		}
+		if s.ordered {
+			return h
+		}
+		if best == nil || h.conns < best.conns {
+			best = h
+		}
+	}
+	return best
+}
+
+// fail records a failed dial or probe and takes the host out of rotation
+func (s *hostSet) fail(h *host, err error) {
+	s.mu.Lock()
+	h.failures++
+	h.lastErr = err
+	h.downUntil = time.Now().Add(s.retryInterval)
+	s.mu.Unlock()
+	s.logger.Warn("Host failed, skipping it", "host", h.name, "skip_for", s.retryInterval, "error", err)
+}
+
+// track wraps a pool's validate and close functions so failed probes mark
+// the connection's host unhealthy and closed connections are uncounted
+func (s *hostSet) track(validate func(ctx context.Context, db *sql.DB) error, closeDB func(db *sql.DB) error) (func(ctx context.Context, db *sql.DB) error, func(db *sql.DB) error) {
+	trackedValidate := func(ctx context.Context, db *sql.DB) error {
+		err := validate(ctx, db)
+		if err != nil {
+			s.mu.Lock()
+			h := s.onHost[db]
+			s.mu.Unlock()
+			if h != nil {
+				s.fail(h, err)
+			}
+		}
+		return err
+	}
+	trackedClose := func(db *sql.DB) error {
+		s.mu.Lock()
+		if h, ok := s.onHost[db]; ok {
+			h.conns--
+			delete(s.onHost, db)
+		}
+		s.mu.Unlock()
+		return closeDB(db)
+	}
+	return trackedValidate, trackedClose
+}
+
+// stats returns the health of every host
+func (s *hostSet) stats() []HostStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]HostStats, len(s.hosts))
+	for i, h := range s.hosts {
+		stats[i] = HostStats{
+			Host:     h.name,
+			Healthy:  !now.Before(h.downUntil),
+			Active:   h == s.active,
+			Conns:    h.conns,
+			Failures: h.failures,
+			Role:     h.role,
+		}
+		if h.lastErr != nil {
+			stats[i].LastError = h.lastErr.Error()
+		}
+	}
+	return stats
+}
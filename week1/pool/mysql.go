@@ -0,0 +1,64 @@
+package pool
+
+import (
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// NewMySQLPool creates a MySQL connection pool from a mysql.Config, for
+// setups a DSN string gets unwieldy for: TLS (set TLS, or TLSConfig to a
+// name registered with mysql.RegisterTLSConfig), dial and I/O timeouts, and
+// params such as ParseTime or charset. The config is validated here, so a
+// bad one fails construction instead of every dial. cfg.DriverName is ignored
+func NewMySQLPool(mysqlCfg *mysql.Config, cfg PoolConfig) (*DBConnectionPool, error) {
+	// Later changes to the caller's config must not affect the pool
+	mysqlCfg = mysqlCfg.Clone()
+	connector, err := mysql.NewConnector(mysqlCfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MySQL config: %v", err)
+	}
+	dialer := &dsnDialer{driverName: "mysql"}
+	dialer.target.Store(&dsnTarget{session: sessionSettingsOf(cfg), mysql: mysqlCfg, connector: connector})
+	return newDialerPool(dialer, cfg)
+}
+
+// reloadedMySQLConfig parses a DSN given to Reload into a config replacing
+// base. What the DSN leaves unset keeps base's value: TLS, timeouts and
+// params, which callers often set in code rather than in the DSN
+func reloadedMySQLConfig(base *mysql.Config, dsn string) (*mysql.Config, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MySQL DSN: %v", err)
+	}
+	if cfg.TLSConfig == "" && cfg.TLS == nil {
+		cfg.TLSConfig, cfg.TLS = base.TLSConfig, base.TLS
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = base.Timeout
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = base.ReadTimeout
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = base.WriteTimeout
+	}
+	for k, v := range base.Params {
+		if _, ok := cfg.Params[k]; !ok {
+			if cfg.Params == nil {
+				cfg.Params = make(map[string]string)
+			}
+			cfg.Params[k] = v
+		}
+	}
+	return cfg, nil
+}
+
+// validateMySQLDSN checks that a DSN parses, so a typo is reported at
+// construction rather than as a dial error
+func validateMySQLDSN(dsn string) error {
+	if _, err := mysql.ParseDSN(dsn); err != nil {
+		return fmt.Errorf("invalid MySQL DSN: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package pool
+
+import "time"
+
+// defaultPoolSize is the pool size NewDBConnectionPool uses unless an option
+// changes it
+const defaultPoolSize = 10
+
+// Option configures a pool built by NewDBConnectionPool
+type Option func(*PoolConfig)
+
+// WithSize makes the pool fixed-size: it keeps n connections open
+func WithSize(n int) Option {
+	return func(cfg *PoolConfig) {
+		cfg.MinConns = n
+		cfg.MaxConns = n
+	}
+}
+
+// WithMinConns sets how many connections the pool keeps open when idle
+func WithMinConns(n int) Option {
+	return func(cfg *PoolConfig) { cfg.MinConns = n }
+}
+
+// WithMaxConns sets how many connections the pool may open under load
+func WithMaxConns(n int) Option {
+	return func(cfg *PoolConfig) {
+		cfg.MaxConns = n
+		if cfg.MinConns > n {
+			cfg.MinConns = n
+		}
+	}
+}
+
+// WithDriver sets the database/sql driver the pool opens connections with
+func WithDriver(driverName string) Option {
+	return func(cfg *PoolConfig) { cfg.DriverName = driverName }
+}
+
+// WithAcquireTimeout bounds how long acquisitions wait for a connection
+func WithAcquireTimeout(d time.Duration) Option {
+	return func(cfg *PoolConfig) { cfg.AcquireTimeout = d }
+}
+
+// WithMaxWaiters makes acquisitions fail with ErrPoolExhausted once n
+// callers are already waiting
+func WithMaxWaiters(n int) Option {
+	return func(cfg *PoolConfig) { cfg.MaxWaiters = n }
+}
+
+// WithOverflow lets the pool open up to n temporary connections above
+// MaxConns during spikes (see Settings.Overflow)
+func WithOverflow(n int) Option {
+	return func(cfg *PoolConfig) { cfg.Overflow = n }
+}
+
+// WithLogger sets the logger the pool reports through
+func WithLogger(logger Logger) Option {
+	return func(cfg *PoolConfig) { cfg.Logger = logger }
+}
+
+// WithAudit records every checkout and return to sink (see Settings.Audit)
+func WithAudit(sink AuditSink) Option {
+	return func(cfg *PoolConfig) { cfg.Audit = sink }
+}
+
+// WithHealthCheckInterval probes idle connections in the background every d
+func WithHealthCheckInterval(d time.Duration) Option {
+	return func(cfg *PoolConfig) { cfg.HealthCheckInterval = d }
+}
+
+// WithMaxConnUses replaces connections after they have served n checkouts
+func WithMaxConnUses(n int) Option {
+	return func(cfg *PoolConfig) { cfg.MaxConnUses = n }
+}
+
+// WithQuarantine quarantines connections that keep failing probes instead
+// of evicting them, re-probing them from interval up to maxInterval
+// (see Settings.QuarantineInterval)
+func WithQuarantine(interval, maxInterval time.Duration) Option {
+	return func(cfg *PoolConfig) {
+		cfg.QuarantineInterval = interval
+		cfg.QuarantineMaxInterval = maxInterval
+	}
+}
+
+// WithReconnectBackoff backs off failed replacement dials from base up to
+// max (see Settings.ReconnectBackoff)
+func WithReconnectBackoff(base, max time.Duration) Option {
+	return func(cfg *PoolConfig) {
+		cfg.ReconnectBackoff = base
+		cfg.ReconnectMaxBackoff = max
+	}
+}
+
+// WithLeaseDuration revokes connections not returned or renewed within d
+// (see Settings.LeaseDuration)
+func WithLeaseDuration(d time.Duration) Option {
+	return func(cfg *PoolConfig) { cfg.LeaseDuration = d }
+}
+
+// WithLongHoldAlert calls fn for connections held longer than threshold;
+// a nil fn logs them instead (see Settings.LongHoldThreshold)
+func WithLongHoldAlert(threshold time.Duration, fn func(LongHold)) Option {
+	return func(cfg *PoolConfig) {
+		cfg.LongHoldThreshold = threshold
+		cfg.OnLongHold = fn
+	}
+}
+
+// WithKeepalive pings connections that have been idle for d
+func WithKeepalive(d time.Duration) Option {
+	return func(cfg *PoolConfig) { cfg.KeepaliveInterval = d }
+}
+
+// WithValidateOnCheckout probes every connection before handing it out
+func WithValidateOnCheckout() Option {
+	return func(cfg *PoolConfig) { cfg.ValidateOnCheckout = true }
+}
+
+// WithValidationQuery probes connections by running query, giving up on a
+// probe after timeout (0 = no probe timeout)
+func WithValidationQuery(query string, timeout time.Duration) Option {
+	return func(cfg *PoolConfig) {
+		cfg.ValidationQuery = query
+		cfg.ValidationTimeout = timeout
+	}
+}
+
+// WithAutoTune lets the pool size itself between MinConns and MaxConns,
+// re-evaluating every interval
+func WithAutoTune(interval time.Duration) Option {
+	return func(cfg *PoolConfig) { cfg.AutoTuneInterval = interval }
+}
+
+// WithStatementTimeout makes the server abort statements running longer
+// than d (see PoolConfig.StatementTimeout)
+func WithStatementTimeout(d time.Duration) Option {
+	return func(cfg *PoolConfig) { cfg.StatementTimeout = d }
+}
+
+// WithReadOnly makes the pool read-only (see PoolConfig.ReadOnly)
+func WithReadOnly() Option {
+	return func(cfg *PoolConfig) { cfg.ReadOnly = true }
+}
+
+// WithSlowQueryLog logs statements run through the pool's helpers that take
+// at least threshold
+func WithSlowQueryLog(threshold time.Duration) Option {
+	return func(cfg *PoolConfig) { cfg.SlowQueryThreshold = threshold }
+}
+
+// WithChaos injects faults into the pool's connections; for tests only
+// (see Chaos)
+func WithChaos(c Chaos) Option {
+	return func(cfg *PoolConfig) { cfg.Chaos = &c }
+}
+
+// WithConfig replaces the whole configuration, for settings that have no
+// option of their own. Options after it still apply on top
+func WithConfig(c PoolConfig) Option {
+	return func(cfg *PoolConfig) { *cfg = c }
+}
@@ -0,0 +1,150 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUnknownPartition is returned by Partition for a name that wasn't
+// configured in Settings.Partitions
+var ErrUnknownPartition = errors.New("unknown pool partition")
+
+// Partition is a named share of a pool, e.g. "api", "batch" or "admin", that
+// may hold at most its quota of connections at once. Partitions draw from
+// the same connections, so quotas that add up to less than MaxConns keep
+// some for everyone else: a batch job at its quota waits on its own
+// partition instead of starving interactive traffic
+type Partition[T comparable] struct {
+	pool  *Pool[T]
+	name  string
+	quota chan struct{} // One token per connection the partition holds
+
+	mu   sync.Mutex
+	held map[T]struct{} // Connections currently checked out through this partition
+
+	waiting atomic.Int64 // Callers blocked on the quota
+}
+
+// PartitionStats is a snapshot of one partition's usage
+type PartitionStats struct {
+	MaxConns   int // The partition's quota
+	InUseConns int // Connections checked out through the partition
+	Waiters    int // Callers blocked because the partition is at its quota
+}
+
+// newPartitions creates the partitions configured in Settings.Partitions
+func newPartitions[T comparable](p *Pool[T], quotas map[string]int) (map[string]*Partition[T], error) {
+	partitions := make(map[string]*Partition[T], len(quotas))
+	for name, quota := range quotas {
+		if quota <= 0 {
+			return nil, fmt.Errorf("partition %q quota must be positive, got %d", name, quota)
+		}
+		partitions[name] = &Partition[T]{
+			pool:  p,
+			name:  name,
+			quota: make(chan struct{}, quota),
+			held:  make(map[T]struct{}),
+		}
+	}
+	return partitions, nil
+}
+
+// Partition returns the named partition of the pool
+func (p *Pool[T]) Partition(name string) (*Partition[T], error) {
+	part, ok := p.partitions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPartition, name)
+	}
+	return part, nil
+}
+
+// Get retrieves a connection for the partition, first waiting for the
+// partition to be under its quota and then for the pool. AcquireTimeout
+// covers both waits
+func (pt *Partition[T]) Get(ctx context.Context) (T, error) {
+	var zero T
+	parent := ctx
+	if d := time.Duration(pt.pool.acquireTimeout.Load()); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	select {
+	case pt.quota <- struct{}{}:
+	default:
+		pt.waiting.Add(1)
+		select {
+		case pt.quota <- struct{}{}:
+			pt.waiting.Add(-1)
+		case <-ctx.Done():
+			pt.waiting.Add(-1)
+			if parent.Err() == nil {
+				return zero, ErrAcquireTimeout
+			}
+			return zero, ctx.Err()
+		}
+	}
+
+	conn, err := pt.pool.Get(ctx)
+	if err != nil {
+		<-pt.quota
+		if errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+			err = ErrAcquireTimeout
+		}
+		return zero, err
+	}
+	pt.mu.Lock()
+	pt.held[conn] = struct{}{}
+	pt.mu.Unlock()
+	return conn, nil
+}
+
+// Put returns a connection checked out through this partition
+func (pt *Partition[T]) Put(conn T) error {
+	return pt.release(conn, nil)
+}
+
+// release gives back a connection checked out through this partition,
+// discarding it if err shows it is broken
+func (pt *Partition[T]) release(conn T, err error) error {
+	pt.mu.Lock()
+	_, ok := pt.held[conn]
+	delete(pt.held, conn)
+	pt.mu.Unlock()
+	if !ok {
+		return pt.pool.misuse(fmt.Errorf("%w (partition %q)", ErrForeignConnection, pt.name))
+	}
+
+	err = pt.pool.release(conn, err)
+	<-pt.quota
+	return err
+}
+
+// With acquires a connection for the partition, runs fn with it, and returns
+// the connection afterwards - even if fn panics. Like Pool.With, a broken
+// connection is discarded instead
+func (pt *Partition[T]) With(ctx context.Context, fn func(conn T) error) (err error) {
+	conn, err := pt.Get(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { pt.release(conn, err) }()
+
+	return fn(conn)
+}
+
+// stats returns a snapshot of the partition's usage
+func (pt *Partition[T]) stats() PartitionStats {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return PartitionStats{
+		MaxConns:   cap(pt.quota),
+		InUseConns: len(pt.held),
+		Waiters:    int(pt.waiting.Load()),
+	}
+}
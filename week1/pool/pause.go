@@ -0,0 +1,147 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// PausePolicy is what new acquisitions do while the pool is paused by Pause
+type PausePolicy int
+
+const (
+	// PauseWait blocks acquisitions until Resume, or until their context or
+	// AcquireTimeout gives up
+	PauseWait PausePolicy = iota
+	// PauseFail fails acquisitions at once with ErrPoolPaused
+	PauseFail
+)
+
+func (pp PausePolicy) String() string {
+	if pp == PauseFail {
+		return "fail"
+	}
+	return "wait"
+}
+
+// pauseGate holds back acquisitions between Pause and Resume
+type pauseGate struct {
+	policy  PausePolicy
+	resumed chan struct{} // Closed by Resume
+}
+
+// Pause stops handing out connections until Resume, e.g. to quiesce traffic
+// during a schema migration. Unlike Drain, no connection is closed:
+// checkouts already made carry on and are returned as usual, and the pool
+// resumes at full size. New acquisitions wait or fail as policy says;
+// calling Pause again only changes the policy
+func (p *Pool[T]) Pause(policy PausePolicy) error {
+	p.mu.Lock()
+	if p.isClosed() {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	gate := &pauseGate{policy: policy, resumed: make(chan struct{})}
+	if old := p.gate.Load(); old != nil {
+		gate.resumed = old.resumed // Callers already waiting stay held
+	}
+	p.gate.Store(gate)
+	p.mu.Unlock()
+
+	p.logger.Info("Acquisitions paused", "policy", policy)
+	return nil
+}
+
+// waitUnpaused holds an acquisition while the pool is paused by Pause,
+// giving up as the acquisition would: when ctx ends, timeout fires or the
+// pool is closed
+func (p *Pool[T]) waitUnpaused(ctx context.Context, timeout <-chan time.Time) error {
+	for {
+		gate := p.gate.Load()
+		if gate == nil {
+			return nil
+		}
+		if gate.policy == PauseFail {
+			return ErrPoolPaused
+		}
+		select {
+		case <-gate.resumed:
+		case <-p.stop:
+			return ErrPoolClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return ErrAcquireTimeout
+		}
+	}
+}
+
+// Drain pauses the pool for database maintenance: acquisitions fail with
+// ErrPoolPaused, blocked callers are woken with it, idle and quarantined
+// connections are closed, and Drain waits until the connections still in use have been
+// returned and closed too. Unlike Shutdown, the pool stays usable; Resume
+// reopens it. If ctx expires first, Drain returns ctx's error and the pool
+// stays paused, with the remaining connections closed as they come back
+func (p *Pool[T]) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	switch poolState(p.state.Load()) {
+	case poolDraining, poolClosed:
+		p.mu.Unlock()
+		return ErrPoolClosed
+	case poolOpen:
+		p.state.Store(int32(poolPaused))
+		p.paused = make(chan struct{})
+		p.pauseDrained = false
+		for _, w := range p.waiters.drain() {
+			close(w.ready) // Wake waiters with ErrPoolPaused
+		}
+	}
+	idle := append(p.idle, p.takeQuarantinedLocked()...)
+	p.idle = nil
+	paused := p.paused
+	p.mu.Unlock()
+
+	for _, conn := range idle {
+		p.closeConnection(conn)
+	}
+	p.mu.Lock()
+	p.numOpen -= len(idle)
+	p.signalDrainedLocked()
+	p.mu.Unlock()
+	p.logger.Info("Pool paused, waiting for in-use connections to be returned")
+
+	select {
+	case <-paused:
+		p.logger.Info("Pool drained for maintenance")
+		return nil
+	case <-p.drained:
+		return ErrPoolClosed // Shut down while paused
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resume lets acquisitions through again after Pause, and reopens a pool
+// paused by Drain, dialing connections back up to MinConns in the
+// background. It is a no-op on a pool that isn't paused
+func (p *Pool[T]) Resume() error {
+	p.mu.Lock()
+	if gate := p.gate.Swap(nil); gate != nil {
+		close(gate.resumed)
+		p.logger.Info("Acquisitions resumed")
+	}
+	switch poolState(p.state.Load()) {
+	case poolOpen:
+		p.mu.Unlock()
+		return nil
+	case poolDraining, poolClosed:
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	p.state.Store(int32(poolOpen))
+	p.paused = nil
+	p.maybeOpenNewConnectionsLocked()
+	p.mu.Unlock()
+
+	p.logger.Info("Pool resumed")
+	return nil
+}
@@ -0,0 +1,1113 @@
+// Package pool is the connection pool from the week1 online/offline indicator
+// assignment: a blocking queue of pre-established connections. Pool[T] works
+// with any kind of connection (database handles, gRPC clients, TCP
+// connections); DBConnectionPool specializes it for database/sql
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrAcquireTimeout is returned when no connection became available within
+// the pool's AcquireTimeout
+var ErrAcquireTimeout = errors.New("timed out waiting for a connection from the pool")
+
+// ErrPoolClosed is returned when acquiring from a pool that has been closed
+var ErrPoolClosed = errors.New("connection pool is closed")
+
+// ErrPoolPaused is returned when acquiring from a pool paused by Drain, or
+// by Pause with PauseFail
+var ErrPoolPaused = errors.New("connection pool is paused for maintenance")
+
+// ErrPoolExhausted is returned instead of waiting when MaxWaiters callers are
+// already blocked waiting for a connection. Acquire middleware also sees it
+// from TryGet when no connection is free
+var ErrPoolExhausted = errors.New("connection pool exhausted: too many callers waiting")
+
+// ErrForeignConnection is returned when Put is given a connection this pool
+// did not issue (or has already closed)
+var ErrForeignConnection = errors.New("connection does not belong to this pool")
+
+// ErrDoubleReturn is returned when Put is given a connection that is not
+// currently checked out, usually because it was already returned
+var ErrDoubleReturn = errors.New("connection was already returned to the pool")
+
+// Settings holds the tuning knobs shared by every kind of pool
+type Settings struct {
+	// The pool starts with MinConns connections, dials more on demand up to
+	// MaxConns, and closes idle ones back down to MinConns (see MaxIdleTime)
+	MinConns       int
+	MaxConns       int
+	AcquireTimeout time.Duration // Max time to wait for a connection (0 = wait forever)
+	// MaxWaiters caps how many callers may block waiting for a connection;
+	// further ones fail immediately with ErrPoolExhausted, giving services a
+	// backpressure signal instead of a pile-up of goroutines (0 = no limit)
+	MaxWaiters int
+	// Overflow lets the pool open up to this many temporary connections
+	// above MaxConns when every connection is busy, to absorb spikes. Once
+	// traffic subsides, a returned overflow connection nobody is waiting for
+	// is closed instead of pooled, like SQLAlchemy's max_overflow (0 = none)
+	Overflow int
+
+	// LazyConnect skips dialing MinConns at construction; connections are
+	// created on first acquisition, so the pool can be built before the
+	// server is reachable
+	LazyConnect bool
+
+	// InitRetries is how many times dialing each initial connection is
+	// retried, with exponential backoff and jitter, before construction
+	// fails. Rides out a server that is briefly unavailable at startup
+	InitRetries    int
+	InitBackoff    time.Duration // Delay before the first retry (default 100ms)
+	InitMaxBackoff time.Duration // Cap on the delay between retries (default 5s)
+	// WarmupConcurrency is how many initial connections are dialed at once
+	// (default 8; 1 dials them one after another)
+	WarmupConcurrency int
+	// MinSuccessful lets construction succeed once this many of the MinConns
+	// initial connections are up; the rest are backfilled in the background
+	// with retries, and Stats reports the pool as degraded meanwhile
+	// (0 = all MinConns must succeed)
+	MinSuccessful int
+
+	// ValidateOnCheckout probes every connection before handing it out and
+	// transparently replaces ones that have died since they were pooled
+	ValidateOnCheckout bool
+
+	// HealthCheckInterval is how often idle connections are probed in the
+	// background (0 = no health checker)
+	HealthCheckInterval time.Duration
+	// HealthCheckFailureThreshold is how many consecutive failed probes evict
+	// a connection (0 = evict on the first failure)
+	HealthCheckFailureThreshold int
+
+	// MaxConnLifetime is how long a connection may live before it is closed
+	// and recreated on return to the pool (0 = no limit). Keep it below
+	// server-side idle timeouts and those of any proxies in between
+	MaxConnLifetime time.Duration
+	// MaxConnUses closes and replaces a connection once it has served this
+	// many checkouts (0 = no limit). Works around server-side per-session
+	// leaks and forces periodic re-resolution of DNS and credentials
+	MaxConnUses int
+
+	// KeepaliveInterval pings connections that have sat idle this long, so
+	// NAT and firewall idle timeouts or MySQL's wait_timeout don't silently
+	// drop them between bursts of traffic. Keep it below the shortest of
+	// those timeouts (0 = no keepalive)
+	KeepaliveInterval time.Duration
+
+	// QuarantineInterval quarantines connections that fail
+	// HealthCheckFailureThreshold probes in a row, or a keepalive ping,
+	// instead of evicting them: they keep their slot, are re-probed after
+	// this long, backing off exponentially up to QuarantineMaxInterval, and
+	// rejoin the pool once a probe succeeds. A flapping server then can't
+	// churn the pool through a dial-and-close loop (0 = evict them)
+	QuarantineInterval time.Duration
+	// QuarantineMaxInterval caps the delay between re-probes of a
+	// quarantined connection (default 32 × QuarantineInterval)
+	QuarantineMaxInterval time.Duration
+
+	// ReconnectBackoff is the delay ceiling after a failed dial replacing a
+	// dead or closed connection; it doubles with each further failure, up
+	// to ReconnectMaxBackoff, and actual delays are jittered below it
+	// (default 100ms)
+	ReconnectBackoff    time.Duration
+	ReconnectMaxBackoff time.Duration // Cap on the reconnect delay (default 5s)
+
+	// MaxIdleTime closes connections that sat unused in the pool longer than
+	// this, shrinking the pool toward MinConns (0 = keep idle connections)
+	MaxIdleTime time.Duration
+
+	// MetricsNamespace prefixes the Prometheus metrics published by
+	// EnableMetrics (default "pool")
+	MetricsNamespace string
+
+	// LeakDetectionThreshold logs the acquiring goroutine's stack when a
+	// connection is held longer than this (0 = no leak detection). Stacks
+	// are captured on every checkout, so this has a cost
+	LeakDetectionThreshold time.Duration
+
+	// LeaseDuration bounds how long a checkout may keep its connection
+	// without returning it or calling Renew. Once a lease runs out the pool
+	// revokes the connection: it is closed, its slot is refilled, and the
+	// holder's Put returns ErrLeaseExpired, so a wedged goroutine can't
+	// permanently shrink the pool (0 = no leases). The revocation is
+	// remembered for 10 minutes; a Put after that is treated as foreign.
+	// WithLease overrides it per checkout
+	LeaseDuration time.Duration
+
+	// LongHoldThreshold alerts on connections held longer than this, once
+	// per checkout, to surface callers that are slow but not leaking, e.g.
+	// ones making remote calls mid-transaction (0 = no alerts). Unlike leak
+	// detection it captures no stacks, so it is cheap enough to leave on
+	LongHoldThreshold time.Duration
+	// OnLongHold receives the alerts, on the pool's background goroutine, so
+	// it shouldn't block (default: log a warning)
+	OnLongHold func(LongHold)
+
+	// LIFOWaiters hands returned connections to the most recently blocked
+	// caller instead of the longest waiting one. Callers served quickly stay
+	// warm in CPU caches, at the cost of the oldest waiters possibly timing out
+	LIFOWaiters bool
+
+	// CircuitBreakerThreshold opens the circuit breaker after this many
+	// consecutive failed dials, checkout probes or reported statements, so
+	// acquisitions fail fast with ErrCircuitOpen instead of each burning its
+	// full timeout against a dead server (0 = no circuit breaker)
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is how often an open circuit lets one
+	// acquisition probe the server (default 5s)
+	CircuitBreakerCooldown time.Duration
+
+	// AutoTuneInterval lets the pool pick its own size between MinConns and
+	// MaxConns, re-evaluated this often: it grows while callers wait longer
+	// than AutoTuneTargetWait, shrinks when connections go unused, and
+	// backs off when the database slows down (0 = fixed MaxConns)
+	AutoTuneInterval time.Duration
+	// AutoTuneTargetWait is the average acquire wait the auto-tuner accepts
+	// before adding connections (default 10ms)
+	AutoTuneTargetWait time.Duration
+
+	// Partitions splits the pool into named shares with a cap on how many
+	// connections each may hold at once, e.g. {"api": 8, "batch": 2}; see
+	// Partition
+	Partitions map[string]int
+
+	// Logger receives the pool's log messages (default slog.Default())
+	Logger Logger
+
+	// Audit receives a record of every checkout and return, with the
+	// calling function, hold time and statements run, for tracing pool
+	// misuse in production (nil = no audit trail). See OpenAuditLog
+	Audit AuditSink
+
+	// Debug turns pool misuse, such as returning a connection twice, into a
+	// panic instead of an error, so the bug surfaces where it happens. It
+	// also tracks which goroutine holds each connection, so one that would
+	// block acquiring a second connection fails with ErrReentrantAcquire
+	// instead of possibly deadlocking
+	Debug bool
+}
+
+// Config describes how a Pool creates, checks and disposes of its connections
+type Config[T comparable] struct {
+	// Factory dials a new connection (required)
+	Factory func(ctx context.Context) (T, error)
+	// Validate probes a connection on checkout and in health checks
+	// (nil = connections are always considered healthy)
+	Validate func(ctx context.Context, conn T) error
+	// Close disposes of a connection the pool no longer needs (nil = drop it)
+	Close func(conn T) error
+	// Hooks run application code at connection lifecycle points
+	Hooks Hooks[T]
+	// Broken reports whether an error from using a connection means the
+	// connection itself is dead. With discards such connections instead of
+	// returning them to the pool (nil = never)
+	Broken func(err error) bool
+
+	Settings
+
+	// extraStats fills in Stats fields the generic pool doesn't track
+	extraStats func(stats *PoolStats)
+	// stale reports connections to replace, e.g. ones left on the old host
+	// after a failover. They are retired when returned and by retireStale
+	stale func(conn T) bool
+	// connMeta fills in ConnMeta fields the generic pool doesn't track
+	connMeta func(conn T, meta *ConnMeta)
+}
+
+// Pool is a connection pool built as a blocking queue. T is the connection
+// handle, e.g. *sql.DB, *grpc.ClientConn or net.Conn; the pool tracks
+// connections by value, so T must be comparable.
+//
+// Each connection moves through a small state machine:
+//
+//	dialing -> idle <-> in use -> closed
+//
+// Idle connections wait in a queue; callers that find it empty either dial a
+// new connection (while below MaxConns) or join a queue of waiters that are
+// handed connections directly, by priority and then arrival order, as they
+// are returned
+type Pool[T comparable] struct {
+	factory        func(ctx context.Context) (T, error)
+	validate       func(ctx context.Context, conn T) error
+	closeFn        func(conn T) error
+	hooks          Hooks[T]
+	broken         func(err error) bool
+	extraStats     func(stats *PoolStats)
+	stale          func(conn T) bool
+	connMeta       func(conn T, meta *ConnMeta)
+	minConns       int // Guarded by mu, as Resize can change it
+	maxConns       int // Guarded by mu, as Resize can change it
+	overflow       int
+	acquireTimeout atomic.Int64 // Nanoseconds; Reload can change it
+	maxWaiters     int
+
+	validateOnCheckout bool
+
+	healthCheckInterval  time.Duration
+	healthCheckThreshold int
+	maxConnLifetime      atomic.Int64 // Nanoseconds; Reload can change it
+	maxConnUses          int
+	maxIdleTime          time.Duration
+	keepaliveInterval    time.Duration
+
+	quarantineInterval    time.Duration
+	quarantineMaxInterval time.Duration
+
+	mu      sync.Mutex
+	conns   map[T]*connInfo // Bookkeeping for every connection the pool created
+	idle    []T             // Connections ready to hand out, oldest first
+	waiters waiterQueue[T]  // Callers blocked waiting for a connection
+	numOpen int             // Open connections plus ones being dialed (<= maxConns)
+	dialing int             // Background dials in flight for waiters or MinConns
+	// Connections out of rotation after failing probes (see quarantine),
+	// counted in numOpen and conns but not idle
+	quarantined int
+	state       atomic.Int32 // A poolState; only changed while holding mu
+
+	closeOnce sync.Once
+	drained   chan struct{} // Closed once the pool reaches poolClosed
+
+	paused       chan struct{} // Closed once a paused pool has no connections left
+	pauseDrained bool
+
+	degraded bool // Below MinConns after a partial start, until backfilled
+
+	middleware atomic.Pointer[[]Middleware[T]] // Set by Use
+
+	gate atomic.Pointer[pauseGate] // Set between Pause and Resume; changed while holding mu
+
+	// Bumped by Reload when connections must be redialed; ones dialed in an
+	// earlier generation are retired
+	generation atomic.Int64
+
+	// Backoff for background dials after failed ones (see redialFailedLocked)
+	reconnect      backoff
+	redialFailures int         // Consecutive failed replacement dials
+	redialAt       time.Time   // No background dials before this
+	redialTimer    *time.Timer // Retries the put off dials at redialAt
+
+	// Cumulative counters reported by Stats
+	acquireCount   int64
+	waitCount      int64
+	waitDuration   time.Duration
+	waitCounts     waitCounts
+	holdCount      int64         // Connections returned, for the auto-tuner
+	holdDuration   time.Duration // Total time connections were held
+	holdCounts     holdCounts
+	longHolds      int64
+	leasesExpired  int64
+	peakInUse      int // Most connections in use since the last auto-tune
+	connsCreated   int64
+	connsDestroyed int64
+	leaksDetected  int64
+	waitersShed    int64
+
+	sessionSetups        int64 // Checkouts that ran SessionSetup.Apply
+	sessionSetupsSkipped int64 // Checkouts whose connection was already set up
+
+	leakThreshold     time.Duration
+	longHoldThreshold time.Duration
+	leaseDuration     time.Duration
+	// Connections revoked by expireLease that their holders haven't
+	// returned yet, with when, kept for revokedRetention
+	revoked    map[T]time.Time
+	onLongHold func(LongHold)
+	debug      bool
+	logger     Logger
+	audit      AuditSink
+
+	breaker *circuitBreaker // nil unless CircuitBreakerThreshold is set
+	tuner   *autoTuner      // nil unless AutoTuneInterval is set
+
+	partitions map[string]*Partition[T] // Fixed at construction
+
+	metricsNamespace string
+	metrics          *poolMetrics // nil until EnableMetrics is called
+
+	events eventBus
+
+	stop chan struct{}  // Closed by Close to stop background goroutines
+	wg   sync.WaitGroup // Tracks background goroutines
+}
+
+// connState is where a connection is in its lifecycle
+type connState int
+
+const (
+	connIdle        connState = iota // Sitting in the idle queue
+	connInUse                        // Handed out to a caller
+	connChecking                     // Taken out of the idle queue by the health checker
+	connReturning                    // Being returned by Put
+	connForceClosed                  // Closed by Shutdown while still checked out
+	connQuarantined                  // Out of rotation until a re-probe succeeds
+)
+
+// connInfo is what the pool tracks about each connection it created
+type connInfo struct {
+	id         int64 // Sequential, for telling connections apart in logs and traces
+	state      connState
+	createdAt  time.Time
+	acquiredAt time.Time // When the connection was last handed to a caller
+	lastUsed   time.Time // When the connection was last returned to the pool
+	lastPinged time.Time // When a keepalive ping last succeeded
+	failures   int       // Consecutive failed health checks
+	// Delay before the last scheduled re-probe, while quarantined
+	quarantineDelay time.Duration
+	uses            int64  // Checkouts served
+	holder          string // WithHolder label of the current checkout
+
+	acquireSpan trace.SpanContext // Span of the current checkout, parent of its release span
+
+	acquireStack []byte // Stack of the goroutine that checked it out (leak detection only)
+	leakReported bool   // Whether the current checkout was already reported as a leak
+	// Whether the current checkout already triggered a long-hold alert
+	longHoldReported bool
+
+	// Lease of the current checkout (see LeaseDuration); lease is 0 if it
+	// has none
+	lease        time.Duration
+	leaseExpires time.Time
+	leaseTimer   *time.Timer
+
+	tokenIssued bool // Whether the current checkout must be returned with its Token
+
+	goroutine int64 // Goroutine that checked it out (Debug mode only)
+
+	// Statements the connection had run when checked out, so the audit
+	// trail can count the checkout's own (Audit only)
+	auditStatements int64
+
+	generation int64 // Pool generation it was dialed in (see Reload)
+
+	sessionKey string // SessionSetup key its session was last set up for
+}
+
+// New creates a pool from a Config, dialing MinConns connections up front
+// unless LazyConnect is set
+func New[T comparable](cfg Config[T]) (*Pool[T], error) {
+	if cfg.Factory == nil {
+		return nil, errors.New("pool Factory is required")
+	}
+	if err := checkSize(cfg.MinConns, cfg.MaxConns); err != nil {
+		return nil, err
+	}
+	if cfg.Overflow < 0 {
+		return nil, fmt.Errorf("Overflow must not be negative, got %d", cfg.Overflow)
+	}
+
+	pool := &Pool[T]{
+		factory:    cfg.Factory,
+		validate:   cfg.Validate,
+		closeFn:    cfg.Close,
+		hooks:      cfg.Hooks,
+		broken:     cfg.Broken,
+		extraStats: cfg.extraStats,
+		stale:      cfg.stale,
+		connMeta:   cfg.connMeta,
+		minConns:   cfg.MinConns,
+		maxConns:   cfg.MaxConns,
+		overflow:   cfg.Overflow,
+		maxWaiters: cfg.MaxWaiters,
+
+		validateOnCheckout: cfg.ValidateOnCheckout,
+
+		healthCheckInterval:   cfg.HealthCheckInterval,
+		healthCheckThreshold:  cfg.HealthCheckFailureThreshold,
+		maxConnUses:           cfg.MaxConnUses,
+		maxIdleTime:           cfg.MaxIdleTime,
+		keepaliveInterval:     cfg.KeepaliveInterval,
+		quarantineInterval:    cfg.QuarantineInterval,
+		quarantineMaxInterval: cfg.QuarantineMaxInterval,
+		reconnect:             newBackoff(cfg.ReconnectBackoff, cfg.ReconnectMaxBackoff),
+		conns:                 make(map[T]*connInfo),
+		waiters:               waiterQueue[T]{lifo: cfg.LIFOWaiters},
+		stop:                  make(chan struct{}),
+		drained:               make(chan struct{}),
+		metricsNamespace:      cfg.MetricsNamespace,
+		leakThreshold:         cfg.LeakDetectionThreshold,
+		longHoldThreshold:     cfg.LongHoldThreshold,
+		leaseDuration:         cfg.LeaseDuration,
+		revoked:               make(map[T]time.Time),
+		onLongHold:            cfg.OnLongHold,
+		debug:                 cfg.Debug,
+		audit:                 cfg.Audit,
+		logger:                defaultLogger(cfg.Logger),
+	}
+	pool.breaker = newCircuitBreaker(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown, pool.logger)
+	partitions, err := newPartitions(pool, cfg.Partitions)
+	if err != nil {
+		return nil, err
+	}
+	pool.partitions = partitions
+	if pool.metricsNamespace == "" {
+		pool.metricsNamespace = "pool"
+	}
+	if pool.healthCheckThreshold <= 0 {
+		pool.healthCheckThreshold = 1
+	}
+	if pool.quarantineMaxInterval <= 0 {
+		pool.quarantineMaxInterval = defaultQuarantineBackoff * pool.quarantineInterval
+	}
+	if pool.validate == nil {
+		pool.validate = func(ctx context.Context, conn T) error { return nil }
+	}
+	if pool.closeFn == nil {
+		pool.closeFn = func(conn T) error { return nil }
+	}
+	pool.acquireTimeout.Store(int64(cfg.AcquireTimeout))
+	pool.maxConnLifetime.Store(int64(cfg.MaxConnLifetime))
+
+	// Initialize the pool with MinConns connections; the rest are dialed on
+	// demand. Lazy pools dial everything on demand
+	initial := pool.minConns
+	if cfg.LazyConnect {
+		initial = 0
+		pool.logger.Info("Lazy pool: connections will be created on first use")
+	}
+	required := initial
+	if cfg.MinSuccessful > 0 && cfg.MinSuccessful < initial {
+		required = cfg.MinSuccessful
+	}
+	initBackoff := newBackoff(cfg.InitBackoff, cfg.InitMaxBackoff)
+	opened, initErr := pool.warmup(initial, cfg.WarmupConcurrency, cfg.InitRetries, initBackoff)
+	if opened < required {
+		pool.Close()
+		return nil, initErr
+	}
+	if opened < initial {
+		pool.logger.Warn("Pool starting degraded", "opened", opened, "wanted", initial, "error", initErr)
+		pool.degraded = true
+		pool.wg.Add(1)
+		go pool.backfillLoop(initBackoff)
+	}
+
+	if pool.healthCheckInterval > 0 {
+		pool.wg.Add(1)
+		go pool.healthCheckLoop()
+	}
+	if pool.maxIdleTime > 0 {
+		pool.wg.Add(1)
+		go pool.idleReaperLoop()
+	}
+	if pool.keepaliveInterval > 0 {
+		pool.wg.Add(1)
+		go pool.keepaliveLoop()
+	}
+	if cfg.AutoTuneInterval > 0 {
+		targetWait := cfg.AutoTuneTargetWait
+		if targetWait <= 0 {
+			targetWait = defaultAutoTuneTargetWait
+		}
+		pool.tuner = &autoTuner{ceiling: cfg.MaxConns, targetWait: targetWait}
+		pool.wg.Add(1)
+		go pool.autoTuneLoop(cfg.AutoTuneInterval)
+	}
+	if pool.leakThreshold > 0 {
+		pool.wg.Add(1)
+		go pool.leakDetectorLoop()
+	}
+	if pool.longHoldThreshold > 0 {
+		pool.wg.Add(1)
+		go pool.longHoldLoop()
+	}
+
+	return pool, nil
+}
+
+// Get retrieves a connection from the pool, blocking until one is available,
+// the context is cancelled, or the pool's AcquireTimeout expires
+func (p *Pool[T]) Get(ctx context.Context) (T, error) {
+	return p.GetWithPriority(ctx, PriorityNormal)
+}
+
+// GetWithPriority is Get for callers that should jump ahead of (or yield to)
+// others when the pool is saturated. Priority only orders blocked callers;
+// idle connections are handed out immediately
+func (p *Pool[T]) GetWithPriority(ctx context.Context, priority Priority) (T, error) {
+	return p.acquireThrough(ctx, func(ctx context.Context) (T, error) {
+		return p.get(ctx, priority, "", false)
+	})
+}
+
+// get acquires a connection for GetWithPriority and GetFor. With affine set,
+// the connection key hashes to is preferred if it is idle
+func (p *Pool[T]) get(ctx context.Context, priority Priority, key string, affine bool) (conn T, err error) {
+	ctx, span := tracer.Start(ctx, "pool.acquire", trace.WithAttributes(attrPriority.Int(int(priority))))
+	start := time.Now()
+	defer func() { p.endAcquireSpan(ctx, span, conn, time.Since(start), err) }()
+
+	// A nil channel never fires, so no AcquireTimeout means wait forever
+	var timeout <-chan time.Time
+	if d := time.Duration(p.acquireTimeout.Load()); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var zero T
+	p.logger.Debug("Requesting connection from pool")
+	if err := p.unavailable(); err != nil {
+		return zero, err
+	}
+	if err := p.waitUnpaused(ctx, timeout); err != nil {
+		return zero, err
+	}
+	if err := p.allowAcquire(ctx); err != nil {
+		return zero, err
+	}
+	var ok bool
+	var w *waiter[T]
+	if affine {
+		conn, ok = p.takeAffine(key)
+	}
+	if !ok {
+		conn, ok, w, err = p.acquireOrWait(ctx, priority)
+		if err != nil {
+			return zero, err
+		}
+	}
+	if !ok {
+		if conn, err = p.wait(ctx, w, timeout); err != nil {
+			return zero, err
+		}
+	}
+
+	p.logger.Debug("Connection acquired from pool")
+	conn, err = p.checkout(ctx, conn)
+	if err != nil {
+		return zero, err
+	}
+	if err := p.setupSession(ctx, conn); err != nil {
+		return zero, err
+	}
+	p.recordAcquire(ctx, conn, time.Since(start), w != nil)
+	p.runOnAcquire(ctx, conn)
+	return conn, nil
+}
+
+// wait blocks until a connection is returned to the pool and handed to this
+// waiter, or the context or AcquireTimeout gives up first
+func (p *Pool[T]) wait(ctx context.Context, w *waiter[T], timeout <-chan time.Time) (T, error) {
+	var zero T
+	select {
+	case conn, ok := <-w.ready:
+		if !ok {
+			// Woken by Close or Drain
+			if err := p.unavailable(); err != nil {
+				return zero, err
+			}
+			return zero, ErrPoolPaused // Already resumed again
+		}
+		return conn, nil
+	case <-ctx.Done():
+		// Caller gave up waiting; nothing was taken from the pool
+		p.cancelWait(w)
+		p.logger.Debug("Gave up waiting for connection", "error", ctx.Err())
+		return zero, ctx.Err()
+	case <-timeout:
+		p.cancelWait(w)
+		p.logger.Warn("No connection available before acquire timeout", "timeout", time.Duration(p.acquireTimeout.Load()))
+		p.emit(Event{Type: EventPoolExhausted, Err: ErrAcquireTimeout})
+		return zero, ErrAcquireTimeout
+	}
+}
+
+// TryGet retrieves a connection from the pool without waiting for one to be
+// returned. The second return value is false if every connection is in use
+// and the pool is already at MaxConns
+func (p *Pool[T]) TryGet() (T, bool) {
+	conn, err := p.acquireThrough(context.Background(), p.tryGet)
+	if err != nil {
+		var zero T
+		return zero, false
+	}
+	return conn, true
+}
+
+// tryGet acquires a connection for TryGet, failing with ErrPoolExhausted
+// rather than waiting
+func (p *Pool[T]) tryGet(ctx context.Context) (T, error) {
+	var zero T
+	if err := p.unavailable(); err != nil {
+		p.logger.Debug("Connection unavailable", "error", err)
+		return zero, err
+	}
+	if p.gate.Load() != nil {
+		p.logger.Debug("Connection unavailable", "error", ErrPoolPaused)
+		return zero, ErrPoolPaused
+	}
+	if err := p.allowAcquire(ctx); err != nil {
+		p.logger.Debug("Connection unavailable", "error", err)
+		return zero, err
+	}
+	conn, ok, err := p.acquire(ctx)
+	if err != nil {
+		p.logger.Warn("Connection unusable", "error", err)
+		return zero, err
+	}
+	if !ok {
+		// Pool exhausted; let the caller shed load instead of queuing
+		p.logger.Debug("No connection available in pool")
+		return zero, ErrPoolExhausted
+	}
+
+	p.logger.Debug("Connection acquired from pool")
+	conn, err = p.checkout(ctx, conn)
+	if err == nil {
+		err = p.setupSession(ctx, conn)
+	}
+	if err != nil {
+		p.logger.Warn("Connection unusable", "error", err)
+		return zero, err
+	}
+	p.recordAcquire(ctx, conn, 0, false)
+	p.runOnAcquire(ctx, conn)
+	return conn, nil
+}
+
+// acquire takes an idle connection or dials a new one if the pool is below
+// MaxConns. It reports false if the pool is exhausted
+func (p *Pool[T]) acquire(ctx context.Context) (T, bool, error) {
+	p.mu.Lock()
+	conn, ok, dial, err := p.acquireLocked()
+	p.mu.Unlock()
+	if !dial {
+		return conn, ok, err
+	}
+	conn, err = p.dialReserved(ctx)
+	return conn, err == nil, err
+}
+
+// acquireOrWait is like acquire, but registers a waiter instead of returning
+// empty-handed when the pool is exhausted
+func (p *Pool[T]) acquireOrWait(ctx context.Context, priority Priority) (T, bool, *waiter[T], error) {
+	var gid int64
+	if p.debug {
+		gid = goroutineID()
+	}
+	p.mu.Lock()
+	conn, ok, dial, err := p.acquireLocked()
+	if ok || dial || err != nil {
+		p.mu.Unlock()
+		if dial {
+			conn, err = p.dialReserved(ctx)
+			ok = err == nil
+		}
+		return conn, ok, nil, err
+	}
+	if p.maxWaiters > 0 && p.waiters.len() >= p.maxWaiters {
+		p.waitersShed++
+		p.mu.Unlock()
+		p.logger.Warn("Rejected acquisition, too many callers waiting", "max_waiters", p.maxWaiters)
+		p.emit(Event{Type: EventPoolExhausted, Err: ErrPoolExhausted})
+		return conn, false, nil, ErrPoolExhausted
+	}
+
+	if p.debug {
+		if err := p.reentrantLocked(gid); err != nil {
+			p.mu.Unlock()
+			return conn, false, nil, err
+		}
+	}
+
+	w := &waiter[T]{ready: make(chan T, 1), priority: priority, since: time.Now(), holder: holderFrom(ctx), goroutine: gid}
+	p.waiters.push(w)
+	waiting := p.waiters.len()
+	p.mu.Unlock()
+	p.emit(Event{Type: EventAcquireBlocked, Waiters: waiting})
+	return conn, false, w, nil
+}
+
+// acquireLocked pops an idle connection (ok = true), or reserves a slot for
+// dialing a new one (dial = true). Neither means the pool is exhausted.
+// Requires p.mu
+func (p *Pool[T]) acquireLocked() (conn T, ok, dial bool, err error) {
+	if err := p.unavailable(); err != nil {
+		return conn, false, false, err
+	}
+	if len(p.idle) > 0 {
+		conn = p.idle[0]
+		p.idle = p.idle[1:]
+		p.conns[conn].state = connInUse
+		return conn, true, false, nil
+	}
+	if p.numOpen < p.capacityLocked() {
+		p.numOpen++ // Reserve the slot before dialing outside the lock
+		return conn, false, true, nil
+	}
+	return conn, false, false, nil
+}
+
+// dialReserved dials a connection for a slot already reserved in numOpen,
+// releasing the slot if the dial fails
+func (p *Pool[T]) dialReserved(ctx context.Context) (T, error) {
+	conn, err := p.openConnection(ctx)
+	if err != nil {
+		p.releaseSlot()
+		return conn, fmt.Errorf("failed to open connection: %v", err)
+	}
+	p.logger.Debug("Dialed new connection to grow pool")
+	return conn, nil
+}
+
+// cancelWait removes a waiter that gave up. If a connection was handed to it
+// in the meantime, that connection goes back to the pool
+func (p *Pool[T]) cancelWait(w *waiter[T]) {
+	p.mu.Lock()
+	removed := p.waiters.remove(w)
+	p.mu.Unlock()
+	if removed {
+		return
+	}
+
+	// Lost the race: the pool already handed this waiter a connection
+	if conn, ok := <-w.ready; ok {
+		p.putConn(conn)
+	}
+}
+
+// checkout validates a connection just taken from the pool. A connection that
+// fails the probe is closed and replaced by a freshly dialed one
+func (p *Pool[T]) checkout(ctx context.Context, conn T) (T, error) {
+	if !p.validateOnCheckout {
+		return conn, nil
+	}
+
+	err := p.validate(ctx, conn)
+	p.ReportResult(err)
+	if err == nil {
+		return conn, nil
+	}
+	p.logger.Warn("Connection failed validation, replacing it", "error", err)
+
+	// The replacement takes over the broken connection's slot
+	p.closeConnection(conn)
+	replacement, err := p.openConnection(ctx)
+	if err != nil {
+		p.releaseSlot()
+		return replacement, fmt.Errorf("failed to replace broken connection: %v", err)
+	}
+	p.logger.Info("Broken connection replaced with a new one")
+	return replacement, nil
+}
+
+// openConnection dials a new connection with the Factory and starts tracking
+// it. The caller must already have reserved a slot in numOpen
+func (p *Pool[T]) openConnection(ctx context.Context) (T, error) {
+	// Read before dialing, so a dial racing a Reload counts as the old
+	// generation
+	generation := p.generation.Load()
+	conn, err := p.factory(ctx)
+	if err == nil {
+		err = p.runOnCreate(ctx, conn)
+	}
+	p.ReportResult(err)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	p.redialSucceededLocked()
+	p.connsCreated++
+	id := p.connsCreated
+	p.conns[conn] = &connInfo{id: id, state: connInUse, createdAt: now, lastUsed: now, generation: generation}
+	p.mu.Unlock()
+	p.emit(Event{Type: EventConnCreated, ConnID: id})
+	return conn, nil
+}
+
+// closeConnection closes a connection and forgets its bookkeeping. Its slot
+// stays reserved; call releaseSlot if it is not being replaced
+func (p *Pool[T]) closeConnection(conn T) {
+	var id int64
+	p.mu.Lock()
+	if info, ok := p.conns[conn]; ok {
+		id = info.id
+		delete(p.conns, conn)
+		p.connsDestroyed++
+	}
+	p.mu.Unlock()
+	p.destroy(conn, id)
+}
+
+// capacityLocked is how many connections may be open at once: MaxConns
+// plus Overflow. Requires p.mu
+func (p *Pool[T]) capacityLocked() int {
+	return p.maxConns + p.overflow
+}
+
+// releaseSlot gives up a slot in numOpen after its connection was closed or
+// could not be dialed
+func (p *Pool[T]) releaseSlot() {
+	p.mu.Lock()
+	p.numOpen--
+	p.maybeOpenNewConnectionsLocked()
+	p.signalDrainedLocked()
+	p.mu.Unlock()
+}
+
+// maybeOpenNewConnectionsLocked starts background dials for waiters that no
+// in-flight dial will serve, and to keep the pool at MinConns. Requires p.mu
+func (p *Pool[T]) maybeOpenNewConnectionsLocked() {
+	if p.unavailable() != nil {
+		return
+	}
+	want := p.waiters.len() - p.dialing
+	if belowMin := p.minConns - p.numOpen; belowMin > want {
+		want = belowMin
+	}
+	if want > 0 && p.numOpen < p.capacityLocked() && p.redialBackoffLocked() {
+		return
+	}
+	for ; want > 0 && p.numOpen < p.capacityLocked(); want-- {
+		p.numOpen++
+		p.dialing++
+		go p.openNewConnection()
+	}
+}
+
+// openNewConnection dials a connection in the background and puts it in the pool
+func (p *Pool[T]) openNewConnection() {
+	conn, err := p.openConnection(context.Background())
+
+	p.mu.Lock()
+	p.dialing--
+	if err != nil {
+		p.numOpen--
+		p.signalDrainedLocked()
+		wait := p.redialFailedLocked()
+		failures := p.redialFailures
+		p.mu.Unlock()
+		p.logger.Error("Failed to open replacement connection", "failures", failures, "retry_in", wait.Round(time.Millisecond), "error", err)
+		return
+	}
+	p.mu.Unlock()
+
+	p.putConn(conn)
+}
+
+// retireReason returns why a returned connection should be closed rather
+// than pooled: it outlived MaxConnLifetime, served MaxConnUses checkouts, is
+// stale or predates a Reload. It returns "" if the connection can be reused
+func (p *Pool[T]) retireReason(conn T) string {
+	lifetime := time.Duration(p.maxConnLifetime.Load())
+	generation := p.generation.Load()
+	if lifetime <= 0 && p.maxConnUses <= 0 && p.stale == nil && generation == 0 {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, ok := p.conns[conn]
+	switch {
+	case !ok:
+		return ""
+	case info.generation < generation:
+		return "reloaded"
+	case lifetime > 0 && time.Since(info.createdAt) > lifetime:
+		return "max lifetime"
+	case p.maxConnUses > 0 && info.uses >= int64(p.maxConnUses):
+		return "max uses"
+	case p.stale != nil && p.stale(conn):
+		return "stale"
+	}
+	return ""
+}
+
+// Put returns a connection back to the pool. Connections the pool did not
+// issue, or that are not checked out, are rejected with ErrForeignConnection
+// or ErrDoubleReturn (a panic in Debug mode); revoked ones with
+// ErrLeaseExpired
+func (p *Pool[T]) Put(conn T) error {
+	return p.releaseThrough(conn, func(conn T) error { return p.put(conn, nil) })
+}
+
+// put is Put, checking token if the connection was acquired with one
+func (p *Pool[T]) put(conn T, token *Token) (err error) {
+	if p.audit != nil {
+		defer func() {
+			if err != nil {
+				p.auditRejected(AuditRelease, conn, err)
+			}
+		}()
+	}
+	p.logger.Debug("Returning connection to pool")
+	span := p.startReleaseSpan(conn)
+	defer span.End()
+
+	p.mu.Lock()
+	info, ok := p.conns[conn]
+	if !ok {
+		revoked := p.takeRevokedLocked(conn)
+		p.mu.Unlock()
+		if revoked {
+			return ErrLeaseExpired
+		}
+		return p.misuse(ErrForeignConnection)
+	}
+	if info.state == connForceClosed {
+		// Shutdown already closed it; just give up the slot
+		delete(p.conns, conn)
+		p.mu.Unlock()
+		p.releaseSlot()
+		return nil
+	}
+	if info.state != connInUse {
+		p.mu.Unlock()
+		return p.misuse(ErrDoubleReturn)
+	}
+	if err := info.checkTokenLocked(token); err != nil {
+		p.mu.Unlock()
+		return p.misuse(err)
+	}
+	now := time.Now()
+	var audit AuditRecord
+	if p.audit != nil {
+		audit = p.auditReleaseLocked(AuditRelease, conn, info, now)
+	}
+	info.holder = ""
+	info.stopLeaseLocked()
+	p.observeHoldLocked(now.Sub(info.acquiredAt))
+	p.holdCounts.observe(now.Sub(info.acquiredAt))
+	p.holdCount++
+	p.holdDuration += now.Sub(info.acquiredAt)
+	info.lastUsed = now
+	info.state = connReturning // A concurrent second return is now rejected
+	p.mu.Unlock()
+	p.auditRecord(audit)
+	p.runOnRelease(conn)
+
+	if reason := p.retireReason(conn); reason != "" {
+		// Its slot is refilled with a fresh connection if anyone needs it
+		p.closeConnection(conn)
+		p.releaseSlot()
+		p.logger.Info("Recycled connection", "reason", reason)
+		return nil
+	}
+	p.putConn(conn)
+	return nil
+}
+
+// Discard is Put for a connection the caller found to be dead: it is closed
+// instead of pooled, and its slot is refilled if callers are waiting or the
+// pool is below MinConns
+func (p *Pool[T]) Discard(conn T) error {
+	return p.releaseThrough(conn, func(conn T) error { return p.discard(conn, nil) })
+}
+
+// discard is Discard, checking token if the connection was acquired with one
+func (p *Pool[T]) discard(conn T, token *Token) (err error) {
+	if p.audit != nil {
+		defer func() {
+			if err != nil {
+				p.auditRejected(AuditDiscard, conn, err)
+			}
+		}()
+	}
+	p.mu.Lock()
+	info, ok := p.conns[conn]
+	if !ok {
+		revoked := p.takeRevokedLocked(conn)
+		p.mu.Unlock()
+		if revoked {
+			return ErrLeaseExpired
+		}
+		return p.misuse(ErrForeignConnection)
+	}
+	if info.state == connForceClosed {
+		delete(p.conns, conn)
+		p.mu.Unlock()
+		p.releaseSlot()
+		return nil
+	}
+	if info.state != connInUse {
+		p.mu.Unlock()
+		return p.misuse(ErrDoubleReturn)
+	}
+	if err := info.checkTokenLocked(token); err != nil {
+		p.mu.Unlock()
+		return p.misuse(err)
+	}
+	var audit AuditRecord
+	if p.audit != nil {
+		audit = p.auditReleaseLocked(AuditDiscard, conn, info, time.Now())
+	}
+	info.state = connReturning
+	info.stopLeaseLocked()
+	p.mu.Unlock()
+	p.auditRecord(audit)
+	p.runOnRelease(conn)
+
+	p.closeConnection(conn)
+	p.releaseSlot()
+	p.logger.Info("Discarded broken connection")
+	return nil
+}
+
+// release gives back a connection a callback was using: it is discarded if
+// err shows it is broken, and put back otherwise
+func (p *Pool[T]) release(conn T, err error) error {
+	if err != nil && p.broken != nil && p.broken(err) {
+		return p.Discard(conn)
+	}
+	return p.Put(conn)
+}
+
+// misuse reports a caller bug detected by Put: it panics in Debug mode,
+// otherwise logs and returns err
+func (p *Pool[T]) misuse(err error) error {
+	if p.debug {
+		panic(err)
+	}
+	p.logger.Error("Rejected connection return", "error", err)
+	return err
+}
+
+// putConn hands a connection to the longest waiting caller, or parks it in
+// the idle queue if nobody is waiting
+func (p *Pool[T]) putConn(conn T) {
+	p.mu.Lock()
+	if p.unavailable() != nil || p.numOpen > p.capacityLocked() || p.conns[conn].generation < p.generation.Load() {
+		// Closed, paused, shrunk by Resize or dialed before a Reload: retire
+		// the connection instead
+		p.mu.Unlock()
+		p.closeConnection(conn)
+		p.releaseSlot()
+		return
+	}
+	if p.numOpen > p.maxConns && p.waiters.len() == 0 {
+		// An overflow connection outliving the spike it was opened for
+		p.mu.Unlock()
+		p.closeConnection(conn)
+		p.releaseSlot()
+		p.logger.Debug("Closed overflow connection")
+		return
+	}
+
+	info := p.conns[conn]
+	if w := p.waiters.pop(); w != nil {
+		info.state = connInUse
+		w.ready <- conn
+	} else {
+		info.state = connIdle
+		p.idle = append(p.idle, conn)
+	}
+	p.mu.Unlock()
+}
+
+// owns reports whether conn was issued by this pool and is still tracked
+func (p *Pool[T]) owns(conn T) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.conns[conn]
+	return ok
+}
@@ -0,0 +1,100 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrConnReleased is returned when a PooledConn is used after Release
+var ErrConnReleased = errors.New("pooled connection was already released")
+
+// PooledConn is a connection checked out with Acquire. Unlike a bare *sql.DB
+// it knows which pool it belongs to, can only be returned once, and refuses
+// to run statements after it has been returned
+type PooledConn struct {
+	pool *DBConnectionPool
+
+	mu sync.RWMutex // Held for reading by in-flight statements
+	db *sql.DB      // nil once released
+
+	broken atomic.Bool // A statement found the connection dead
+}
+
+// Acquire checks out a connection wrapped in a PooledConn. The caller must
+// call Release when done with it
+func (p *DBConnectionPool) Acquire(ctx context.Context) (*PooledConn, error) {
+	db, err := p.GetConnectionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &PooledConn{pool: p, db: db}, nil
+}
+
+// Release returns the connection to its pool, or discards it if a statement
+// found it dead. It waits for statements still running on the connection,
+// and is a no-op if already released
+func (c *PooledConn) Release() {
+	c.mu.Lock()
+	db := c.db
+	c.db = nil
+	c.mu.Unlock()
+
+	switch {
+	case db == nil:
+	case c.broken.Load():
+		c.pool.Discard(db)
+	default:
+		c.pool.PutConnection(db)
+	}
+}
+
+// Exec runs a statement that doesn't return rows
+func (c *PooledConn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext runs a statement that doesn't return rows
+func (c *PooledConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.db == nil {
+		return nil, ErrConnReleased
+	}
+	start := time.Now()
+	res, err := c.db.ExecContext(ctx, query, args...)
+	c.pool.logIfSlow(c.db, query, start, err)
+	c.report(err)
+	return res, err
+}
+
+// Query runs a statement that returns rows
+func (c *PooledConn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext runs a statement that returns rows
+func (c *PooledConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.db == nil {
+		return nil, ErrConnReleased
+	}
+	start := time.Now()
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	c.pool.logIfSlow(c.db, query, start, err)
+	c.report(err)
+	return rows, err
+}
+
+// report feeds a statement's outcome to the circuit breaker and remembers
+// whether it showed the connection to be dead
+func (c *PooledConn) report(err error) {
+	c.pool.ReportResult(err)
+	if isServerGone(err) {
+		c.broken.Store(true)
+	}
+}
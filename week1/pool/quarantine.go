@@ -0,0 +1,96 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// defaultQuarantineBackoff is how far QuarantineMaxInterval defaults to
+// beyond QuarantineInterval
+const defaultQuarantineBackoff = 32
+
+// quarantine takes a connection that keeps failing probes out of rotation
+// without closing it, and schedules a re-probe. The delay doubles every time
+// the same connection is quarantined again. Its slot stays taken, so a
+// flapping server doesn't churn the pool through dial-and-close cycles. The
+// caller must have taken conn out of the idle queue
+func (p *Pool[T]) quarantine(conn T) {
+	p.mu.Lock()
+	info, ok := p.conns[conn]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	if p.unavailable() != nil {
+		p.mu.Unlock()
+		p.closeConnection(conn)
+		p.releaseSlot()
+		return
+	}
+	delay := p.quarantineInterval
+	if info.quarantineDelay > 0 {
+		delay = min(2*info.quarantineDelay, p.quarantineMaxInterval)
+	}
+	info.quarantineDelay = delay
+	info.state = connQuarantined
+	p.quarantined++
+	id := info.id
+	p.mu.Unlock()
+
+	p.logger.Warn("Quarantined failing connection", "connection_id", id, "reprobe_in", delay)
+	time.AfterFunc(delay, func() { p.reprobe(conn) })
+}
+
+// reprobe probes a quarantined connection, returning it to the pool if it
+// has recovered and quarantining it for longer if not
+func (p *Pool[T]) reprobe(conn T) {
+	p.mu.Lock()
+	info, ok := p.conns[conn]
+	if !ok || info.state != connQuarantined {
+		p.mu.Unlock()
+		return // Closed by Drain or Shutdown meanwhile
+	}
+	info.state = connChecking
+	p.quarantined--
+	id := info.id
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.quarantineInterval)
+	err := p.validate(ctx, conn)
+	cancel()
+
+	p.mu.Lock()
+	if err == nil {
+		info.failures = 0
+		info.quarantineDelay = 0
+	} else {
+		info.failures++
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		p.emit(Event{Type: EventHealthCheckFailed, ConnID: id, Err: err})
+		p.quarantine(conn)
+		return
+	}
+	p.logger.Info("Quarantined connection recovered", "connection_id", id)
+	p.putConn(conn)
+}
+
+// takeQuarantinedLocked removes every quarantined connection from
+// quarantine, for Drain and Shutdown to close along with the idle ones.
+// Requires p.mu
+func (p *Pool[T]) takeQuarantinedLocked() []T {
+	if p.quarantined == 0 {
+		return nil
+	}
+	var taken []T
+	for conn, info := range p.conns {
+		if info.state == connQuarantined {
+			info.state = connIdle // Its pending re-probe is now a no-op
+			taken = append(taken, conn)
+		}
+	}
+	p.quarantined = 0
+	return taken
+}
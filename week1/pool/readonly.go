@@ -0,0 +1,18 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnly is returned when a write statement is run through the Exec
+// helpers of a ReadOnly pool
+var ErrReadOnly = errors.New("pool is read-only")
+
+// checkWritable rejects query if the pool is read-only and query writes
+func (p *DBConnectionPool) checkWritable(query string) error {
+	if p.readOnly && !isRead(query) {
+		return fmt.Errorf("%w: %s", ErrReadOnly, fingerprint(query))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package pool
+
+import "time"
+
+// redialBackoffLocked reports whether background dials are backing off after
+// failed replacement dials, making sure a retry is scheduled for when the
+// backoff ends. Requires p.mu
+func (p *Pool[T]) redialBackoffLocked() bool {
+	wait := time.Until(p.redialAt)
+	if wait <= 0 {
+		return false
+	}
+	if p.redialTimer == nil {
+		p.redialTimer = time.AfterFunc(wait, p.redialDue)
+	}
+	return true
+}
+
+// redialDue retries the background dials put off by redialBackoffLocked
+func (p *Pool[T]) redialDue() {
+	p.mu.Lock()
+	p.redialTimer = nil
+	p.maybeOpenNewConnectionsLocked()
+	p.mu.Unlock()
+}
+
+// redialFailedLocked counts a failed replacement dial and holds off further
+// background dials with jittered exponential backoff, so a recovering
+// database isn't hammered by every instance re-dialing at once. The retry
+// is scheduled even if nothing else happens in the meantime. It returns how
+// long dials are held off. Requires p.mu
+func (p *Pool[T]) redialFailedLocked() time.Duration {
+	wait := p.reconnect.delay(p.redialFailures)
+	p.redialFailures++
+	p.redialAt = time.Now().Add(wait)
+	p.redialBackoffLocked()
+	return wait
+}
+
+// redialSucceededLocked ends any backoff once a dial succeeds. Requires p.mu
+func (p *Pool[T]) redialSucceededLocked() {
+	p.redialFailures = 0
+	p.redialAt = time.Time{}
+}
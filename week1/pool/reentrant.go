@@ -0,0 +1,50 @@
+package pool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// ErrReentrantAcquire is returned in Debug mode when a goroutine that
+// already holds one of the pool's connections would block waiting for
+// another. With a small pool that wait can never end: the connection it is
+// waiting for is the one it holds
+var ErrReentrantAcquire = errors.New("goroutine already holds a connection from this pool")
+
+// goroutineID returns the current goroutine's ID, parsed from its stack
+// header ("goroutine 42 [running]:"). Only used in Debug mode; the runtime
+// doesn't expose it otherwise
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// reentrantLocked returns an ErrReentrantAcquire describing the connection
+// goroutine gid already holds, if any. Connections handed to another
+// goroutine after checkout still count as held by the acquiring one.
+// Requires p.mu
+func (p *Pool[T]) reentrantLocked(gid int64) error {
+	for _, info := range p.conns {
+		if info.state != connInUse || info.goroutine != gid {
+			continue
+		}
+		held := time.Since(info.acquiredAt).Round(time.Millisecond)
+		holder := ""
+		if info.holder != "" {
+			holder = fmt.Sprintf(", holder %q", info.holder)
+		}
+		return fmt.Errorf("%w and would block waiting for another (goroutine %d, connection %d%s, held %v); return it before acquiring again",
+			ErrReentrantAcquire, gid, info.id, holder, held)
+	}
+	return nil
+}
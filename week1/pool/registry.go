@@ -0,0 +1,149 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrNotRegistered is returned by Registry.Get for a name nothing was
+// registered under
+var ErrNotRegistered = errors.New("no pool registered under that name")
+
+// Registry is a set of named pools shared across a process, so packages can
+// look up "primary" or "replica" instead of having a pool passed through
+// every constructor. Most programs use the package-level functions, which
+// work on DefaultRegistry
+type Registry struct {
+	mu    sync.RWMutex
+	pools map[string]ConnectionPool
+}
+
+// DefaultRegistry is the registry used by Register, Get, Stats and
+// Shutdown
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{pools: make(map[string]ConnectionPool)}
+}
+
+// Register adds p under name. Names must be unique within the registry
+func (r *Registry) Register(name string, p ConnectionPool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pools[name]; ok {
+		return fmt.Errorf("pool %q is already registered", name)
+	}
+	r.pools[name] = p
+	return nil
+}
+
+// Unregister removes the pool registered under name, without closing it
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	delete(r.pools, name)
+	r.mu.Unlock()
+}
+
+// Get returns the pool registered under name. Type-assert it to reach
+// features beyond ConnectionPool, e.g. p.(*DBConnectionPool).Exec
+func (r *Registry) Get(name string) (ConnectionPool, error) {
+	r.mu.RLock()
+	p, ok := r.pools[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotRegistered, name)
+	}
+	return p, nil
+}
+
+// Names returns the registered names, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.pools))
+	for name := range r.pools {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Stats returns a snapshot of every registered pool, keyed by name
+func (r *Registry) Stats() map[string]PoolStats {
+	stats := make(map[string]PoolStats)
+	for name, p := range r.snapshot() {
+		stats[name] = p.Stats()
+	}
+	return stats
+}
+
+// Shutdown shuts down every registered pool in parallel, sharing one
+// deadline, and empties the registry. Pools with a Shutdown method drain
+// gracefully; others are closed. It returns the errors of the pools that
+// did not drain in time
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	pools := r.pools
+	r.pools = make(map[string]ConnectionPool)
+	r.mu.Unlock()
+
+	errs := make(chan error, len(pools))
+	var wg sync.WaitGroup
+	for name, p := range pools {
+		wg.Add(1)
+		go func(name string, p ConnectionPool) {
+			defer wg.Done()
+			s, ok := p.(interface{ Shutdown(context.Context) error })
+			if !ok {
+				p.Close()
+				return
+			}
+			if err := s.Shutdown(ctx); err != nil {
+				errs <- fmt.Errorf("%s: %w", name, err)
+			}
+		}(name, p)
+	}
+	wg.Wait()
+	close(errs)
+
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return errors.Join(all...)
+}
+
+// snapshot copies the registered pools so they can be used without r.mu
+func (r *Registry) snapshot() map[string]ConnectionPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pools := make(map[string]ConnectionPool, len(r.pools))
+	for name, p := range r.pools {
+		pools[name] = p
+	}
+	return pools
+}
+
+// Register adds p to DefaultRegistry under name
+func Register(name string, p ConnectionPool) error {
+	return DefaultRegistry.Register(name, p)
+}
+
+// Get returns the pool registered in DefaultRegistry under name
+func Get(name string) (ConnectionPool, error) {
+	return DefaultRegistry.Get(name)
+}
+
+// Stats returns a snapshot of every pool in DefaultRegistry
+func Stats() map[string]PoolStats {
+	return DefaultRegistry.Stats()
+}
+
+// Shutdown shuts down every pool in DefaultRegistry
+func Shutdown(ctx context.Context) error {
+	return DefaultRegistry.Shutdown(ctx)
+}
@@ -0,0 +1,193 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrReloadDSN is returned by DBConnectionPool.Reload when asked to change
+// the DSN of a pool that doesn't dial one, such as a connector or
+// multi-host pool
+var ErrReloadDSN = errors.New("pool was not created from a DSN, so its DSN can't be reloaded")
+
+// ErrReloadStatementTimeout is returned by DBConnectionPool.Reload when asked
+// to change the StatementTimeout of a pool dialing through the caller's
+// connector, whose sessions are set up when the pool is built
+var ErrReloadStatementTimeout = errors.New("pool dials through a connector, so its StatementTimeout can't be reloaded")
+
+// Reload applies new settings to the running pool: MinConns and MaxConns
+// change as with Resize, and AcquireTimeout and MaxConnLifetime apply from
+// the next acquisition and return. Other fields of s are fixed when the pool
+// is built and are ignored. Each reload is logged and emits
+// EventConfigReloaded
+func (p *Pool[T]) Reload(s Settings) error {
+	return p.reload(s, false)
+}
+
+// reload is Reload. With redial set, the way connections are dialed changed,
+// so every current connection is retired: idle ones right away, in-use ones
+// as they are returned
+func (p *Pool[T]) reload(s Settings, redial bool) error {
+	if err := checkSize(s.MinConns, s.MaxConns); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	if p.isClosed() {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	p.acquireTimeout.Store(int64(s.AcquireTimeout))
+	p.maxConnLifetime.Store(int64(s.MaxConnLifetime))
+	p.minConns = s.MinConns
+	if p.tuner != nil {
+		p.tuner.ceiling = s.MaxConns
+	}
+	// Shrinking may already close some idle connections, uncounted from
+	// numOpen; the rest of the old generation still hold their slots
+	shrunk := p.setMaxConnsLocked(s.MaxConns)
+	var old []T
+	if redial {
+		p.generation.Add(1)
+		old = p.idle
+		p.idle = nil
+	}
+	p.mu.Unlock()
+
+	for _, conn := range shrunk {
+		p.closeConnection(conn)
+	}
+	// Each released slot is redialed in the new generation as needed
+	for _, conn := range old {
+		p.closeConnection(conn)
+		p.releaseSlot()
+	}
+	p.logger.Info("Pool configuration reloaded", "min_conns", s.MinConns, "max_conns", s.MaxConns,
+		"acquire_timeout", s.AcquireTimeout, "max_conn_lifetime", s.MaxConnLifetime,
+		"redial", redial, "idle_retired", len(shrunk)+len(old))
+	p.emit(Event{Type: EventConfigReloaded})
+	return nil
+}
+
+// checkSize validates MinConns and MaxConns for New and Reload
+func checkSize(minConns, maxConns int) error {
+	if maxConns <= 0 {
+		return fmt.Errorf("MaxConns must be positive, got %d", maxConns)
+	}
+	if minConns < 0 || minConns > maxConns {
+		return fmt.Errorf("MinConns must be between 0 and MaxConns (%d), got %d", maxConns, minConns)
+	}
+	return nil
+}
+
+// redialer is how a pool dials its connections, when Reload can change it
+type redialer interface {
+	// retarget dials dsn (empty keeps the current one) with sessions timing
+	// statements out after statementTimeout from now on, and reports
+	// whether that changes anything
+	retarget(dsn string, statementTimeout time.Duration) (bool, error)
+	// sessionDefaults returns the settings new sessions are opened with
+	sessionDefaults() sessionSettings
+}
+
+// dsnDialer opens connections to a DSN that Reload can swap, e.g. to rotate
+// credentials
+type dsnDialer struct {
+	driverName string
+	target     atomic.Pointer[dsnTarget]
+}
+
+// dsnTarget is what a dsnDialer currently dials
+type dsnTarget struct {
+	dsn     string
+	session sessionSettings
+
+	// Set for NewMySQLPool's pools, which dial mysql rather than dsn
+	mysql     *mysql.Config
+	connector driver.Connector
+}
+
+func (d *dsnDialer) dial(ctx context.Context) (*sql.DB, error) {
+	t := d.target.Load()
+	if t.connector != nil {
+		return pingNew(ctx, sql.OpenDB(instrument(t.session.wrap(t.connector), connCountersFrom(ctx))))
+	}
+	return openDB(ctx, d.driverName, t.dsn, t.session)
+}
+
+func (d *dsnDialer) retarget(dsn string, statementTimeout time.Duration) (bool, error) {
+	cur := d.target.Load()
+	next := *cur
+	// ReadOnly also governs Exec and WithTx, so it can't change here
+	next.session.statementTimeout = statementTimeout
+	switch {
+	case dsn == "":
+	case cur.mysql != nil:
+		cfg, err := reloadedMySQLConfig(cur.mysql, dsn)
+		if err != nil {
+			return false, err
+		}
+		if cfg.FormatDSN() != cur.mysql.FormatDSN() {
+			if next.connector, err = mysql.NewConnector(cfg); err != nil {
+				return false, fmt.Errorf("invalid MySQL config: %v", err)
+			}
+			next.mysql = cfg
+		}
+	default:
+		if d.driverName == "mysql" {
+			if err := validateMySQLDSN(dsn); err != nil {
+				return false, err
+			}
+		}
+		next.dsn = dsn
+	}
+	if next == *cur {
+		return false, nil
+	}
+	d.target.Store(&next)
+	return true, nil
+}
+
+func (d *dsnDialer) sessionDefaults() sessionSettings {
+	return d.target.Load().session
+}
+
+// Reload applies cfg to the running pool without a restart. A new DSN or
+// StatementTimeout is used for connections dialed from now on, and the
+// existing ones are retired: idle ones right away, in-use ones as they are
+// returned. An empty cfg.DSN keeps the current one. For a NewMySQLPool
+// pool, the DSN is parsed into its mysql.Config, keeping what the DSN
+// leaves unset; for a failover pool, it replaces the primary's. The pool's
+// Settings change as with Pool.Reload; other fields of cfg are fixed when
+// the pool is built and are ignored. A DSN change fails with ErrReloadDSN
+// on a multi-host or connector pool, and a StatementTimeout change with
+// ErrReloadStatementTimeout on a connector pool. The DSN itself is never
+// logged
+func (p *DBConnectionPool) Reload(cfg DBConfig) error {
+	// Checked before swapping the DSN, so a rejected reload changes nothing
+	if err := checkSize(cfg.MinConns, cfg.MaxConns); err != nil {
+		return err
+	}
+	redial := false
+	if p.target == nil {
+		switch {
+		case cfg.DSN != "":
+			return ErrReloadDSN
+		case cfg.StatementTimeout != p.session.statementTimeout:
+			return ErrReloadStatementTimeout
+		}
+	} else {
+		var err error
+		if redial, err = p.target.retarget(cfg.DSN, cfg.StatementTimeout); err != nil {
+			return err
+		}
+	}
+	return p.Pool.reload(cfg.Settings, redial)
+}
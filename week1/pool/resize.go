@@ -0,0 +1,58 @@
+package pool
+
+import (
+	"fmt"
+)
+
+// Resize changes the pool's MaxConns while it is running, e.g. from an admin
+// endpoint. A fixed-size pool (MinConns == MaxConns) stays fixed-size and
+// dials the extra connections in the background; a dynamic pool dials them
+// as demand requires. Shrinking closes surplus idle connections immediately
+// and retires in-use ones as they are returned. With AutoTuneInterval set,
+// newSize becomes the ceiling the auto-tuner works under instead
+func (p *Pool[T]) Resize(newSize int) error {
+	if newSize <= 0 {
+		return fmt.Errorf("pool size must be positive, got %d", newSize)
+	}
+
+	p.mu.Lock()
+	if p.isClosed() {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	oldSize := p.maxConns
+	if p.minConns > newSize || (p.tuner == nil && p.minConns == p.maxConns) {
+		p.minConns = newSize
+	}
+	if p.tuner != nil {
+		p.tuner.ceiling = newSize
+	}
+	retired := p.setMaxConnsLocked(newSize)
+	p.mu.Unlock()
+
+	for _, conn := range retired {
+		p.closeConnection(conn)
+	}
+	p.logger.Info("Pool resized", "from", oldSize, "to", newSize, "idle_retired", len(retired))
+	return nil
+}
+
+// setMaxConnsLocked changes MaxConns, dialing for waiters when growing. It
+// returns the idle connections beyond the new size, already uncounted from
+// numOpen, for the caller to close outside the lock. Requires p.mu
+func (p *Pool[T]) setMaxConnsLocked(newSize int) []T {
+	p.maxConns = newSize
+
+	// Connections sitting idle beyond the new size can go right away
+	var retired []T
+	for p.numOpen > p.maxConns && len(p.idle) > 0 {
+		last := len(p.idle) - 1
+		retired = append(retired, p.idle[last])
+		p.idle = p.idle[:last]
+		p.numOpen--
+	}
+
+	// Growing: dial for callers already waiting, and up to MinConns
+	p.maybeOpenNewConnectionsLocked()
+	return retired
+}
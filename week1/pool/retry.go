@@ -0,0 +1,204 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// Defaults for Exec and Query retries
+const (
+	defaultExecRetryBackoff = 10 * time.Millisecond
+	maxExecRetryBackoff     = time.Second
+	defaultRetryBudgetRatio = 0.1
+	retryBudgetReserve      = 10 // Retries allowed before any calls have earned budget
+)
+
+// MySQL and Postgres error codes worth retrying
+const (
+	mysqlLockWaitTimeout  = 1205
+	mysqlDeadlock         = 1213
+	mysqlServerGone       = 2006 // CR_SERVER_GONE_ERROR: "MySQL server has gone away"
+	mysqlServerLost       = 2013 // CR_SERVER_LOST: lost connection during query
+	pgSerializationFailed = "40001"
+	pgDeadlockDetected    = "40P01"
+)
+
+// isTransient reports whether err is likely to go away if the statement is
+// simply run again: deadlocks, lock wait timeouts and dropped connections
+func isTransient(err error) bool {
+	if isServerGone(err) {
+		return true
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == mysqlDeadlock || myErr.Number == mysqlLockWaitTimeout
+	}
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgSerializationFailed || pgErr.Code == pgDeadlockDetected
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isServerGone reports whether err means the connection it came from is
+// dead, e.g. MySQL's "server has gone away", so it must not be pooled again
+func isServerGone(err error) bool {
+	if err == nil {
+		return false
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == mysqlServerGone || myErr.Number == mysqlServerLost
+	}
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn)
+}
+
+// retryBudget caps retries at a fraction of calls, so a struggling database
+// isn't hit with several times its normal load by retrying callers. Every
+// call earns ratio of a retry; every retry spends one
+type retryBudget struct {
+	ratio float64
+
+	mu        sync.Mutex
+	tokens    float64
+	retries   int64 // Retries made
+	exhausted int64 // Retries skipped because the budget was spent
+}
+
+// newRetryBudget returns a budget earning ratio retries per call
+func newRetryBudget(ratio float64) *retryBudget {
+	if ratio <= 0 {
+		ratio = defaultRetryBudgetRatio
+	}
+	return &retryBudget{ratio: ratio, tokens: retryBudgetReserve}
+}
+
+// earn credits the budget for a call
+func (b *retryBudget) earn() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > retryBudgetReserve {
+		b.tokens = retryBudgetReserve
+	}
+}
+
+// spend reports whether a retry may go ahead, charging it to the budget
+func (b *retryBudget) spend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		b.exhausted++
+		return false
+	}
+	b.tokens--
+	b.retries++
+	return true
+}
+
+// fillStats adds the budget's counters to a Stats snapshot
+func (b *retryBudget) fillStats(stats *PoolStats) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats.Retries = b.retries
+	stats.RetriesExhausted = b.exhausted
+}
+
+// withRetry runs op on a pooled connection, retrying transient errors on a
+// fresh acquisition with backoff, up to ExecRetries times and within the
+// retry budget. A connection found dead is discarded by WithConnection; with
+// RetryOnServerGone, the first such failure is retried straight away
+func (p *DBConnectionPool) withRetry(ctx context.Context, op func(db *sql.DB) error) error {
+	p.budget.earn()
+	reconnected := false
+	for attempt := 0; ; attempt++ {
+		err := p.WithConnection(ctx, func(db *sql.DB) error {
+			err := op(db)
+			if isTransient(err) {
+				p.ReportResult(err)
+			} else {
+				// Anything else, even a syntax error, means the server answered
+				p.ReportResult(nil)
+			}
+			return err
+		})
+		if err != nil && isServerGone(err) && p.retryServerGone && !reconnected {
+			reconnected = true
+			attempt-- // The reconnect doesn't count against ExecRetries
+			p.logger.Warn("Connection lost, retrying on a fresh one", "error", err)
+			continue
+		}
+		if err == nil || !isTransient(err) || attempt >= p.execRetries || !p.budget.spend() {
+			return err
+		}
+
+		wait := p.execBackoff.delay(attempt)
+		p.logger.Warn("Transient error, retrying", "attempt", attempt+1, "retry_in", wait.Round(time.Millisecond), "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Exec acquires a connection, runs a statement that doesn't return rows, and
+// returns the connection. Deadlocks, lock wait timeouts and dropped
+// connections are retried (see ExecRetries), so the statement must be safe
+// to run more than once
+func (p *DBConnectionPool) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if err := p.checkWritable(query); err != nil {
+		return nil, err
+	}
+	var res sql.Result
+	err := p.withRetry(ctx, func(db *sql.DB) error {
+		stmt, err := p.Stmt(ctx, db, query)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		res, err = stmt.ExecContext(ctx, args...)
+		p.logIfSlow(db, query, start, err)
+		return err
+	})
+	if err == nil {
+		p.mirror(query, args)
+	}
+	return res, err
+}
+
+// Query acquires a connection, runs a statement that returns rows, passes
+// them to fn and returns the connection once fn is done with them. The whole
+// call is retried like Exec, so fn may run more than once. For the slow query
+// log, the statement lasts until fn has read the rows
+func (p *DBConnectionPool) Query(ctx context.Context, fn func(rows *sql.Rows) error, query string, args ...any) error {
+	return p.withRetry(ctx, func(db *sql.DB) error {
+		stmt, err := p.Stmt(ctx, db, query)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		rows, err := stmt.QueryContext(ctx, args...)
+		if err != nil {
+			p.logIfSlow(db, query, start, err)
+			return err
+		}
+		defer rows.Close()
+		err = fn(rows)
+		if err == nil {
+			err = rows.Err()
+		}
+		p.logIfSlow(db, query, start, err)
+		return err
+	})
+}
@@ -0,0 +1,222 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// SemaphorePool is a deliberately small alternative to DBConnectionPool,
+// for comparing designs: a weighted semaphore with MaxConns permits caps how
+// many connections are checked out, and a mutex-guarded free list holds the
+// idle ones. Waiting, FIFO fairness and cancellation all come from the
+// semaphore, so there is no waiter queue to maintain, at the cost of
+// priorities, partitions, health checks and the rest of Pool's features.
+// It implements ConnectionPool, and cmd/bench compares it with the others
+type SemaphorePool struct {
+	sem            *semaphore.Weighted
+	dial           func(ctx context.Context) (*sql.DB, error)
+	maxConns       int
+	acquireTimeout time.Duration
+
+	mu     sync.Mutex
+	free   []*sql.DB        // Idle connections, most recently returned last
+	inUse  map[*sql.DB]bool // Checked out connections
+	closed bool
+
+	waiters      atomic.Int64
+	acquireCount atomic.Int64
+	waitCount    atomic.Int64
+	waitDuration atomic.Int64 // Nanoseconds
+	connsCreated atomic.Int64
+}
+
+var _ ConnectionPool = (*SemaphorePool)(nil)
+
+// NewSemaphorePool creates a SemaphorePool on dsn, dialing MinConns
+// connections up front. Of cfg, only DriverName, StatementTimeout, ReadOnly,
+// Hooks.OnCreate, MinConns, MaxConns and AcquireTimeout are used
+func NewSemaphorePool(dsn string, cfg PoolConfig) (*SemaphorePool, error) {
+	if cfg.MaxConns <= 0 {
+		return nil, errors.New("semaphore pool MaxConns must be positive")
+	}
+	driverName := cfg.DriverName
+	if driverName == "" {
+		driverName = "mysql"
+	}
+	if driverName == "mysql" {
+		if err := validateMySQLDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+	session := sessionSettingsOf(cfg)
+	onCreate := cfg.Hooks.OnCreate
+	p := &SemaphorePool{
+		sem: semaphore.NewWeighted(int64(cfg.MaxConns)),
+		dial: func(ctx context.Context) (*sql.DB, error) {
+			db, err := openDB(ctx, driverName, dsn, session)
+			if err == nil && onCreate != nil {
+				if err = onCreate(ctx, db); err != nil {
+					db.Close()
+				}
+			}
+			return db, err
+		},
+		maxConns:       cfg.MaxConns,
+		acquireTimeout: cfg.AcquireTimeout,
+		inUse:          make(map[*sql.DB]bool),
+	}
+	for i := 0; i < cfg.MinConns && i < cfg.MaxConns; i++ {
+		db, err := p.dial(context.Background())
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.connsCreated.Add(1)
+		p.free = append(p.free, db)
+	}
+	return p, nil
+}
+
+// GetConnection acquires a connection, waiting up to AcquireTimeout
+func (p *SemaphorePool) GetConnection() (*sql.DB, error) {
+	return p.GetConnectionContext(context.Background())
+}
+
+// GetConnectionContext acquires a permit, waiting until one is free, ctx
+// ends or AcquireTimeout passes, then takes an idle connection or dials one
+func (p *SemaphorePool) GetConnectionContext(ctx context.Context) (*sql.DB, error) {
+	if p.isClosed() {
+		return nil, ErrPoolClosed
+	}
+	start := time.Now()
+	if !p.sem.TryAcquire(1) {
+		if err := p.wait(ctx); err != nil {
+			return nil, err
+		}
+		p.waitCount.Add(1)
+		p.waitDuration.Add(int64(time.Since(start)))
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.sem.Release(1)
+		return nil, ErrPoolClosed
+	}
+	var db *sql.DB
+	if n := len(p.free); n > 0 {
+		db = p.free[n-1]
+		p.free = p.free[:n-1]
+	}
+	p.mu.Unlock()
+
+	if db == nil {
+		var err error
+		if db, err = p.dial(ctx); err != nil {
+			p.sem.Release(1)
+			return nil, err
+		}
+		p.connsCreated.Add(1)
+	}
+	p.mu.Lock()
+	p.inUse[db] = true
+	p.mu.Unlock()
+	p.acquireCount.Add(1)
+	return db, nil
+}
+
+// wait blocks for a permit, translating AcquireTimeout into ErrAcquireTimeout
+func (p *SemaphorePool) wait(ctx context.Context) error {
+	p.waiters.Add(1)
+	defer p.waiters.Add(-1)
+
+	waitCtx := ctx
+	if p.acquireTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, p.acquireTimeout)
+		defer cancel()
+	}
+	if err := p.sem.Acquire(waitCtx, 1); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrAcquireTimeout
+	}
+	return nil
+}
+
+// PutConnection returns a connection to the free list and its permit to
+// the semaphore. After Close, the connection is closed instead
+func (p *SemaphorePool) PutConnection(db *sql.DB) error {
+	p.mu.Lock()
+	if !p.inUse[db] {
+		p.mu.Unlock()
+		return ErrForeignConnection
+	}
+	delete(p.inUse, db)
+	closed := p.closed
+	if !closed {
+		p.free = append(p.free, db)
+	}
+	p.mu.Unlock()
+
+	if closed {
+		db.Close()
+	}
+	p.sem.Release(1)
+	return nil
+}
+
+// WithConnection acquires a connection, runs fn with it and returns it
+func (p *SemaphorePool) WithConnection(ctx context.Context, fn func(db *sql.DB) error) error {
+	db, err := p.GetConnectionContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.PutConnection(db)
+	return fn(db)
+}
+
+// Stats returns the pool's connection counts and acquisition counters
+func (p *SemaphorePool) Stats() PoolStats {
+	p.mu.Lock()
+	idle, inUse := len(p.free), len(p.inUse)
+	p.mu.Unlock()
+	return PoolStats{
+		MaxConns:     p.maxConns,
+		TotalConns:   idle + inUse,
+		IdleConns:    idle,
+		InUseConns:   inUse,
+		Waiters:      int(p.waiters.Load()),
+		AcquireCount: p.acquireCount.Load(),
+		WaitCount:    p.waitCount.Load(),
+		WaitDuration: time.Duration(p.waitDuration.Load()),
+		ConnsCreated: p.connsCreated.Load(),
+	}
+}
+
+// Close closes idle connections and fails further acquisitions with
+// ErrPoolClosed. Connections in use are closed as they are returned, which
+// is also when callers already waiting for a permit find the pool closed
+func (p *SemaphorePool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	free := p.free
+	p.free = nil
+	p.mu.Unlock()
+	for _, db := range free {
+		db.Close()
+	}
+}
+
+func (p *SemaphorePool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
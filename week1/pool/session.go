@@ -0,0 +1,125 @@
+package pool
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// sessionSettings are the PoolConfig settings applied to every server
+// session the pool opens, rather than once per *sql.DB handle, since each
+// handle may open several sessions
+type sessionSettings struct {
+	statementTimeout time.Duration
+	readOnly         bool
+}
+
+// sessionSettingsOf returns the session settings cfg asks for
+func sessionSettingsOf(cfg PoolConfig) sessionSettings {
+	return sessionSettings{statementTimeout: cfg.StatementTimeout, readOnly: cfg.ReadOnly}
+}
+
+// statements returns what to run on a new session of drv to apply s:
+//
+//   - Postgres: statement_timeout, for every statement, and
+//     default_transaction_read_only
+//   - MySQL: max_execution_time, which the server only applies to SELECTs,
+//     and SESSION TRANSACTION READ ONLY
+//
+// Other drivers get none
+func (s sessionSettings) statements(drv driver.Driver) []string {
+	var stmts []string
+	switch drv.(type) {
+	case *pq.Driver:
+		if s.statementTimeout > 0 {
+			stmts = append(stmts, fmt.Sprintf("SET statement_timeout = %d", s.statementTimeout.Milliseconds()))
+		}
+		if s.readOnly {
+			stmts = append(stmts, "SET default_transaction_read_only = on")
+		}
+	case *mysql.MySQLDriver:
+		if s.statementTimeout > 0 {
+			stmts = append(stmts, fmt.Sprintf("SET SESSION max_execution_time = %d", s.statementTimeout.Milliseconds()))
+		}
+		if s.readOnly {
+			stmts = append(stmts, "SET SESSION TRANSACTION READ ONLY")
+		}
+	}
+	return stmts
+}
+
+// wrap returns connector set up to apply s to each session it opens, or
+// connector itself if there is nothing to apply
+func (s sessionSettings) wrap(connector driver.Connector) driver.Connector {
+	stmts := s.statements(connector.Driver())
+	if len(stmts) == 0 {
+		return connector
+	}
+	return sessionInitConnector{Connector: connector, init: stmts}
+}
+
+// sessionInitConnector runs statements on every server session its
+// connector opens, before database/sql gets to use it
+type sessionInitConnector struct {
+	driver.Connector
+	init []string
+}
+
+// Connect opens a session and runs the init statements on it
+func (c sessionInitConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range c.init {
+		if err := execSession(ctx, conn, stmt); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to initialize session: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// execSession runs a statement without arguments directly on a driver
+// connection
+func execSession(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if s, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = s.ExecContext(ctx, nil)
+	} else {
+		_, err = stmt.Exec(nil)
+	}
+	return err
+}
+
+// dsnConnector returns a connector dialing dsn with drv, for drivers that
+// don't provide one themselves
+func dsnConnector(drv driver.Driver, dsn string) (driver.Connector, error) {
+	if d, ok := drv.(driver.DriverContext); ok {
+		return d.OpenConnector(dsn)
+	}
+	return legacyConnector{drv: drv, dsn: dsn}, nil
+}
+
+// legacyConnector adapts a driver without driver.DriverContext
+type legacyConnector struct {
+	drv driver.Driver
+	dsn string
+}
+
+func (c legacyConnector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+func (c legacyConnector) Driver() driver.Driver                        { return c.drv }
@@ -0,0 +1,94 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// SessionPool pools dedicated database sessions: each slot is one *sql.Conn,
+// a single server connection reserved for the pool. Unlike DBConnectionPool,
+// whose *sql.DB handles are each a pool of their own, a caller gets exactly
+// one session, so session state (SET variables, temporary tables, user
+// locks) persists across statements and checkouts, and MaxConns is the
+// number of server connections
+type SessionPool struct {
+	*Pool[*sql.Conn]
+	db *sql.DB // Dials the sessions; retains none of its own
+}
+
+// NewSessionPool creates a pool of dedicated sessions on dsn. It uses cfg's
+// DriverName, ValidationQuery, ValidationTimeout, StatementTimeout, ReadOnly,
+// SessionHooks and Settings; options that work on *sql.DB handles (Validate,
+// Hooks, the Exec helpers' settings) don't apply
+func NewSessionPool(dsn string, cfg PoolConfig) (*SessionPool, error) {
+	driverName := cfg.DriverName
+	if driverName == "" {
+		driverName = "mysql"
+	}
+	if driverName == "mysql" {
+		if err := validateMySQLDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MaxConns <= 0 {
+		return nil, errors.New("session pool MaxConns must be positive")
+	}
+	db, err := openDB(context.Background(), driverName, dsn, sessionSettingsOf(cfg))
+	if err != nil {
+		return nil, err
+	}
+	// The pool owns session lifetimes: sql.DB must never hold sessions idle
+	// or retire them behind its back, and a session the pool closes must
+	// really be closed instead of going back to sql.DB
+	db.SetMaxOpenConns(cfg.MaxConns)
+	db.SetMaxIdleConns(-1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	query := cfg.ValidationQuery
+	if query == "" {
+		query = defaultValidationQuery
+	}
+	validate := func(ctx context.Context, conn *sql.Conn) error {
+		if timeout := cfg.ValidationTimeout; timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		_, err := conn.ExecContext(ctx, query)
+		return err
+	}
+	settings := cfg.Settings
+	if settings.MetricsNamespace == "" {
+		settings.MetricsNamespace = "sessionpool"
+	}
+	pool, err := New(Config[*sql.Conn]{
+		Factory:  db.Conn,
+		Validate: validate,
+		Close:    func(conn *sql.Conn) error { return conn.Close() },
+		Hooks:    cfg.SessionHooks,
+		Broken:   isServerGone,
+		Settings: settings,
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SessionPool{Pool: pool, db: db}, nil
+}
+
+// Close closes the pool and the sessions it holds, without waiting for
+// sessions still in use; those are closed as they are returned
+func (p *SessionPool) Close() {
+	p.Pool.Close()
+	p.db.Close()
+}
+
+// Shutdown closes the pool gracefully, like Pool.Shutdown, then releases
+// the handle the sessions were dialed through
+func (p *SessionPool) Shutdown(ctx context.Context) error {
+	err := p.Pool.Shutdown(ctx)
+	p.db.Close()
+	return err
+}
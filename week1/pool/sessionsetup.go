@@ -0,0 +1,78 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// SessionSetup prepares a connection's session for each checkout, e.g.
+// SET time_zone, SET SESSION sql_mode or a tenant variable. The pool
+// remembers which state each connection was last left in, and only runs
+// Apply when a checkout needs a different one, so a connection reused by
+// the same tenant costs no extra round trip. It only makes sense for
+// connections that are a single session, as in SessionPool
+type SessionSetup[T comparable] struct {
+	// Key names the session state a checkout needs, e.g. "tenant=42" from a
+	// value in ctx, or a constant for setup every checkout shares. An empty
+	// key needs no setup and leaves the connection as it was
+	Key func(ctx context.Context) string
+	// Apply puts conn in the state key names. An error discards the
+	// connection, whose session is then in an unknown state, and fails the
+	// acquisition
+	Apply func(ctx context.Context, conn T, key string) error
+}
+
+// SessionStatements returns a SessionSetup for SessionPool that runs stmts,
+// e.g. "SET time_zone = '+00:00'", once on each session rather than on every
+// checkout
+func SessionStatements(stmts ...string) *SessionSetup[*sql.Conn] {
+	key := strings.Join(stmts, ";")
+	return &SessionSetup[*sql.Conn]{
+		Key: func(context.Context) string { return key },
+		Apply: func(ctx context.Context, conn *sql.Conn, _ string) error {
+			for _, stmt := range stmts {
+				if _, err := conn.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// setupSession runs the SessionSetup hook, if any, on a connection just
+// checked out, unless it is already in the state the checkout needs
+func (p *Pool[T]) setupSession(ctx context.Context, conn T) error {
+	setup := p.hooks.Session
+	if setup == nil {
+		return nil
+	}
+	key := setup.Key(ctx)
+	if key == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	info, ok := p.conns[conn]
+	if ok && info.sessionKey == key {
+		p.sessionSetupsSkipped++
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.Unlock()
+
+	if err := setup.Apply(ctx, conn, key); err != nil {
+		p.logger.Warn("Session setup failed, discarding connection", "key", key, "error", err)
+		p.closeConnection(conn)
+		p.releaseSlot()
+		return err
+	}
+	p.mu.Lock()
+	if info, ok := p.conns[conn]; ok {
+		info.sessionKey = key
+	}
+	p.sessionSetups++
+	p.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,216 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for ShadowOptions
+const (
+	defaultShadowQueueSize = 1024
+	defaultShadowWorkers   = 2
+	defaultShadowTimeout   = 5 * time.Second
+)
+
+// ShadowOptions configures how EnableShadow mirrors writes
+type ShadowOptions struct {
+	// SampleRate is the fraction of writes mirrored, from 0 to 1 (default 1)
+	SampleRate float64
+	// QueueSize is how many mirrored writes may wait for the shadow before
+	// further ones are dropped (default 1024)
+	QueueSize int
+	// Workers is how many goroutines replay writes on the shadow (default 2)
+	Workers int
+	// Timeout bounds each mirrored write (default 5s)
+	Timeout time.Duration
+}
+
+// shadowMirror replays sampled writes on a shadow pool in the background
+type shadowMirror struct {
+	shadow  *DBConnectionPool
+	rate    float64
+	timeout time.Duration
+	queue   chan shadowWrite
+	done    chan struct{} // Closed by DisableShadow to stop the workers
+
+	mirrored atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+}
+
+// shadowWrite is one statement waiting to be mirrored
+type shadowWrite struct {
+	query string
+	args  []any
+}
+
+// shadowSlot holds a pool's current mirror, if any, so it can be enabled
+// and disabled at runtime
+type shadowSlot struct {
+	current atomic.Pointer[shadowMirror]
+}
+
+// EnableShadow starts mirroring the writes made through Exec and
+// ExecWithDeadline to shadow, e.g. a new schema under test, for a dark
+// launch. Only statements that succeeded on this pool are mirrored, after
+// they return, and in the background: a slow or failing shadow never delays
+// or fails the caller. Writes are dropped rather than queued without bound
+// when the shadow can't keep up. Mirroring stops when this pool is closed
+func (p *DBConnectionPool) EnableShadow(shadow *DBConnectionPool, opts ShadowOptions) error {
+	if shadow == nil || shadow == p {
+		return errors.New("shadow must be a different pool")
+	}
+	rate := opts.SampleRate
+	if rate <= 0 || rate > 1 {
+		rate = 1
+	}
+	queueSize := opts.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultShadowQueueSize
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultShadowWorkers
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultShadowTimeout
+	}
+
+	m := &shadowMirror{
+		shadow:  shadow,
+		rate:    rate,
+		timeout: timeout,
+		queue:   make(chan shadowWrite, queueSize),
+		done:    make(chan struct{}),
+	}
+	if !p.shadows.current.CompareAndSwap(nil, m) {
+		return errors.New("shadow already enabled")
+	}
+	for i := 0; i < workers; i++ {
+		go p.shadowWorker(m)
+	}
+	p.logger.Info("Mirroring writes to shadow pool", "sample_rate", rate)
+	return nil
+}
+
+// DisableShadow stops mirroring writes. Writes still queued are discarded
+func (p *DBConnectionPool) DisableShadow() {
+	if m := p.shadows.current.Swap(nil); m != nil {
+		close(m.done)
+	}
+}
+
+// mirror queues a write that succeeded on this pool for the shadow, if
+// mirroring is on and the write is sampled
+func (p *DBConnectionPool) mirror(query string, args []any) {
+	m := p.shadows.current.Load()
+	if m == nil || isRead(query) || (m.rate < 1 && rand.Float64() >= m.rate) {
+		return
+	}
+	select {
+	case m.queue <- shadowWrite{query: query, args: args}:
+	default:
+		m.dropped.Add(1)
+	}
+}
+
+// shadowWorker replays queued writes on the shadow until mirroring is
+// disabled or this pool is closed
+func (p *DBConnectionPool) shadowWorker(m *shadowMirror) {
+	for {
+		select {
+		case w := <-m.queue:
+			ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+			_, err := m.shadow.Exec(ctx, w.query, w.args...)
+			cancel()
+			if err != nil {
+				m.failed.Add(1)
+				p.logger.Debug("Shadow write failed", "query", fingerprint(w.query), "error", err)
+				continue
+			}
+			m.mirrored.Add(1)
+		case <-m.done:
+			return
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// fillStats adds the mirror's counters to a Stats snapshot
+func (s *shadowSlot) fillStats(stats *PoolStats) {
+	if m := s.current.Load(); m != nil {
+		stats.ShadowMirrored = m.mirrored.Load()
+		stats.ShadowDropped = m.dropped.Load()
+		stats.ShadowFailed = m.failed.Load()
+	}
+}
+
+// readKeywords start statements that only read. WITH does too, unless a
+// writeKeyword follows, as in WITH ... DELETE
+var readKeywords = map[string]bool{
+	"SELECT": true, "SHOW": true, "EXPLAIN": true, "DESCRIBE": true, "DESC": true,
+	"WITH": true, "VALUES": true, "TABLE": true,
+}
+
+var writeKeywords = map[string]bool{"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "REPLACE": true}
+
+// isRead reports whether a statement only reads, so there is nothing to
+// mirror and a ReadOnly pool may run it. Whitespace, comments and
+// parentheses ahead of the first keyword are skipped. A ReadOnly pool's
+// sessions are read-only on the server too, so this only needs to catch
+// the obvious writes
+func isRead(query string) bool {
+	query = skipLeading(query)
+	end := strings.IndexFunc(query, func(r rune) bool { return !isKeywordChar(r) })
+	if end < 0 {
+		end = len(query)
+	}
+	if end == 0 {
+		return true
+	}
+	switch keyword := strings.ToUpper(query[:end]); keyword {
+	case "WITH":
+		// Literals are masked first, so a 'delete' in a string doesn't count
+		for _, word := range strings.FieldsFunc(fingerprint(query), func(r rune) bool { return !isKeywordChar(r) }) {
+			if writeKeywords[strings.ToUpper(word)] {
+				return false
+			}
+		}
+		return true
+	default:
+		return readKeywords[keyword]
+	}
+}
+
+// skipLeading strips the whitespace, comments (/* */, -- and MySQL's #)
+// and opening parentheses ahead of a statement's first keyword
+func skipLeading(query string) string {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n(")
+		var end int
+		switch {
+		case strings.HasPrefix(query, "/*"):
+			if end = strings.Index(query[2:], "*/"); end < 0 {
+				return ""
+			}
+			end += len("/**/")
+		case strings.HasPrefix(query, "--"), strings.HasPrefix(query, "#"):
+			if end = strings.IndexByte(query, '\n'); end < 0 {
+				return ""
+			}
+		default:
+			return query
+		}
+		query = query[end:]
+	}
+}
+
+func isKeywordChar(r rune) bool {
+	return r == '_' || (r|0x20 >= 'a' && r|0x20 <= 'z') || (r >= '0' && r <= '9')
+}
@@ -0,0 +1,359 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/maphash"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShardedPool is a variant of SemaphorePool for high goroutine counts, where
+// a single lock around the free list becomes the contention point. Idle
+// connections are spread over several shards, each with its own lock; an
+// acquisition tries its home shard first and steals from the others on a
+// miss, so concurrent callers mostly touch different locks. The home shard
+// is picked by hashing the key set with WithShardKey, or at random when there
+// is none, since Go offers no cheap goroutine identity to hash instead.
+// Waiting is not FIFO: a returned connection wakes one waiter, which then
+// competes with new arrivals for it. It implements ConnectionPool, and
+// cmd/bench compares it with the others
+type ShardedPool struct {
+	shards         []*shard
+	home           sync.Map // *sql.DB -> *shard that owns it
+	dial           func(ctx context.Context) (*sql.DB, error)
+	maxConns       int
+	acquireTimeout time.Duration
+	seed           maphash.Seed
+
+	open    atomic.Int64  // Connections dialed and not yet closed
+	wake    chan struct{} // Holds a token while a returned connection may have no taker
+	done    chan struct{} // Closed by Close to release waiters
+	closing sync.Once
+	closed  atomic.Bool
+
+	waiters      atomic.Int64
+	acquireCount atomic.Int64
+	waitCount    atomic.Int64
+	waitDuration atomic.Int64 // Nanoseconds
+	connsCreated atomic.Int64
+	steals       atomic.Int64
+}
+
+// shard is one slice of a ShardedPool's connections
+type shard struct {
+	mu    sync.Mutex
+	free  []*sql.DB        // Idle connections owned by this shard
+	inUse map[*sql.DB]bool // Checked out connections owned by this shard
+	_     [24]byte         // Pads the shard to a cache line so neighbouring locks don't share one
+}
+
+var _ ConnectionPool = (*ShardedPool)(nil)
+
+type shardKeyKey struct{}
+
+// WithShardKey returns a context whose acquisitions from a ShardedPool start
+// at the shard key hashes to, so callers sharing a key tend to reuse the
+// same connections
+func WithShardKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, shardKeyKey{}, key)
+}
+
+// NewShardedPool creates a ShardedPool on dsn with the given number of
+// shards, GOMAXPROCS if shards is not positive, dialing MinConns connections
+// up front. Of cfg, the same fields as NewSemaphorePool are used
+func NewShardedPool(dsn string, cfg PoolConfig, shards int) (*ShardedPool, error) {
+	if cfg.MaxConns <= 0 {
+		return nil, errors.New("sharded pool MaxConns must be positive")
+	}
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	shards = min(shards, cfg.MaxConns)
+	driverName := cfg.DriverName
+	if driverName == "" {
+		driverName = "mysql"
+	}
+	if driverName == "mysql" {
+		if err := validateMySQLDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+	session := sessionSettingsOf(cfg)
+	onCreate := cfg.Hooks.OnCreate
+	p := &ShardedPool{
+		shards: make([]*shard, shards),
+		dial: func(ctx context.Context) (*sql.DB, error) {
+			db, err := openDB(ctx, driverName, dsn, session)
+			if err == nil && onCreate != nil {
+				if err = onCreate(ctx, db); err != nil {
+					db.Close()
+				}
+			}
+			return db, err
+		},
+		maxConns:       cfg.MaxConns,
+		acquireTimeout: cfg.AcquireTimeout,
+		seed:           maphash.MakeSeed(),
+		wake:           make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
+	for i := range p.shards {
+		p.shards[i] = &shard{inUse: make(map[*sql.DB]bool)}
+	}
+	// Spread the initial connections round-robin so every shard starts warm
+	for i := 0; i < cfg.MinConns && i < cfg.MaxConns; i++ {
+		s := p.shards[i%len(p.shards)]
+		db, err := p.dial(context.Background())
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.open.Add(1)
+		p.connsCreated.Add(1)
+		p.home.Store(db, s)
+		s.free = append(s.free, db)
+	}
+	return p, nil
+}
+
+// GetConnection acquires a connection, waiting up to AcquireTimeout
+func (p *ShardedPool) GetConnection() (*sql.DB, error) {
+	return p.GetConnectionContext(context.Background())
+}
+
+// GetConnectionContext takes an idle connection from the caller's home
+// shard, then from any other shard, then dials one if the pool is below
+// MaxConns; otherwise it waits until a connection is returned, ctx ends or
+// AcquireTimeout passes
+func (p *ShardedPool) GetConnectionContext(ctx context.Context) (*sql.DB, error) {
+	if p.closed.Load() {
+		return nil, ErrPoolClosed
+	}
+	start := p.homeShard(ctx)
+	if db := p.take(start); db != nil {
+		p.acquireCount.Add(1)
+		return db, nil
+	}
+	if p.reserve() {
+		db, err := p.dialInto(ctx, p.shards[start])
+		if err != nil {
+			return nil, err
+		}
+		p.acquireCount.Add(1)
+		return db, nil
+	}
+
+	began := time.Now()
+	db, err := p.wait(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	p.waitCount.Add(1)
+	p.waitDuration.Add(int64(time.Since(began)))
+	p.acquireCount.Add(1)
+	return db, nil
+}
+
+// homeShard picks the shard an acquisition starts at
+func (p *ShardedPool) homeShard(ctx context.Context) int {
+	if key, ok := ctx.Value(shardKeyKey{}).(string); ok {
+		return int(maphash.String(p.seed, key) % uint64(len(p.shards)))
+	}
+	return rand.Intn(len(p.shards))
+}
+
+// take pops an idle connection, trying shard start first and stealing from
+// the others in turn if it is empty
+func (p *ShardedPool) take(start int) *sql.DB {
+	for i := range p.shards {
+		s := p.shards[(start+i)%len(p.shards)]
+		s.mu.Lock()
+		if n := len(s.free); n > 0 {
+			db := s.free[n-1]
+			s.free = s.free[:n-1]
+			s.inUse[db] = true
+			s.mu.Unlock()
+			if i > 0 {
+				p.steals.Add(1)
+			}
+			return db
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// reserve claims room for one more connection if the pool is below MaxConns
+func (p *ShardedPool) reserve() bool {
+	for {
+		n := p.open.Load()
+		if n >= int64(p.maxConns) {
+			return false
+		}
+		if p.open.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// dialInto dials a connection owned by s, releasing the reservation if the
+// dial fails
+func (p *ShardedPool) dialInto(ctx context.Context, s *shard) (*sql.DB, error) {
+	db, err := p.dial(ctx)
+	if err != nil {
+		p.open.Add(-1)
+		p.signal()
+		return nil, err
+	}
+	p.connsCreated.Add(1)
+	p.home.Store(db, s)
+	s.mu.Lock()
+	s.inUse[db] = true
+	s.mu.Unlock()
+	if p.closed.Load() {
+		p.PutConnection(db)
+		return nil, ErrPoolClosed
+	}
+	return db, nil
+}
+
+// wait blocks until a connection can be taken, translating AcquireTimeout
+// into ErrAcquireTimeout. The waiter registers before re-checking the
+// shards, so a connection returned in between leaves a wake token behind
+func (p *ShardedPool) wait(ctx context.Context, start int) (*sql.DB, error) {
+	p.waiters.Add(1)
+	defer p.waiters.Add(-1)
+
+	var timeout <-chan time.Time
+	if p.acquireTimeout > 0 {
+		t := time.NewTimer(p.acquireTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		if db := p.take(start); db != nil {
+			// Others may be waiting on connections returned alongside this one
+			if p.waiters.Load() > 1 {
+				p.signal()
+			}
+			return db, nil
+		}
+		if p.reserve() {
+			return p.dialInto(ctx, p.shards[start])
+		}
+		select {
+		case <-p.wake:
+		case <-p.done:
+			return nil, ErrPoolClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, ErrAcquireTimeout
+		}
+	}
+}
+
+// signal wakes one waiter, if any, to look for a connection
+func (p *ShardedPool) signal() {
+	if p.waiters.Load() == 0 {
+		return
+	}
+	select {
+	case p.wake <- struct{}{}:
+	default: // A wakeup is already pending
+	}
+}
+
+// PutConnection returns a connection to the shard that owns it and wakes a
+// waiter. After Close, the connection is closed instead
+func (p *ShardedPool) PutConnection(db *sql.DB) error {
+	v, ok := p.home.Load(db)
+	if !ok {
+		return ErrForeignConnection
+	}
+	s := v.(*shard)
+	s.mu.Lock()
+	if !s.inUse[db] {
+		s.mu.Unlock()
+		return ErrForeignConnection
+	}
+	delete(s.inUse, db)
+	closed := p.closed.Load()
+	if !closed {
+		s.free = append(s.free, db)
+	}
+	s.mu.Unlock()
+
+	if closed {
+		p.home.Delete(db)
+		p.open.Add(-1)
+		db.Close()
+		return nil
+	}
+	p.signal()
+	return nil
+}
+
+// WithConnection acquires a connection, runs fn with it and returns it
+func (p *ShardedPool) WithConnection(ctx context.Context, fn func(db *sql.DB) error) error {
+	db, err := p.GetConnectionContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.PutConnection(db)
+	return fn(db)
+}
+
+// Stats returns the pool's connection counts and acquisition counters
+func (p *ShardedPool) Stats() PoolStats {
+	var idle, inUse int
+	for _, s := range p.shards {
+		s.mu.Lock()
+		idle += len(s.free)
+		inUse += len(s.inUse)
+		s.mu.Unlock()
+	}
+	return PoolStats{
+		MaxConns:     p.maxConns,
+		TotalConns:   idle + inUse,
+		IdleConns:    idle,
+		InUseConns:   inUse,
+		Waiters:      int(p.waiters.Load()),
+		AcquireCount: p.acquireCount.Load(),
+		WaitCount:    p.waitCount.Load(),
+		WaitDuration: time.Duration(p.waitDuration.Load()),
+		ConnsCreated: p.connsCreated.Load(),
+	}
+}
+
+// Steals is how many acquisitions found their home shard empty and took a
+// connection from another shard
+func (p *ShardedPool) Steals() int64 {
+	return p.steals.Load()
+}
+
+// Close closes idle connections, releases waiters and fails further
+// acquisitions with ErrPoolClosed. Connections in use are closed as they are
+// returned
+func (p *ShardedPool) Close() {
+	p.closing.Do(func() {
+		p.closed.Store(true)
+		close(p.done)
+	})
+	for _, s := range p.shards {
+		s.mu.Lock()
+		free := s.free
+		s.free = nil
+		s.mu.Unlock()
+		for _, db := range free {
+			p.home.Delete(db)
+			p.open.Add(-1)
+			db.Close()
+		}
+	}
+}
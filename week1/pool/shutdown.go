@@ -0,0 +1,153 @@
+package pool
+
+import (
+	"context"
+)
+
+// poolState is where the pool is in its lifecycle:
+//
+//	open <-> paused
+//	open, paused -> draining -> closed
+//
+// A paused pool (see Drain) refuses acquisitions until Resume. A draining
+// pool refuses them for good, but connections may still be checked out; it
+// is closed once every one has been returned or force-closed. A connection
+// returned to a paused, draining or closed pool is closed, not pooled
+type poolState int32
+
+const (
+	poolOpen poolState = iota
+	poolPaused
+	poolDraining
+	poolClosed
+)
+
+// Closed reports whether Close or Shutdown has been called. Acquisitions
+// fail with ErrPoolClosed from then on
+func (p *Pool[T]) Closed() bool {
+	return p.isClosed()
+}
+
+// isClosed reports whether the pool is draining or closed. Like
+// unavailable, it doesn't need p.mu
+func (p *Pool[T]) isClosed() bool {
+	return poolState(p.state.Load()) >= poolDraining
+}
+
+// unavailable returns why the pool isn't handing out connections, or nil if
+// it is open. It doesn't need p.mu, so hot paths can fail fast without
+// taking the lock
+func (p *Pool[T]) unavailable() error {
+	switch poolState(p.state.Load()) {
+	case poolOpen:
+		return nil
+	case poolPaused:
+		return ErrPoolPaused
+	default:
+		return ErrPoolClosed
+	}
+}
+
+// Close stops new acquisitions and closes all idle connections, without
+// waiting. Connections still in use are closed as they are returned; use
+// Shutdown to wait for them
+func (p *Pool[T]) Close() {
+	p.beginShutdown()
+	p.logger.Info("All idle connections closed")
+}
+
+// Shutdown closes the pool gracefully: new acquisitions fail with
+// ErrPoolClosed, idle connections are closed, and Shutdown waits for
+// outstanding connections to be returned. If ctx expires first, the
+// connections still checked out are force-closed and ctx's error returned
+func (p *Pool[T]) Shutdown(ctx context.Context) error {
+	p.beginShutdown()
+	p.logger.Info("Waiting for in-use connections to be returned")
+
+	select {
+	case <-p.drained:
+		p.logger.Info("All connections closed")
+		return nil
+	case <-ctx.Done():
+		n := p.forceClose()
+		p.logger.Warn("Shutdown deadline reached, force-closed in-use connections", "count", n)
+		return ctx.Err()
+	}
+}
+
+// beginShutdown moves the pool to poolDraining, wakes blocked callers and
+// closes idle connections. It is safe to call more than once, concurrently
+// with any other pool method
+func (p *Pool[T]) beginShutdown() {
+	p.closeOnce.Do(func() {
+		// Refuse acquisitions first, so nothing new is checked out while the
+		// rest of the pool is torn down
+		p.mu.Lock()
+		p.state.Store(int32(poolDraining))
+		idle := append(p.idle, p.takeQuarantinedLocked()...)
+		p.idle = nil
+		for _, w := range p.waiters.drain() {
+			close(w.ready) // Wake waiters with ErrPoolClosed
+		}
+		if p.redialTimer != nil {
+			p.redialTimer.Stop()
+		}
+		p.mu.Unlock()
+
+		// Background goroutines holding a connection (e.g. mid health check)
+		// close it when they put it back, like any other caller
+		close(p.stop)
+		p.wg.Wait()
+
+		for _, conn := range idle {
+			p.closeConnection(conn)
+		}
+		p.mu.Lock()
+		p.numOpen -= len(idle)
+		p.signalDrainedLocked()
+		p.mu.Unlock()
+	})
+}
+
+// forceClose closes every connection still checked out. Their holders'
+// statements start failing, and their later Put is a no-op. Connections
+// already on their way back are left to Put, which retires them itself.
+// It returns how many connections were closed
+func (p *Pool[T]) forceClose() int {
+	var closing []T
+	var ids []int64
+	p.mu.Lock()
+	for conn, info := range p.conns {
+		if info.state == connForceClosed || info.state == connReturning {
+			continue
+		}
+		info.state = connForceClosed
+		p.connsDestroyed++
+		closing = append(closing, conn)
+		ids = append(ids, info.id)
+	}
+	p.mu.Unlock()
+
+	for i, conn := range closing {
+		p.destroy(conn, ids[i])
+	}
+	return len(closing)
+}
+
+// signalDrainedLocked wakes Drain or Shutdown once no connections remain,
+// moving a draining pool to poolClosed. Requires p.mu
+func (p *Pool[T]) signalDrainedLocked() {
+	if p.numOpen > 0 {
+		return
+	}
+	switch poolState(p.state.Load()) {
+	case poolPaused:
+		if p.paused != nil && !p.pauseDrained {
+			p.pauseDrained = true
+			close(p.paused)
+		}
+	case poolDraining:
+		p.state.Store(int32(poolClosed))
+		close(p.drained)
+	}
+}
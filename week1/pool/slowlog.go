@@ -0,0 +1,102 @@
+package pool
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// connID returns the pool's ID for a connection, as used in logs and traces,
+// or 0 if the pool doesn't track it
+func (p *Pool[T]) connID(conn T) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if info, ok := p.conns[conn]; ok {
+		return info.id
+	}
+	return 0
+}
+
+// logIfSlow logs a statement that ran on db for longer than
+// SlowQueryThreshold, started at start
+func (p *DBConnectionPool) logIfSlow(db *sql.DB, query string, start time.Time, err error) {
+	if p.slowQueryThreshold <= 0 {
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed < p.slowQueryThreshold {
+		return
+	}
+	args := []any{"query", fingerprint(query), "duration", elapsed.Round(time.Millisecond),
+		"threshold", p.slowQueryThreshold, "connection_id", p.connID(db)}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	p.logger.Warn("Slow query", args...)
+}
+
+// fingerprint normalizes a query so that runs differing only in literal
+// values log the same text: string and number literals become ?, lists of
+// placeholders collapse to one, and whitespace is squeezed to single spaces
+func fingerprint(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	space := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			// Skip to the closing quote; a doubled quote is an escaped one
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+				} else if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			c = '?'
+		case c >= '0' && c <= '9' && !partOfWord(query, i):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			c = '?'
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			// Postgres placeholder: $1, $2, ...
+			for i+1 < len(query) && isDigit(query[i+1]) {
+				i++
+			}
+			c = '?'
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			continue
+		}
+
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteByte(c)
+	}
+	// Lists like IN (?, ?, ?) vary in length with the arguments
+	s := b.String()
+	for strings.Contains(s, "?, ?") || strings.Contains(s, "?,?") {
+		s = strings.ReplaceAll(strings.ReplaceAll(s, "?, ?", "?"), "?,?", "?")
+	}
+	return s
+}
+
+// partOfWord reports whether the digit at query[i] belongs to an identifier,
+// like the 2 in "t2", rather than starting a number
+func partOfWord(query string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	c := query[i-1]
+	return c == '_' || isDigit(c) || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
@@ -0,0 +1,102 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNotSplitConnection is returned when a SplitPool is given a connection
+// that neither its primary nor any replica issued
+var ErrNotSplitConnection = errors.New("connection does not belong to this split pool's primary or replicas")
+
+// SplitPool routes writes to a primary database and spreads reads across its
+// replicas round-robin. Without replicas, reads go to the primary as well
+type SplitPool struct {
+	primary  *DBConnectionPool
+	replicas []*DBConnectionPool
+	next     atomic.Uint64 // Round-robin position among the replicas
+}
+
+// NewSplitPool wraps a primary pool and any number of replica pools. The
+// SplitPool takes ownership of them: Close and Shutdown close them all
+func NewSplitPool(primary *DBConnectionPool, replicas ...*DBConnectionPool) *SplitPool {
+	return &SplitPool{primary: primary, replicas: replicas}
+}
+
+// GetWriteConnection retrieves a connection to the primary
+func (s *SplitPool) GetWriteConnection(ctx context.Context) (*sql.DB, error) {
+	return s.primary.GetConnectionContext(ctx)
+}
+
+// GetReadConnection retrieves a connection to the next replica in turn.
+// Replicas lag the primary, so reads that must see the caller's own writes
+// should use GetWriteConnection instead
+func (s *SplitPool) GetReadConnection(ctx context.Context) (*sql.DB, error) {
+	return s.readPool().GetConnectionContext(ctx)
+}
+
+// readPool picks the pool for the next read
+func (s *SplitPool) readPool() *DBConnectionPool {
+	if len(s.replicas) == 0 {
+		return s.primary
+	}
+	i := s.next.Add(1) - 1
+	return s.replicas[i%uint64(len(s.replicas))]
+}
+
+// PutConnection returns a connection to whichever pool it came from. One
+// revoked by its pool's lease gets that pool's ErrLeaseExpired; one that no
+// pool issued gets ErrNotSplitConnection, bothering none of them
+func (s *SplitPool) PutConnection(conn *sql.DB) error {
+	pools := append([]*DBConnectionPool{s.primary}, s.replicas...)
+	for _, p := range pools {
+		if p.owns(conn) {
+			return p.PutConnection(conn)
+		}
+	}
+	for _, p := range pools {
+		if p.revokedConn(conn) {
+			return p.PutConnection(conn)
+		}
+	}
+	return ErrNotSplitConnection
+}
+
+// Primary returns the pool connected to the primary
+func (s *SplitPool) Primary() *DBConnectionPool {
+	return s.primary
+}
+
+// Replicas returns the pools connected to the replicas
+func (s *SplitPool) Replicas() []*DBConnectionPool {
+	return s.replicas
+}
+
+// Close closes the primary and replica pools without waiting
+func (s *SplitPool) Close() {
+	s.primary.Close()
+	for _, p := range s.replicas {
+		p.Close()
+	}
+}
+
+// Shutdown gracefully shuts down the primary and replica pools in parallel,
+// sharing one deadline. It returns the errors of the pools that did not
+// drain in time
+func (s *SplitPool) Shutdown(ctx context.Context) error {
+	pools := append([]*DBConnectionPool{s.primary}, s.replicas...)
+	errs := make([]error, len(pools))
+	var wg sync.WaitGroup
+	for i, p := range pools {
+		wg.Add(1)
+		go func(i int, p *DBConnectionPool) {
+			defer wg.Done()
+			errs[i] = p.Shutdown(ctx)
+		}(i, p)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
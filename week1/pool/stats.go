@@ -0,0 +1,169 @@
+package pool
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+)
+
+// PoolStats is a point-in-time snapshot of pool usage, for monitoring how much
+// pressure the pool is under
+type PoolStats struct {
+	MaxConns   int // Configured upper bound on open connections
+	TotalConns int // Open connections (idle + in use)
+	IdleConns  int // Connections waiting in the pool
+	InUseConns int // Connections handed out to callers
+	Waiters    int // Callers currently blocked waiting for a connection
+	// OverflowConns is how many of TotalConns are temporary connections
+	// above MaxConns (see Overflow)
+	OverflowConns int
+	// Quarantined is how many connections are out of rotation after failing
+	// probes, waiting to be re-probed (see QuarantineInterval)
+	Quarantined int
+	// ReconnectFailures is how many replacement dials failed in a row;
+	// while it is nonzero, reconnects back off (see ReconnectBackoff)
+	ReconnectFailures int
+	// Degraded is set while connections that failed at startup are still
+	// being backfilled in the background
+	Degraded bool
+	// CircuitOpen is set while acquisitions fail fast with ErrCircuitOpen
+	CircuitOpen bool
+	// Paused is set between Drain and Resume
+	Paused bool
+	// AcquirePaused is set between Pause and Resume
+	AcquirePaused bool
+
+	AcquireCount   int64         // Total successful acquisitions
+	WaitCount      int64         // Acquisitions that had to wait for a connection
+	WaitDuration   time.Duration // Total time spent waiting to acquire
+	WaitHistogram  WaitHistogram // How long each acquisition took
+	HoldHistogram  HoldHistogram // How long each returned checkout held its connection
+	ConnsCreated   int64         // Connections dialed over the pool's lifetime
+	ConnsDestroyed int64         // Connections closed over the pool's lifetime
+	LeaksDetected  int64         // Checkouts held past LeakDetectionThreshold
+	LongHolds      int64         // Checkouts held past LongHoldThreshold
+	LeasesExpired  int64         // Connections revoked because their lease ran out
+	WaitersShed    int64         // Acquisitions rejected with ErrPoolExhausted
+
+	// SessionSetups is how many checkouts ran Hooks.Session; checkouts
+	// whose connection was already in the state they needed are counted in
+	// SessionSetupsSkipped instead
+	SessionSetups        int64
+	SessionSetupsSkipped int64
+
+	StmtCacheHits      int64 // Stmt calls served from the statement cache
+	StmtCacheMisses    int64 // Stmt calls that had to prepare the statement
+	StmtCacheEvictions int64 // Statements closed to make room in the cache
+
+	Retries          int64 // Exec and Query retries after transient errors
+	RetriesExhausted int64 // Retries skipped because the retry budget was spent
+
+	ShadowMirrored int64 // Writes replayed on the shadow pool (see EnableShadow)
+	ShadowDropped  int64 // Writes not mirrored because the shadow fell behind
+	ShadowFailed   int64 // Mirrored writes that failed on the shadow
+
+	// Activity totals the statements run on the pool's connections, closed
+	// ones included, for pools that track it (DBConnectionPool)
+	Activity ConnActivity
+
+	Partitions map[string]PartitionStats // Usage of each configured partition
+
+	Hosts []HostStats // Per-host health, for multi-host pools
+}
+
+// Stats returns a snapshot of the pool's current state and counters
+func (p *Pool[T]) Stats() PoolStats {
+	stats := p.statsSnapshot()
+	if len(p.partitions) > 0 {
+		stats.Partitions = make(map[string]PartitionStats, len(p.partitions))
+		for name, part := range p.partitions {
+			stats.Partitions[name] = part.stats()
+		}
+	}
+	if p.extraStats != nil {
+		p.extraStats(&stats)
+	}
+	return stats
+}
+
+// statsSnapshot reads the pool's own state and counters
+func (p *Pool[T]) statsSnapshot() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PoolStats{
+		MaxConns:    p.maxConns,
+		TotalConns:  len(p.conns),
+		IdleConns:   len(p.idle),
+		InUseConns:  len(p.conns) - len(p.idle) - p.quarantined,
+		Quarantined: p.quarantined,
+
+		ReconnectFailures: p.redialFailures,
+		Waiters:           p.waiters.len(),
+
+		OverflowConns: max(len(p.conns)-p.maxConns, 0),
+		Degraded:      p.degraded,
+
+		CircuitOpen: p.breaker != nil && p.breaker.isOpen(),
+		Paused:      poolState(p.state.Load()) == poolPaused,
+
+		AcquirePaused: p.gate.Load() != nil,
+
+		AcquireCount:   p.acquireCount,
+		WaitCount:      p.waitCount,
+		WaitDuration:   p.waitDuration,
+		WaitHistogram:  p.waitCounts.histogram(),
+		HoldHistogram:  p.holdCounts.histogram(),
+		ConnsCreated:   p.connsCreated,
+		ConnsDestroyed: p.connsDestroyed,
+		LeaksDetected:  p.leaksDetected,
+		LongHolds:      p.longHolds,
+		LeasesExpired:  p.leasesExpired,
+		WaitersShed:    p.waitersShed,
+
+		SessionSetups:        p.sessionSetups,
+		SessionSetupsSkipped: p.sessionSetupsSkipped,
+	}
+}
+
+// recordAcquire counts a successful acquisition and how long it took
+func (p *Pool[T]) recordAcquire(ctx context.Context, conn T, wait time.Duration, waited bool) {
+	holder := holderFrom(ctx)
+	lease := p.leaseFor(ctx)
+	var gid int64
+	if p.debug {
+		gid = goroutineID()
+	}
+	var audit AuditRecord
+	p.mu.Lock()
+	if info, ok := p.conns[conn]; ok {
+		info.acquiredAt = time.Now()
+		info.uses++
+		info.holder = holder
+		info.leakReported = false
+		info.longHoldReported = false
+		info.tokenIssued = false
+		info.goroutine = gid
+		p.startLeaseLocked(conn, info, lease)
+		if p.leakThreshold > 0 {
+			info.acquireStack = debug.Stack()
+		}
+		if p.audit != nil {
+			info.auditStatements = p.statementsRunLocked(conn)
+			audit = AuditRecord{Time: info.acquiredAt, Op: AuditAcquire, ConnID: info.id, Holder: holder}
+		}
+	}
+	p.observeAcquireLocked(wait)
+	if inUse := len(p.conns) - len(p.idle) - p.quarantined; inUse > p.peakInUse {
+		p.peakInUse = inUse
+	}
+	p.waitCounts.observe(wait)
+
+	p.acquireCount++
+	p.waitDuration += wait
+	if waited {
+		p.waitCount++
+	}
+	p.mu.Unlock()
+	p.auditRecord(audit)
+}
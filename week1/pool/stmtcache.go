@@ -0,0 +1,169 @@
+package pool
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultStatementCacheSize is how many statements are cached per connection
+// unless configured
+const defaultStatementCacheSize = 32
+
+// stmtCache keeps the prepared statements of each pooled connection, keyed
+// by SQL text, so hot queries are prepared once per connection. Each
+// connection's statements are evicted least recently used first
+type stmtCache struct {
+	size int
+
+	mu        sync.Mutex
+	conns     map[*sql.DB]*connStmts
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// connStmts are the cached statements of one connection, most recently
+// used at the front
+type connStmts struct {
+	lru     *list.List // Of *cachedStmt
+	byQuery map[string]*list.Element
+}
+
+// cachedStmt is one prepared statement in the cache
+type cachedStmt struct {
+	query string
+	stmt  *sql.Stmt
+}
+
+// newStmtCache returns a cache holding up to size statements per connection
+func newStmtCache(size int) *stmtCache {
+	if size <= 0 {
+		size = defaultStatementCacheSize
+	}
+	return &stmtCache{size: size, conns: make(map[*sql.DB]*connStmts)}
+}
+
+// prepare returns db's cached statement for query, preparing it on a miss
+func (c *stmtCache) prepare(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	cs, ok := c.conns[db]
+	if !ok {
+		cs = &connStmts{lru: list.New(), byQuery: make(map[string]*list.Element)}
+		c.conns[db] = cs
+	}
+	if el, ok := cs.byQuery[query]; ok {
+		cs.lru.MoveToFront(el)
+		c.hits++
+		c.mu.Unlock()
+		return el.Value.(*cachedStmt).stmt, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.conns[db] != cs {
+		// The connection was closed while the statement was being prepared
+		c.mu.Unlock()
+		stmt.Close()
+		return nil, errors.New("connection closed while preparing statement")
+	}
+	if el, ok := cs.byQuery[query]; ok {
+		// Prepared concurrently on the same connection; keep the first one
+		c.mu.Unlock()
+		stmt.Close()
+		return el.Value.(*cachedStmt).stmt, nil
+	}
+	cs.byQuery[query] = cs.lru.PushFront(&cachedStmt{query: query, stmt: stmt})
+	var evicted *cachedStmt
+	if cs.lru.Len() > c.size {
+		evicted = cs.lru.Remove(cs.lru.Back()).(*cachedStmt)
+		delete(cs.byQuery, evicted.query)
+		c.evictions++
+	}
+	c.mu.Unlock()
+
+	if evicted != nil {
+		evicted.stmt.Close()
+	}
+	return stmt, nil
+}
+
+// forget closes and drops the statements of a connection being closed
+func (c *stmtCache) forget(db *sql.DB) {
+	c.mu.Lock()
+	cs := c.conns[db]
+	delete(c.conns, db)
+	c.mu.Unlock()
+
+	if cs == nil {
+		return
+	}
+	for el := cs.lru.Front(); el != nil; el = el.Next() {
+		el.Value.(*cachedStmt).stmt.Close()
+	}
+}
+
+// fillStats adds the cache's counters to a Stats snapshot
+func (c *stmtCache) fillStats(stats *PoolStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats.StmtCacheHits = c.hits
+	stats.StmtCacheMisses = c.misses
+	stats.StmtCacheEvictions = c.evictions
+}
+
+// Stmt returns a prepared statement for query on db, a connection checked
+// out of this pool, preparing it only the first time the connection sees
+// the query. The statement stays owned by the cache: don't Close it, and
+// don't use it after returning the connection
+func (p *DBConnectionPool) Stmt(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	return p.stmts.prepare(ctx, db, query)
+}
+
+// EnableMetrics registers the pool's Prometheus metrics, plus statement cache
+// and statement activity counters, with the given registry
+func (p *DBConnectionPool) EnableMetrics(registry prometheus.Registerer) error {
+	if err := p.Pool.EnableMetrics(registry); err != nil {
+		return err
+	}
+	counter := func(name, help string, value func(PoolStats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: p.metricsNamespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(p.Stats())) })
+	}
+	for _, c := range []prometheus.Collector{
+		counter("stmt_cache_hits_total", "Prepared statements served from the statement cache.",
+			func(s PoolStats) int64 { return s.StmtCacheHits }),
+		counter("stmt_cache_misses_total", "Prepared statements that were not cached yet.",
+			func(s PoolStats) int64 { return s.StmtCacheMisses }),
+		counter("stmt_cache_evictions_total", "Prepared statements evicted from the statement cache.",
+			func(s PoolStats) int64 { return s.StmtCacheEvictions }),
+		counter("queries_total", "Statements run on pooled connections.",
+			func(s PoolStats) int64 { return s.Activity.Queries }),
+		counter("query_errors_total", "Statements run on pooled connections that failed.",
+			func(s PoolStats) int64 { return s.Activity.Errors }),
+		counter("rows_total", "Rows read, plus rows affected by writes, on pooled connections.",
+			func(s PoolStats) int64 { return s.Activity.Rows }),
+		counter("sent_bytes_total", "Query text and argument bytes sent on pooled connections.",
+			func(s PoolStats) int64 { return s.Activity.BytesSent }),
+		counter("received_bytes_total", "Result value bytes read on pooled connections.",
+			func(s PoolStats) int64 { return s.Activity.BytesReceived }),
+	} {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
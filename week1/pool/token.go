@@ -0,0 +1,85 @@
+package pool
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTokenRequired is returned when a connection acquired with GetWithToken
+// is returned without its token
+var ErrTokenRequired = errors.New("connection was acquired with a token and must be returned with it")
+
+// ErrStaleToken is returned when a token doesn't belong to the connection's
+// current checkout, e.g. a late return by a previous holder after the
+// connection went to someone else
+var ErrStaleToken = errors.New("token does not match the connection's current checkout")
+
+// Token proves ownership of one checkout of a connection. The zero Token is
+// never valid
+type Token struct {
+	conn     int64 // connInfo id
+	checkout int64 // connInfo uses at the time of the checkout
+}
+
+// GetWithToken is Get that also returns a token for the checkout. The
+// connection must then be returned with PutWithToken or DiscardWithToken;
+// plain Put and Discard reject it with ErrTokenRequired. A connection
+// revoked or force-closed before its token is issued is given back, failing
+// with ErrLeaseExpired or ErrPoolClosed
+func (p *Pool[T]) GetWithToken(ctx context.Context) (T, Token, error) {
+	var zero T
+	conn, err := p.Get(ctx)
+	if err != nil {
+		return conn, Token{}, err
+	}
+	p.mu.Lock()
+	info, ok := p.conns[conn]
+	if ok && info.state == connInUse {
+		info.tokenIssued = true
+		token := Token{conn: info.id, checkout: info.uses}
+		p.mu.Unlock()
+		return conn, token, nil
+	}
+	if !ok {
+		err = ErrPoolClosed
+		if p.takeRevokedLocked(conn) {
+			err = ErrLeaseExpired
+		}
+		p.mu.Unlock()
+		// Already closed; only the release middleware has yet to see it
+		p.releaseThrough(conn, func(T) error { return err })
+		return zero, Token{}, err
+	}
+	p.mu.Unlock()
+	// Force-closed by Shutdown: Put gives up its slot
+	p.Put(conn)
+	return zero, Token{}, ErrPoolClosed
+}
+
+// PutWithToken is Put for a connection acquired with GetWithToken. Stale or
+// duplicated returns are rejected with ErrStaleToken or ErrDoubleReturn
+// (a panic in Debug mode) without touching the connection
+func (p *Pool[T]) PutWithToken(conn T, token Token) error {
+	return p.releaseThrough(conn, func(conn T) error { return p.put(conn, &token) })
+}
+
+// DiscardWithToken is Discard for a connection acquired with GetWithToken
+func (p *Pool[T]) DiscardWithToken(conn T, token Token) error {
+	return p.releaseThrough(conn, func(conn T) error { return p.discard(conn, &token) })
+}
+
+// checkTokenLocked checks that a checked out connection is returned with
+// the token of its checkout, if it was issued one. token is nil for plain Put
+// and Discard. Requires p.mu
+func (info *connInfo) checkTokenLocked(token *Token) error {
+	if token == nil {
+		if info.tokenIssued {
+			return ErrTokenRequired
+		}
+		return nil
+	}
+	if !info.tokenIssued || token.conn != info.id || token.checkout != info.uses {
+		return ErrStaleToken
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Group Replication member roles, as reported in HostStats.Role
+const (
+	RolePrimary   = "PRIMARY"
+	RoleSecondary = "SECONDARY"
+)
+
+// groupMembersQuery lists the members of the group as the queried member
+// sees them
+const groupMembersQuery = `SELECT MEMBER_HOST, MEMBER_PORT, MEMBER_ROLE, MEMBER_STATE
+FROM performance_schema.replication_group_members`
+
+// errNoGroupPrimary is why a member's view of the group was not used
+var errNoGroupPrimary = errors.New("member sees no online primary")
+
+// groupMember is an online member of a replication group
+type groupMember struct {
+	addr string // host:port, as the member reports it
+	role string
+}
+
+// topologyLoop re-reads the group's topology every TopologyInterval until
+// the pool is closed
+func (s *hostSet) topologyLoop(p *Pool[*sql.DB]) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(s.topologyInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.refreshTopology()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// refreshTopology reads the group's topology and, if it changed, steers the
+// pool to it: a failover pool follows the primary, and connections to hosts
+// that left the group are retired
+func (s *hostSet) refreshTopology() {
+	members, err := s.queryTopology()
+	if err != nil {
+		s.logger.Warn("Failed to read group replication topology", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	from := s.primaryLocked()
+	changed := s.applyTopologyLocked(members)
+	to := s.primaryLocked()
+	var secondaries []string
+	for _, h := range s.hosts {
+		if h.role == RoleSecondary {
+			secondaries = append(secondaries, h.name)
+		}
+	}
+	p := s.pool
+	s.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	s.logger.Info("Group replication topology changed", "primary", hostNameOf(to), "secondaries", secondaries)
+	if p == nil {
+		return // Still building the pool; its first dials use the new topology
+	}
+	if s.ordered && to != nil {
+		s.switchTo(to)
+	}
+	p.retireStale()
+	p.emit(Event{Type: EventTopologyChanged, From: hostNameOf(from), To: hostNameOf(to)})
+}
+
+// queryTopology asks each host in turn, the active one first, for the
+// online members of the group. A view without an online primary, as from a
+// member that dropped out of the group, is passed over for the next host's
+func (s *hostSet) queryTopology() ([]groupMember, error) {
+	s.mu.Lock()
+	hosts := make([]*host, 0, len(s.hosts))
+	if s.active != nil {
+		hosts = append(hosts, s.active)
+	}
+	for _, h := range s.hosts {
+		if h != s.active {
+			hosts = append(hosts, h)
+		}
+	}
+	s.mu.Unlock()
+
+	err := ErrNoHealthyHosts
+	for _, h := range hosts {
+		ctx, cancel := context.WithTimeout(context.Background(), s.retryInterval)
+		members, queryErr := s.queryMembers(ctx, h)
+		cancel()
+		if queryErr == nil {
+			return members, nil
+		}
+		s.logger.Debug("Group replication topology query failed", "host", h.name, "error", queryErr)
+		err = queryErr
+	}
+	return nil, err
+}
+
+// queryMembers reads the online members of the group from h, on a
+// throwaway connection so a busy pool can't hold up the watcher
+func (s *hostSet) queryMembers(ctx context.Context, h *host) ([]groupMember, error) {
+	dsn, session := s.dialTarget(h)
+	db, err := openDB(ctx, s.driverName, dsn, session)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, groupMembersQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []groupMember
+	primary := false
+	for rows.Next() {
+		var host, role, state sql.NullString
+		var port sql.NullInt64
+		if err := rows.Scan(&host, &port, &role, &state); err != nil {
+			return nil, err
+		}
+		if state.String != "ONLINE" || host.String == "" {
+			continue
+		}
+		members = append(members, groupMember{
+			addr: net.JoinHostPort(host.String, strconv.FormatInt(port.Int64, 10)),
+			role: role.String,
+		})
+		primary = primary || role.String == RolePrimary
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !primary {
+		return nil, errNoGroupPrimary
+	}
+	return members, nil
+}
+
+// applyTopologyLocked records each host's role, adding members the pool
+// didn't know about, and reports whether anything changed. Requires s.mu
+func (s *hostSet) applyTopologyLocked(members []groupMember) bool {
+	roles := make(map[string]string, len(members))
+	for _, m := range members {
+		roles[m.addr] = m.role
+	}
+	changed := !s.topology
+	s.topology = true
+	for _, h := range s.hosts {
+		role := roles[h.name]
+		delete(roles, h.name)
+		if h.role != role {
+			h.role = role
+			changed = true
+		}
+	}
+
+	// Whatever is left joined the group since the pool was built
+	added := make([]string, 0, len(roles))
+	for addr := range roles {
+		added = append(added, addr)
+	}
+	sort.Strings(added)
+	for _, addr := range added {
+		dsn, ok := s.memberDSN(addr)
+		if !ok {
+			if !s.unreachable[addr] {
+				s.logger.Warn("Can't derive a DSN for new group member, ignoring it", "host", addr)
+			}
+			if s.unreachable == nil {
+				s.unreachable = make(map[string]bool)
+			}
+			s.unreachable[addr] = true
+			continue
+		}
+		s.hosts = append(s.hosts, &host{name: addr, dsn: dsn, rank: len(s.hosts), role: roles[addr]})
+		changed = true
+	}
+	return changed
+}
+
+// memberDSN builds the DSN for a group member at addr from the first
+// configured DSN, so members that join later are reached with the same
+// credentials and options. Only MySQL DSNs can be rewritten
+func (s *hostSet) memberDSN(addr string) (string, bool) {
+	if s.driverName != "mysql" {
+		return "", false
+	}
+	cfg, err := mysql.ParseDSN(s.hosts[0].dsn)
+	if err != nil {
+		return "", false
+	}
+	cfg.Net = "tcp"
+	cfg.Addr = addr
+	return cfg.FormatDSN(), true
+}
+
+// eligibleLocked reports whether new connections may go to h given the
+// group's topology: failover pools only dial the primary, multi-host pools
+// any online member. Requires s.mu
+func (s *hostSet) eligibleLocked(h *host) bool {
+	if !s.topology {
+		return true
+	}
+	if s.ordered {
+		return h.role == RolePrimary
+	}
+	return h.role != ""
+}
+
+// primaryLocked returns the group's primary, or nil if it is unknown.
+// Requires s.mu
+func (s *hostSet) primaryLocked() *host {
+	for _, h := range s.hosts {
+		if h.role == RolePrimary {
+			return h
+		}
+	}
+	return nil
+}
+
+// hostNameOf returns h's name, or "" for nil
+func hostNameOf(h *host) string {
+	if h == nil {
+		return ""
+	}
+	return h.name
+}
@@ -0,0 +1,66 @@
+package pool
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the pool's spans. It is a no-op until the application
+// installs a TracerProvider with otel.SetTracerProvider
+var tracer = otel.Tracer("github.com/system-design/week1/pool")
+
+// Span attributes describing pool activity
+const (
+	attrConnID = attribute.Key("db.pool.connection_id")
+	attrWaitMs = attribute.Key("db.pool.wait_ms")
+	attrHoldMs = attribute.Key("db.pool.hold_ms")
+
+	attrPriority = attribute.Key("db.pool.priority")
+)
+
+// endAcquireSpan finishes the span around Get, tagging it
+// with how long the caller waited and which connection it got
+func (p *Pool[T]) endAcquireSpan(ctx context.Context, span trace.Span, conn T, wait time.Duration, err error) {
+	defer span.End()
+
+	span.SetAttributes(attrWaitMs.Float64(float64(wait) / float64(time.Millisecond)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if info, ok := p.conns[conn]; ok {
+		span.SetAttributes(attrConnID.Int64(info.id))
+		info.acquireSpan = trace.SpanContextFromContext(ctx)
+	}
+}
+
+// startReleaseSpan starts the span around Put. Put has no
+// context of its own, so the span is parented to the span that acquired the
+// connection, keeping acquire and release in the same trace
+func (p *Pool[T]) startReleaseSpan(conn T) trace.Span {
+	p.mu.Lock()
+	info, ok := p.conns[conn]
+	var parent trace.SpanContext
+	var attrs []attribute.KeyValue
+	if ok {
+		parent = info.acquireSpan
+		attrs = []attribute.KeyValue{
+			attrConnID.Int64(info.id),
+			attrHoldMs.Float64(float64(time.Since(info.acquiredAt)) / float64(time.Millisecond)),
+		}
+	}
+	p.mu.Unlock()
+
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+	_, span := tracer.Start(ctx, "pool.release", trace.WithAttributes(attrs...))
+	return span
+}
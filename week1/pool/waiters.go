@@ -0,0 +1,124 @@
+package pool
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Priority decides which blocked caller gets the next returned connection
+// when the pool is saturated. Higher priorities are served first
+type Priority int
+
+const (
+	PriorityLow    Priority = -10 // Batch and background work
+	PriorityNormal Priority = 0   // Default for Get
+	PriorityHigh   Priority = 10  // Latency-critical paths, e.g. heartbeat writes
+)
+
+// waiter is a caller blocked in Get. The pool hands it a connection
+// directly, or closes ready if the pool was closed while it waited
+type waiter[T comparable] struct {
+	ready    chan T // Buffered so the pool never blocks handing over
+	priority Priority
+	seq      uint64 // Arrival order, for breaking ties between equal priorities
+	index    int    // Position in the heap, maintained by waiterHeap
+
+	// For Dump: when it started waiting, its WithHolder label and, in Debug
+	// mode, its goroutine
+	since     time.Time
+	holder    string
+	goroutine int64
+}
+
+// waiterQueue holds the callers blocked waiting for a connection. Returned
+// connections go to the highest priority caller; among equal priorities the
+// longest waiting one is served (FIFO), so no request starves behind later
+// arrivals. In LIFO mode the most recent caller is served first instead,
+// trading fairness for cache warmth
+type waiterQueue[T comparable] struct {
+	lifo    bool
+	nextSeq uint64
+	heap    waiterHeap[T]
+}
+
+// len returns the number of blocked callers
+func (q *waiterQueue[T]) len() int {
+	return len(q.heap.waiters)
+}
+
+// push adds a newly blocked caller
+func (q *waiterQueue[T]) push(w *waiter[T]) {
+	q.nextSeq++
+	w.seq = q.nextSeq
+	q.heap.lifo = q.lifo
+	heap.Push(&q.heap, w)
+}
+
+// pop removes and returns the caller to serve next, or nil if none is waiting
+func (q *waiterQueue[T]) pop() *waiter[T] {
+	if q.len() == 0 {
+		return nil
+	}
+	return heap.Pop(&q.heap).(*waiter[T])
+}
+
+// remove takes a caller that gave up out of the queue. It reports false if
+// the caller was no longer queued because it had already been served
+func (q *waiterQueue[T]) remove(w *waiter[T]) bool {
+	if w.index < 0 || w.index >= q.len() || q.heap.waiters[w.index] != w {
+		return false
+	}
+	heap.Remove(&q.heap, w.index)
+	return true
+}
+
+// drain removes and returns every queued caller
+func (q *waiterQueue[T]) drain() []*waiter[T] {
+	waiters := q.heap.waiters
+	q.heap.waiters = nil
+	for _, w := range waiters {
+		w.index = -1
+	}
+	return waiters
+}
+
+// waiterHeap implements heap.Interface over waiters, ordered by priority and
+// then by arrival
+type waiterHeap[T comparable] struct {
+	lifo    bool
+	waiters []*waiter[T]
+}
+
+func (h waiterHeap[T]) Len() int { return len(h.waiters) }
+
+func (h waiterHeap[T]) Less(i, j int) bool {
+	a, b := h.waiters[i], h.waiters[j]
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if h.lifo {
+		return a.seq > b.seq
+	}
+	return a.seq < b.seq
+}
+
+func (h waiterHeap[T]) Swap(i, j int) {
+	h.waiters[i], h.waiters[j] = h.waiters[j], h.waiters[i]
+	h.waiters[i].index = i
+	h.waiters[j].index = j
+}
+
+func (h *waiterHeap[T]) Push(x any) {
+	w := x.(*waiter[T])
+	w.index = len(h.waiters)
+	h.waiters = append(h.waiters, w)
+}
+
+func (h *waiterHeap[T]) Pop() any {
+	n := len(h.waiters)
+	w := h.waiters[n-1]
+	h.waiters[n-1] = nil
+	h.waiters = h.waiters[:n-1]
+	w.index = -1
+	return w
+}
@@ -0,0 +1,64 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// defaultWarmupConcurrency is how many initial connections are dialed at
+// once unless configured
+const defaultWarmupConcurrency = 8
+
+// warmup dials the pool's initial connections, up to concurrency at a time,
+// and puts them in the pool. It returns how many connections were opened
+// and the errors of the dials that failed
+func (p *Pool[T]) warmup(n, concurrency, retries int, b backoff) (int, error) {
+	if concurrency <= 0 {
+		concurrency = defaultWarmupConcurrency
+	}
+
+	// Reserve every slot up front so concurrent dials can't overshoot
+	p.mu.Lock()
+	p.numOpen += n
+	p.mu.Unlock()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		opened int
+		errs   []error
+	)
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// Dial and test the connection
+			conn, err := p.openConnectionWithRetry(retries, b)
+			if err != nil {
+				// Not releaseSlot: that would start a background redial
+				p.mu.Lock()
+				p.numOpen--
+				p.mu.Unlock()
+
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to create connection %d: %v", i, err))
+				mu.Unlock()
+				return
+			}
+
+			// Put connection in the pool
+			p.putConn(conn)
+			mu.Lock()
+			opened++
+			mu.Unlock()
+			p.logger.Info("Connection initialized and added to pool", "connection", i+1)
+		}(i)
+	}
+	wg.Wait()
+	return opened, errors.Join(errs...)
+}
@@ -0,0 +1,80 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// MaxBulkLookup is the most users one BatchGetStatus call may ask about,
+// enough for a large contact list
+const MaxBulkLookup = 5000
+
+// bulkParallelism is how many chunks BatchGetStatus reads at once, each
+// holding a connection
+const bulkParallelism = 4
+
+// StatusResult is one user's entry in a BatchGetStatus reply: their status,
+// or why it couldn't be read
+type StatusResult struct {
+	Status
+	Err error
+}
+
+// BatchGetStatus reports whether each of userIDs is online, in their order.
+// Unlike Store.BatchStatus it takes up to MaxBulkLookup users, reading them
+// MaxBatch at a time, a few chunks at once, and reports errors per user:
+// an invalid ID, or a chunk whose read failed, fails only those entries.
+// Duplicate IDs are read once. The only error for the call as a whole is
+// asking about too many users
+func BatchGetStatus(ctx context.Context, store Store, userIDs []string) ([]StatusResult, error) {
+	if len(userIDs) > MaxBulkLookup {
+		return nil, fmt.Errorf("%w: at most %d users per lookup", ErrInvalidUserID, MaxBulkLookup)
+	}
+	results := make([]StatusResult, len(userIDs))
+	positions := make(map[string][]int, len(userIDs)) // Where each valid ID appears
+	var unique []string
+	for i, id := range userIDs {
+		results[i].UserID = id
+		if err := ValidUserID(id); err != nil {
+			results[i].Err = err
+			continue
+		}
+		if _, ok := positions[id]; !ok {
+			unique = append(unique, id)
+		}
+		positions[id] = append(positions[id], i)
+	}
+
+	var g errgroup.Group
+	g.SetLimit(bulkParallelism)
+	for start := 0; start < len(unique); start += MaxBatch {
+		chunk := unique[start:min(start+MaxBatch, len(unique))]
+		g.Go(func() error {
+			statuses, err := store.BatchStatus(ctx, chunk)
+			// A sharded store may fail only some of the chunk
+			var partial *PartialError
+			if errors.As(err, &partial) {
+				statuses, err = partial.Statuses, nil
+			}
+			// Each chunk writes only its own users' entries
+			for j, id := range chunk {
+				for _, i := range positions[id] {
+					switch {
+					case err != nil:
+						results[i].Err = err
+					case partial != nil && partial.Errs[id] != nil:
+						results[i].Err = partial.Errs[id]
+					default:
+						results[i].Status = statuses[j]
+					}
+				}
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	return results, nil
+}
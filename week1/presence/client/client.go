@@ -0,0 +1,302 @@
+// Package client keeps a user online from the client side: it sends their
+// heartbeats on an interval, with jitter so a fleet of clients restarted
+// together doesn't beat in lockstep, retries failed ones with backoff,
+// and pauses after repeated failures instead of hammering a server that is
+// down. Apps tell it when they go to the background and come back:
+//
+//	hb := client.New(&client.HTTPSender{BaseURL: "https://presence.example.com"}, userID, client.Config{Interval: 10 * time.Second})
+//	defer hb.Close()
+//	onBackground(hb.Background) // Heartbeats stop; the user goes away, then offline
+//	onForeground(hb.Foreground) // A heartbeat goes out at once
+//
+// A Sender carries the heartbeats: HTTPSender posts to the heartbeat API,
+// GRPCSender calls the Presence service's Heartbeat.
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Defaults for Config fields left zero
+const (
+	DefaultInterval   = 10 * time.Second
+	DefaultJitter     = 0.1
+	DefaultRetryBase  = 500 * time.Millisecond
+	DefaultPauseAfter = 5
+	DefaultPause      = time.Minute
+)
+
+// ErrRejected is wrapped by Sender errors that retrying won't fix, such as
+// an invalid user ID. They wait for the next interval rather than a retry
+var ErrRejected = errors.New("heartbeat rejected")
+
+// Sender sends one heartbeat for userID
+type Sender interface {
+	Heartbeat(ctx context.Context, userID string) error
+}
+
+// RetryAfterError is implemented by Sender errors carrying how long the
+// server asked clients to wait, e.g. from a 503's Retry-After
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+// Config tunes a Client. Zero fields take the defaults
+type Config struct {
+	// Interval is the time between heartbeats, well inside the server's
+	// online window (and away threshold, if it has one)
+	Interval time.Duration
+	// Jitter spreads each wait over Interval ± Jitter × Interval
+	Jitter float64
+	// BackgroundInterval is the time between heartbeats in the background.
+	// Zero sends none, so the user goes away and then offline while the app
+	// isn't in use
+	BackgroundInterval time.Duration
+	// RetryBase is the ceiling of the first retry's delay, doubling with
+	// each failure in a row up to Interval, with full jitter
+	RetryBase time.Duration
+	// PauseAfter is how many failures in a row pause heartbeats for Pause
+	PauseAfter int
+	Pause      time.Duration
+	// Logger reports failures and pauses; nil uses slog's default
+	Logger *slog.Logger
+}
+
+// withDefaults fills in the zero fields of cfg
+func (cfg Config) withDefaults() Config {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Jitter <= 0 {
+		cfg.Jitter = DefaultJitter
+	}
+	cfg.Jitter = min(cfg.Jitter, 1)
+	if cfg.RetryBase <= 0 {
+		cfg.RetryBase = DefaultRetryBase
+	}
+	if cfg.PauseAfter <= 0 {
+		cfg.PauseAfter = DefaultPauseAfter
+	}
+	if cfg.Pause <= 0 {
+		cfg.Pause = DefaultPause
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return cfg
+}
+
+// Stats is a snapshot of a Client's heartbeats
+type Stats struct {
+	Sent                int64 // Heartbeats the server accepted
+	Failed              int64
+	ConsecutiveFailures int
+	Background          bool
+	Paused              bool // Waiting out Pause after PauseAfter failures
+	LastSuccess         time.Time
+	LastError           error
+}
+
+// Client sends one user's heartbeats until Close. Create one with New
+type Client struct {
+	send   Sender
+	userID string
+	cfg    Config
+
+	mu    sync.Mutex
+	stats Stats
+
+	wake    chan struct{} // A lifecycle change to act on
+	cancel  context.CancelFunc
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// New starts sending userID's heartbeats through send, the first at once,
+// as an app in the foreground
+func New(send Sender, userID string, cfg Config) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		send:    send,
+		userID:  userID,
+		cfg:     cfg.withDefaults(),
+		wake:    make(chan struct{}, 1),
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	go c.loop(ctx)
+	return c
+}
+
+// Foreground resumes heartbeats at Interval when the app comes back into
+// use, sending one at once. The user is back online, and a pause after
+// failures ends, as the user may well have moved to a better network
+func (c *Client) Foreground() {
+	c.mu.Lock()
+	c.stats.Background = false
+	c.stats.Paused = false
+	c.stats.ConsecutiveFailures = 0
+	c.mu.Unlock()
+	c.poke()
+}
+
+// Background switches to BackgroundInterval, or stops heartbeats without
+// one, when the app goes out of use
+func (c *Client) Background() {
+	c.mu.Lock()
+	c.stats.Background = true
+	c.mu.Unlock()
+	c.poke()
+}
+
+// Stats returns a snapshot of the heartbeats so far
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Close stops sending heartbeats, abandoning one in flight. The server
+// counts the user offline once their online window passes
+func (c *Client) Close() {
+	c.once.Do(func() {
+		c.cancel()
+		<-c.stopped
+	})
+}
+
+// poke wakes the loop to act on a lifecycle change
+func (c *Client) poke() {
+	select {
+	case c.wake <- struct{}{}:
+	default: // Already due to wake
+	}
+}
+
+// loop sends heartbeats until ctx ends. A wake sends one at once in the
+// foreground, and otherwise reschedules the next
+func (c *Client) loop(ctx context.Context) {
+	defer close(c.stopped)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			c.beat(ctx)
+		case <-c.wake:
+			if c.Stats().Background {
+				break // Only reschedule
+			}
+			c.beat(ctx)
+		case <-ctx.Done():
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if next, ok := c.next(); ok {
+			resetTimer(timer, next)
+		} else {
+			stopTimer(timer) // Until the next wake
+		}
+	}
+}
+
+// beat sends one heartbeat, bounded by the interval so a hung request
+// doesn't hold up the next
+func (c *Client) beat(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Interval)
+	err := c.send.Heartbeat(ctx, c.userID)
+	cancel()
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return // Closed
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		c.stats.Sent++
+		c.stats.ConsecutiveFailures = 0
+		c.stats.Paused = false
+		c.stats.LastSuccess = time.Now()
+		return
+	}
+	c.stats.Failed++
+	c.stats.ConsecutiveFailures++
+	c.stats.LastError = err
+	if c.stats.ConsecutiveFailures >= c.cfg.PauseAfter && !errors.Is(err, ErrRejected) {
+		if !c.stats.Paused {
+			c.cfg.Logger.Warn("Heartbeats failing, pausing", "user_id", c.userID, "failures", c.stats.ConsecutiveFailures, "pause", c.cfg.Pause, "error", err)
+		}
+		c.stats.Paused = true
+		return
+	}
+	c.cfg.Logger.Warn("Heartbeat failed", "user_id", c.userID, "failures", c.stats.ConsecutiveFailures, "error", err)
+}
+
+// next returns how long until the next heartbeat, false for none until
+// the app is back in the foreground
+func (c *Client) next() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	interval := c.cfg.Interval
+	if c.stats.Background {
+		if c.cfg.BackgroundInterval <= 0 {
+			return 0, false
+		}
+		interval = c.cfg.BackgroundInterval
+	}
+	failures := c.stats.ConsecutiveFailures
+	switch {
+	case failures == 0 || errors.Is(c.stats.LastError, ErrRejected):
+		return c.jitter(interval), true
+	case c.stats.Paused:
+		return c.jitter(c.cfg.Pause), true
+	}
+	// A retry inside the interval, to keep the user online through a blip
+	delay := c.retryDelay(failures-1, interval)
+	var ra RetryAfterError
+	if errors.As(c.stats.LastError, &ra) {
+		delay = max(delay, ra.RetryAfter())
+	}
+	return delay, true
+}
+
+// jitter returns d moved by up to ±Jitter of itself
+func (c *Client) jitter(d time.Duration) time.Duration {
+	spread := float64(d) * c.cfg.Jitter
+	return d + time.Duration((rand.Float64()*2-1)*spread)
+}
+
+// retryDelay returns the delay before retry number attempt (starting at
+// 0): a random duration between 0 and min(ceiling, RetryBase * 2^attempt)
+func (c *Client) retryDelay(attempt int, ceiling time.Duration) time.Duration {
+	if attempt < 32 { // Beyond this the shift overflows; we're at ceiling anyway
+		if d := c.cfg.RetryBase << attempt; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// resetTimer makes t fire after d, whether or not it fired already
+func resetTimer(t *time.Timer, d time.Duration) {
+	stopTimer(t)
+	t.Reset(d)
+}
+
+// stopTimer stops t, draining a fire nobody received
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/system-design/week1/presence/presencepb"
+)
+
+// HTTPSender posts heartbeats to the heartbeat API's POST /v1/heartbeat
+type HTTPSender struct {
+	BaseURL string       // e.g. "https://presence.example.com"
+	Client  *http.Client // nil uses http.DefaultClient
+}
+
+// Heartbeat posts one heartbeat for userID
+func (s *HTTPSender) Heartbeat(ctx context.Context, userID string) error {
+	body, err := json.Marshal(map[string]string{"user_id": userID})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.BaseURL, "/")+"/v1/heartbeat", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body) // Lets the connection be reused
+		return nil
+	}
+	return newStatusError(resp)
+}
+
+// StatusError is an HTTPSender's error for a reply other than a 2xx. 429s
+// and 5xxs are worth retrying; other 4xxs wrap ErrRejected
+type StatusError struct {
+	StatusCode int
+	Message    string        // The API's error text, if any
+	Retry      time.Duration // From Retry-After, if given in seconds
+}
+
+// newStatusError reads a failed reply
+func newStatusError(resp *http.Response) *StatusError {
+	e := &StatusError{StatusCode: resp.StatusCode}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 1<<10)).Decode(&body) == nil {
+		e.Message = body.Error
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.Retry = time.Duration(secs) * time.Second
+	}
+	return e
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("heartbeat: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("heartbeat: %s: %s", http.StatusText(e.StatusCode), e.Message)
+}
+
+// RetryAfter is how long the server asked to wait
+func (e *StatusError) RetryAfter() time.Duration { return e.Retry }
+
+func (e *StatusError) Unwrap() error {
+	if e.StatusCode/100 == 4 && e.StatusCode != http.StatusTooManyRequests {
+		return ErrRejected
+	}
+	return nil
+}
+
+// GRPCSender sends heartbeats with the Presence service's Heartbeat
+type GRPCSender struct {
+	Client presencepb.PresenceClient
+}
+
+// Heartbeat sends one heartbeat for userID
+func (s *GRPCSender) Heartbeat(ctx context.Context, userID string) error {
+	_, err := s.Client.Heartbeat(ctx, &presencepb.HeartbeatRequest{UserId: userID})
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied, codes.Unimplemented:
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	return err
+}
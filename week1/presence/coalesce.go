@@ -0,0 +1,361 @@
+package presence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/system-design/week1/pool"
+)
+
+// ErrCoalescerClosed is returned for heartbeats sent after Coalescer.Close
+var ErrCoalescerClosed = errors.New("presence: heartbeat coalescer is closed")
+
+// ErrBacklogFull is returned for a heartbeat from a user with nothing
+// buffered while the Coalescer holds its limit of unwritten heartbeats,
+// typically because the database has been failing for a while
+var ErrBacklogFull = errors.New("presence: heartbeat backlog is full")
+
+// flushTimeout bounds each flush's statements
+const flushTimeout = 5 * time.Second
+
+// DefaultCoalesceBatch is the most users a Coalescer writes per statement
+// unless told otherwise. Each row takes two placeholders, well under the
+// limits of MySQL (65535) and SQLite (32766)
+const DefaultCoalesceBatch = 500
+
+// DefaultCoalesceBacklog is how many users' heartbeats a Coalescer holds
+// unwritten at most unless told otherwise, a few megabytes
+const DefaultCoalesceBacklog = 100000
+
+// heartbeatUpsertSuffixes end a multi-row heartbeat INSERT for each driver,
+// keeping the later of the stored and the new last_seen so a delayed flush
+// can't move a user back in time
+var heartbeatUpsertSuffixes = map[string]string{
+	"mysql":    " ON DUPLICATE KEY UPDATE last_seen = GREATEST(last_seen, VALUES(last_seen))",
+	"postgres": " ON CONFLICT (user_id) DO UPDATE SET last_seen = GREATEST(user_status.last_seen, EXCLUDED.last_seen)",
+	"sqlite":   " ON CONFLICT (user_id) DO UPDATE SET last_seen = MAX(last_seen, excluded.last_seen)",
+}
+
+// Coalescer is a write-behind buffer for last_seen. Heartbeats update an
+// in-memory map, which status reads consult, and are written in batches:
+// every interval, or as soon as maxBatch users are dirty, the freshest
+// heartbeat of each user goes out in one multi-row upsert per maxBatch
+// users instead of one statement per heartbeat. A client heartbeating
+// several times between flushes costs one row. Heartbeats are acknowledged
+// once buffered, so a crash loses at most one interval of them, which the
+// next round of heartbeats repairs; Close flushes the rest. A failed flush
+// keeps its heartbeats for the next, up to maxBacklog users, past which new
+// users' heartbeats are refused rather than growing memory without bound.
+// Create one with SQLStore.Coalesce
+type Coalescer struct {
+	store      *SQLStore
+	interval   time.Duration
+	maxBatch   int
+	maxBacklog int
+	logger     *slog.Logger
+
+	mu       sync.Mutex
+	pending  map[string]time.Time // Freshest unwritten heartbeat per user
+	flushing map[string]time.Time // The heartbeats being written
+	closed   bool
+
+	full    chan struct{} // Holds a token once maxBatch users are pending
+	stop    chan struct{}
+	stopped chan struct{}
+
+	received  atomic.Int64
+	rows      atomic.Int64
+	batches   atomic.Int64
+	failures  atomic.Int64
+	rejected  atomic.Int64
+	flushLock sync.Mutex // Serializes flushes, so batches land in order
+}
+
+// CoalescerStats counts a Coalescer's work
+type CoalescerStats struct {
+	Pending  int   // Users with a heartbeat not yet written, including a flush's
+	Backlog  int   // The most Pending may reach
+	Received int64 // Heartbeats buffered
+	Rows     int64 // Rows written; Received - Rows - Pending were coalesced away
+	Batches  int64 // Statements run
+	Failures int64 // Statements that failed; their rows are retried next flush
+	Rejected int64 // Heartbeats refused with ErrBacklogFull
+}
+
+// Coalesce routes the store's heartbeats through a new Coalescer flushing
+// every interval or maxBatch users and holding at most maxBacklog users'
+// heartbeats, and returns it. Zero sizes take the defaults. Call it before
+// serving requests, and Close the coalescer on shutdown to write what is
+// pending
+func (s *SQLStore) Coalesce(interval time.Duration, maxBatch, maxBacklog int, logger *slog.Logger) *Coalescer {
+	if maxBatch <= 0 {
+		maxBatch = DefaultCoalesceBatch
+	}
+	if maxBacklog <= 0 {
+		maxBacklog = DefaultCoalesceBacklog
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	c := &Coalescer{
+		store:      s,
+		interval:   interval,
+		maxBatch:   maxBatch,
+		maxBacklog: maxBacklog,
+		logger:     logger,
+		pending:    make(map[string]time.Time),
+		full:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	s.coalescer = c
+	go c.loop()
+	return c
+}
+
+// Heartbeat buffers a heartbeat from userID at now, replacing an older one
+// still pending for the same user
+func (c *Coalescer) Heartbeat(userID string, now time.Time) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrCoalescerClosed
+	}
+	last, ok := c.pending[userID]
+	if !ok && len(c.pending)+len(c.flushing) >= c.maxBacklog {
+		c.mu.Unlock()
+		c.rejected.Add(1)
+		return ErrBacklogFull
+	}
+	if !ok || now.After(last) {
+		c.pending[userID] = now
+	}
+	full := len(c.pending) >= c.maxBatch
+	c.mu.Unlock()
+
+	c.received.Add(1)
+	if full {
+		select {
+		case c.full <- struct{}{}:
+		default: // A flush is already due
+		}
+	}
+	return nil
+}
+
+// Stats returns the coalescer's counters
+func (c *Coalescer) Stats() CoalescerStats {
+	c.mu.Lock()
+	pending := len(c.pending) + len(c.flushing)
+	c.mu.Unlock()
+	return CoalescerStats{
+		Pending:  pending,
+		Backlog:  c.maxBacklog,
+		Received: c.received.Load(),
+		Rows:     c.rows.Load(),
+		Batches:  c.batches.Load(),
+		Failures: c.failures.Load(),
+		Rejected: c.rejected.Load(),
+	}
+}
+
+// EnableMetrics registers Prometheus metrics for the coalescer's backlog
+// and flushes with the given registry, under namespace
+func (c *Coalescer) EnableMetrics(registry prometheus.Registerer, namespace string) error {
+	gauge := func(name, help string, value func(CoalescerStats) int) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(c.Stats())) })
+	}
+	counter := func(name, help string, value func(CoalescerStats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(c.Stats())) })
+	}
+	for _, m := range []prometheus.Collector{
+		gauge("heartbeat_backlog", "Users with a buffered heartbeat not yet written.",
+			func(s CoalescerStats) int { return s.Pending }),
+		gauge("heartbeat_backlog_limit", "The most users' heartbeats kept buffered.",
+			func(s CoalescerStats) int { return s.Backlog }),
+		counter("heartbeats_buffered_total", "Heartbeats accepted into the buffer.",
+			func(s CoalescerStats) int64 { return s.Received }),
+		counter("heartbeat_rows_written_total", "Buffered heartbeats written to the database.",
+			func(s CoalescerStats) int64 { return s.Rows }),
+		counter("heartbeat_flushes_total", "Multi-row heartbeat statements run.",
+			func(s CoalescerStats) int64 { return s.Batches }),
+		counter("heartbeat_flush_failures_total", "Multi-row heartbeat statements that failed.",
+			func(s CoalescerStats) int64 { return s.Failures }),
+		counter("heartbeats_rejected_total", "Heartbeats refused because the backlog was full.",
+			func(s CoalescerStats) int64 { return s.Rejected }),
+	} {
+		if err := registry.Register(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overlay raises lastSeen, keyed by user ID and in Unix seconds, to the
+// pending heartbeats of userIDs, so a status read right after a heartbeat
+// doesn't miss it
+func (c *Coalescer) overlay(userIDs []string, lastSeen map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range userIDs {
+		for _, m := range []map[string]time.Time{c.flushing, c.pending} {
+			if seen, ok := m[id]; ok && seen.Unix() > lastSeen[id] {
+				lastSeen[id] = seen.Unix()
+			}
+		}
+	}
+}
+
+// Close stops accepting heartbeats and writes the pending ones, giving up
+// when ctx ends
+func (c *Coalescer) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	close(c.stop)
+	select {
+	case <-c.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return c.flush(ctx)
+}
+
+// loop flushes every interval, or early once a batch is full, until Close
+func (c *Coalescer) loop() {
+	defer close(c.stopped)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.full:
+		case <-c.stop:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		if err := c.flush(ctx); err != nil {
+			c.logger.Warn("Failed to flush heartbeats, retrying next flush", "error", err)
+		}
+		cancel()
+	}
+}
+
+// flush writes every pending heartbeat, maxBatch users per statement. On
+// failure the unwritten heartbeats go back into the buffer, unless a newer
+// one for the same user arrived meanwhile
+func (c *Coalescer) flush(ctx context.Context) error {
+	c.flushLock.Lock()
+	defer c.flushLock.Unlock()
+
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	batch := make([]heartbeat, 0, len(c.pending))
+	for userID, seen := range c.pending {
+		batch = append(batch, heartbeat{userID: userID, seen: seen})
+	}
+	c.flushing = c.pending
+	c.pending = make(map[string]time.Time, len(batch))
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.flushing = nil
+		c.mu.Unlock()
+	}()
+
+	// A fixed row order keeps concurrent flushers from other instances from
+	// deadlocking on each other's row locks
+	sort.Slice(batch, func(i, j int) bool { return batch[i].userID < batch[j].userID })
+	for len(batch) > 0 {
+		n := min(len(batch), c.maxBatch)
+		err := c.store.writeHeartbeats(ctx, batch[:n])
+		c.batches.Add(1)
+		if err != nil {
+			c.failures.Add(1)
+			c.requeue(batch)
+			return err
+		}
+		c.rows.Add(int64(n))
+		batch = batch[n:]
+	}
+	return nil
+}
+
+// drop discards userID's pending heartbeat
+func (c *Coalescer) drop(userID string) {
+	c.mu.Lock()
+	delete(c.pending, userID)
+	c.mu.Unlock()
+}
+
+// requeue puts heartbeats that failed to write back into the buffer
+func (c *Coalescer) requeue(batch []heartbeat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, hb := range batch {
+		if last, ok := c.pending[hb.userID]; !ok || hb.seen.After(last) {
+			c.pending[hb.userID] = hb.seen
+		}
+	}
+}
+
+// heartbeat is one user's buffered heartbeat
+type heartbeat struct {
+	userID string
+	seen   time.Time
+}
+
+// writeHeartbeats upserts batch with one statement. Its text depends on
+// the batch size, so it isn't taken from the statement cache
+func (s *SQLStore) writeHeartbeats(ctx context.Context, batch []heartbeat) error {
+	// With the detector on, new rows and updated ones are online
+	columns, status := "user_id, last_seen", ""
+	if s.offline != nil {
+		columns, status = "user_id, last_seen, status", ", 'online'"
+	}
+	var b strings.Builder
+	b.WriteString("INSERT INTO user_status (" + columns + ") VALUES ")
+	args := make([]any, 0, 2*len(batch))
+	for i, hb := range batch {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(" + s.placeholders(2*i+1, 2) + status + ")")
+		args = append(args, hb.userID, hb.seen.Unix())
+	}
+	b.WriteString(heartbeatUpsertSuffixes[s.driverName])
+	if s.offline != nil {
+		b.WriteString(", status = 'online'")
+	}
+
+	ctx = pool.WithHolder(ctx, "presence heartbeat flush")
+	return s.writes.With(ctx, func(conn *sql.DB) error {
+		_, err := conn.ExecContext(ctx, b.String(), args...)
+		return err
+	})
+}
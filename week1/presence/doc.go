@@ -0,0 +1,14 @@
+// Package presence is the online/offline indicator's storage and its gRPC
+// service. Clients send a heartbeat every few seconds; a user counts as
+// online while their last one is within the store's online window. The
+// user_status table is sparse: users never seen have no row and are
+// offline. An OfflineDetector can instead mark users offline in a status
+// column as they time out. The heartbeat demo serves the same Store over
+// HTTP.
+//
+// presencepb holds the protobuf definitions and the code generated from
+// them with protoc-gen-go and protoc-gen-go-grpc; client is the heartbeat
+// loop for apps to embed
+package presence
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative presencepb/presence.proto
@@ -0,0 +1,142 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/system-design/week1/pool"
+	"github.com/system-design/week1/presence/presencepb"
+)
+
+// Server implements the Presence gRPC service over a Store
+type Server struct {
+	presencepb.UnimplementedPresenceServer
+
+	store  Store
+	logger *slog.Logger
+
+	// Thresholds describe the users in replies, telling online ones from
+	// away ones; NewServer sets DefaultThresholds
+	Thresholds Thresholds
+}
+
+// NewServer returns the Presence service for store. A nil logger uses
+// slog's default
+func NewServer(store Store, logger *slog.Logger) *Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Server{store: store, logger: logger, Thresholds: DefaultThresholds}
+}
+
+// Register adds the service to s
+func (srv *Server) Register(s grpc.ServiceRegistrar) {
+	presencepb.RegisterPresenceServer(s, srv)
+}
+
+// Heartbeat records that a user is online
+func (srv *Server) Heartbeat(ctx context.Context, req *presencepb.HeartbeatRequest) (*presencepb.HeartbeatResponse, error) {
+	seen, err := srv.store.Heartbeat(ctx, req.GetUserId())
+	if err != nil {
+		return nil, srv.statusError("Heartbeat", err)
+	}
+	return &presencepb.HeartbeatResponse{LastSeen: timestamppb.New(seen)}, nil
+}
+
+// GetStatus reports whether a user is online
+func (srv *Server) GetStatus(ctx context.Context, req *presencepb.GetStatusRequest) (*presencepb.GetStatusResponse, error) {
+	st, err := srv.store.Status(ctx, req.GetUserId())
+	if err != nil {
+		return nil, srv.statusError("GetStatus", err)
+	}
+	return &presencepb.GetStatusResponse{Status: srv.toProto(st, time.Now())}, nil
+}
+
+// BatchGetStatus reports whether each of several users is online, with
+// an error on each user that couldn't be read
+func (srv *Server) BatchGetStatus(ctx context.Context, req *presencepb.BatchGetStatusRequest) (*presencepb.BatchGetStatusResponse, error) {
+	results, err := BatchGetStatus(ctx, srv.store, req.GetUserIds())
+	if err != nil {
+		return nil, srv.statusError("BatchGetStatus", err)
+	}
+	resp := &presencepb.BatchGetStatusResponse{Statuses: make([]*presencepb.UserStatus, len(results))}
+	messages := make(map[string]string) // A failed chunk fails many users; log it once
+	now := time.Now()
+	for i, res := range results {
+		if res.Err == nil {
+			resp.Statuses[i] = srv.toProto(res.Status, now)
+			continue
+		}
+		resp.Statuses[i] = &presencepb.UserStatus{UserId: res.UserID}
+		msg, ok := messages[res.Err.Error()]
+		if !ok {
+			msg = status.Convert(srv.statusError("BatchGetStatus", res.Err)).Message()
+			messages[res.Err.Error()] = msg
+		}
+		resp.Statuses[i].Error = msg
+	}
+	return resp, nil
+}
+
+// GetLastSeen reports when a user was last seen, with the state to show
+func (srv *Server) GetLastSeen(ctx context.Context, req *presencepb.GetLastSeenRequest) (*presencepb.GetLastSeenResponse, error) {
+	ls, err := GetLastSeen(ctx, srv.store, req.GetUserId(), srv.Thresholds)
+	if err != nil {
+		return nil, srv.statusError("GetLastSeen", err)
+	}
+	resp := &presencepb.GetLastSeenResponse{UserId: ls.UserID, State: stateToProto[ls.State], Display: ls.Display}
+	if !ls.LastSeen.IsZero() {
+		resp.LastSeen = timestamppb.New(ls.LastSeen)
+	}
+	return resp, nil
+}
+
+// stateToProto maps States to their enum values
+var stateToProto = map[State]presencepb.PresenceState{
+	StateOnline:       presencepb.PresenceState_PRESENCE_STATE_ONLINE,
+	StateAway:         presencepb.PresenceState_PRESENCE_STATE_AWAY,
+	StateRecentlySeen: presencepb.PresenceState_PRESENCE_STATE_RECENTLY_SEEN,
+	StateOffline:      presencepb.PresenceState_PRESENCE_STATE_OFFLINE,
+	StateNeverSeen:    presencepb.PresenceState_PRESENCE_STATE_NEVER_SEEN,
+}
+
+// toProto converts a Status to its message, with its state as of now
+func (srv *Server) toProto(st Status, now time.Time) *presencepb.UserStatus {
+	msg := &presencepb.UserStatus{UserId: st.UserID, Online: st.Online, State: stateToProto[srv.Thresholds.State(st, now)]}
+	if !st.LastSeen.IsZero() {
+		msg.LastSeen = timestamppb.New(st.LastSeen)
+	}
+	return msg
+}
+
+// statusError maps a Store error to a gRPC status. A saturated or
+// unavailable pool is Unavailable, which clients may retry with backoff
+func (srv *Server) statusError(method string, err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidUserID):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, pool.ErrAcquireTimeout),
+		errors.Is(err, pool.ErrPoolExhausted),
+		errors.Is(err, pool.ErrCircuitOpen),
+		errors.Is(err, pool.ErrPoolPaused),
+		errors.Is(err, pool.ErrPoolClosed),
+		errors.Is(err, ErrBacklogFull),
+		errors.Is(err, ErrCoalescerClosed):
+		srv.logger.Warn("Presence request failed", "method", method, "error", err)
+		return status.Error(codes.Unavailable, "service busy, retry later")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		srv.logger.Error("Presence request failed", "method", method, "error", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
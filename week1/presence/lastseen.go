@@ -0,0 +1,139 @@
+package presence
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// State is how a user's presence is shown
+type State int
+
+const (
+	StateOnline       State = iota + 1 // Online, with a heartbeat within the Away threshold
+	StateAway                          // Online, but idle past the Away threshold
+	StateRecentlySeen                  // Offline, but seen within the RecentlySeen threshold
+	StateOffline                       // Seen, longer ago than RecentlySeen
+	StateNeverSeen                     // No heartbeat on record
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOnline:
+		return "online"
+	case StateAway:
+		return "away"
+	case StateRecentlySeen:
+		return "recently_seen"
+	case StateOffline:
+		return "offline"
+	case StateNeverSeen:
+		return "never_seen"
+	default:
+		return "unknown"
+	}
+}
+
+// parseState is the inverse of State.String, giving 0 for unknown names
+func parseState(name string) State {
+	for s := StateOnline; s <= StateNeverSeen; s++ {
+		if s.String() == name {
+			return s
+		}
+	}
+	return 0
+}
+
+// LastSeen is a user's last heartbeat together with the state derived from
+// it, so every client shows the same thing
+type LastSeen struct {
+	UserID   string
+	LastSeen time.Time // Zero for users never seen
+	State    State
+	Display  string // e.g. "online", "away", "recently seen", "last seen 5m ago"
+}
+
+// Thresholds turn a Status into a LastSeen
+type Thresholds struct {
+	// Away is how long an online user may go without a heartbeat before
+	// showing as away: idle, say with the app in the background, but not
+	// yet gone for the store's online window. It should lie between the
+	// clients' heartbeat interval and the online window; zero shows online
+	// users as online throughout. A connected WebSocket heartbeats for its
+	// user at least twice per Away, so keeps them online
+	Away time.Duration
+	// RecentlySeen is how long after going offline a user still shows as
+	// recently seen, rather than when they were last seen; zero never does
+	RecentlySeen time.Duration
+	// Absolute is the age past which Display gives the date last seen
+	// rather than how long ago
+	Absolute time.Duration
+}
+
+// DefaultThresholds never show users as away, as which idle time counts
+// depends on the clients' heartbeat interval. They show users as recently
+// seen for 5 minutes after going offline, and the date once they've been
+// gone a week
+var DefaultThresholds = Thresholds{RecentlySeen: 5 * time.Minute, Absolute: 7 * 24 * time.Hour}
+
+// GetLastSeen reports when userID was last seen, described by th
+func GetLastSeen(ctx context.Context, store Store, userID string, th Thresholds) (LastSeen, error) {
+	st, err := store.Status(ctx, userID)
+	if err != nil {
+		return LastSeen{}, err
+	}
+	return th.Describe(st, time.Now()), nil
+}
+
+// Describe derives st's state and display text as of now
+func (th Thresholds) Describe(st Status, now time.Time) LastSeen {
+	ls := LastSeen{UserID: st.UserID, LastSeen: st.LastSeen, State: th.State(st, now)}
+	switch ls.State {
+	case StateOnline, StateAway:
+		ls.Display = ls.State.String()
+	case StateRecentlySeen:
+		ls.Display = "recently seen"
+	case StateNeverSeen:
+		ls.Display = "never seen"
+	default:
+		ls.Display = th.ago(st.LastSeen, now.Sub(st.LastSeen))
+	}
+	return ls
+}
+
+// State derives st's state as of now
+func (th Thresholds) State(st Status, now time.Time) State {
+	switch {
+	case st.Online && th.idle(st.LastSeen, now):
+		return StateAway
+	case st.Online:
+		return StateOnline
+	case st.LastSeen.IsZero():
+		return StateNeverSeen
+	case now.Sub(st.LastSeen) < th.RecentlySeen:
+		return StateRecentlySeen
+	default:
+		return StateOffline
+	}
+}
+
+// idle reports whether a user last seen at seen counts as away by now
+func (th Thresholds) idle(seen, now time.Time) bool {
+	return th.Away > 0 && now.Sub(seen) >= th.Away
+}
+
+// ago describes a heartbeat age old, in the largest whole unit
+func (th Thresholds) ago(seen time.Time, age time.Duration) string {
+	switch {
+	case th.Absolute > 0 && age >= th.Absolute:
+		return "last seen on " + seen.Format("2 Jan 2006")
+	case age < time.Minute:
+		return "last seen just now"
+	case age < time.Hour:
+		return "last seen " + strconv.Itoa(int(age/time.Minute)) + "m ago"
+	case age < 24*time.Hour:
+		return "last seen " + strconv.Itoa(int(age/time.Hour)) + "h ago"
+	default:
+		return "last seen " + strconv.Itoa(int(age/(24*time.Hour))) + "d ago"
+	}
+}
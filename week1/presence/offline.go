@@ -0,0 +1,286 @@
+package presence
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/system-design/week1/pool"
+)
+
+// Status column values
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// sweepBatch is the most users one sweep transaction marks offline
+const sweepBatch = 500
+
+// offlineCandidates select online users whose last heartbeat is older than
+// a cutoff, locking them until the sweep commits. SKIP LOCKED lets several
+// instances' detectors sweep at once without marking a user twice; SQLite
+// locks the whole database for the write anyway
+var offlineCandidates = map[string]string{
+	"mysql":    "SELECT user_id, last_seen FROM user_status WHERE status = 'online' AND last_seen < ? ORDER BY last_seen LIMIT ? FOR UPDATE SKIP LOCKED",
+	"postgres": "SELECT user_id, last_seen FROM user_status WHERE status = 'online' AND last_seen < $1 ORDER BY last_seen LIMIT $2 FOR UPDATE SKIP LOCKED",
+	"sqlite":   "SELECT user_id, last_seen FROM user_status WHERE status = 'online' AND last_seen < ? ORDER BY last_seen LIMIT ?",
+}
+
+// heartbeatStatusUpserts are heartbeatUpserts that also bring the status
+// column back online
+var heartbeatStatusUpserts = map[string]string{
+	"mysql":    "INSERT INTO user_status (user_id, last_seen, status) VALUES (?, ?, 'online') ON DUPLICATE KEY UPDATE last_seen = VALUES(last_seen), status = 'online'",
+	"postgres": "INSERT INTO user_status (user_id, last_seen, status) VALUES ($1, $2, 'online') ON CONFLICT (user_id) DO UPDATE SET last_seen = EXCLUDED.last_seen, status = 'online'",
+	"sqlite":   "INSERT INTO user_status (user_id, last_seen, status) VALUES (?, ?, 'online') ON CONFLICT (user_id) DO UPDATE SET last_seen = excluded.last_seen, status = 'online'",
+}
+
+// offlineUpdates record a disconnect for each driver: the user was seen
+// until now, and is offline from now
+var offlineUpdates = map[string]string{
+	"mysql":    "UPDATE user_status SET last_seen = ?, status = 'offline' WHERE user_id = ? AND status = 'online'",
+	"postgres": "UPDATE user_status SET last_seen = $1, status = 'offline' WHERE user_id = $2 AND status = 'online'",
+	"sqlite":   "UPDATE user_status SET last_seen = ?, status = 'offline' WHERE user_id = ? AND status = 'online'",
+}
+
+// backdateUpdates record a disconnect without a status column: an online
+// user's last_seen moves back to the edge of the online window, so reads
+// count them offline from now
+var backdateUpdates = map[string]string{
+	"mysql":    "UPDATE user_status SET last_seen = ? WHERE user_id = ? AND last_seen > ?",
+	"postgres": "UPDATE user_status SET last_seen = $1 WHERE user_id = $2 AND last_seen > $3",
+	"sqlite":   "UPDATE user_status SET last_seen = ? WHERE user_id = ? AND last_seen > ?",
+}
+
+// OfflineEvent reports that a user was marked offline
+type OfflineEvent struct {
+	UserID   string
+	LastSeen time.Time // The heartbeat the user timed out after, or their disconnect
+	Time     time.Time // When they were marked
+}
+
+// OfflineDetector periodically marks online users whose last heartbeat is
+// older than the store's online window offline, in user_status.status,
+// and emits an OfflineEvent for each. Readers then take the column as is
+// instead of comparing last_seen to the clock, and consumers learn of a
+// user going offline without polling. It needs the column, which defaults
+// to online so existing rows and first heartbeats need no backfill:
+//
+//	ALTER TABLE user_status ADD COLUMN status VARCHAR(8) NOT NULL DEFAULT 'online';
+//	CREATE INDEX user_status_status_last_seen ON user_status (status, last_seen);
+//
+// Create one with SQLStore.DetectOffline
+type OfflineDetector struct {
+	store    *SQLStore
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu   sync.RWMutex
+	subs map[int]func(OfflineEvent)
+	next int
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// DetectOffline starts an OfflineDetector sweeping every interval, and
+// switches the store to keeping and reading the status column. Call it
+// before serving requests, and Close the detector on shutdown
+func (s *SQLStore) DetectOffline(interval time.Duration, logger *slog.Logger) *OfflineDetector {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	d := &OfflineDetector{
+		store:    s,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	s.upsert = heartbeatStatusUpserts[s.driverName]
+	s.offline = d
+	go d.loop()
+	return d
+}
+
+// Subscribe calls fn for every user marked offline until the returned
+// function is called. fn runs on the detector's goroutine after the sweep
+// commits, so it must be quick
+func (d *OfflineDetector) Subscribe(fn func(OfflineEvent)) (unsubscribe func()) {
+	d.mu.Lock()
+	if d.subs == nil {
+		d.subs = make(map[int]func(OfflineEvent))
+	}
+	id := d.next
+	d.next++
+	d.subs[id] = fn
+	d.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			delete(d.subs, id)
+			d.mu.Unlock()
+		})
+	}
+}
+
+// Close stops the detector, waiting for a sweep in progress
+func (d *OfflineDetector) Close() {
+	d.once.Do(func() { close(d.stop) })
+	<-d.stopped
+}
+
+// loop sweeps every interval until Close
+func (d *OfflineDetector) loop() {
+	defer close(d.stopped)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), d.interval)
+		if n, err := d.Sweep(ctx); err != nil {
+			d.logger.Warn("Offline sweep failed", "error", err, "marked", n)
+		} else if n > 0 {
+			d.logger.Debug("Offline sweep done", "marked", n)
+		}
+		cancel()
+	}
+}
+
+// Sweep marks every user past the online window offline now, a batch per
+// transaction, and returns how many it marked
+func (d *OfflineDetector) Sweep(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		events, err := d.sweepBatch(ctx)
+		total += len(events)
+		d.emit(events)
+		if err != nil || len(events) < sweepBatch {
+			return total, err
+		}
+	}
+}
+
+// sweepBatch marks up to sweepBatch users offline in one transaction. The
+// UPDATE repeats the candidates' conditions, so a heartbeat landing
+// between the SELECT and the UPDATE where the database doesn't lock the
+// rows still keeps its user online
+func (d *OfflineDetector) sweepBatch(ctx context.Context) ([]OfflineEvent, error) {
+	s := d.store
+	cutoff := time.Now().Add(-s.onlineWindow).Unix()
+	var events []OfflineEvent
+	ctx = pool.WithHolder(ctx, "presence offline sweep")
+	err := s.split.Primary().With(ctx, func(conn *sql.DB) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		rows, err := tx.QueryContext(ctx, offlineCandidates[s.driverName], cutoff, sweepBatch)
+		if err != nil {
+			return err
+		}
+		args := []any{cutoff}
+		for rows.Next() {
+			var ev OfflineEvent
+			var seen int64
+			if err := rows.Scan(&ev.UserID, &seen); err != nil {
+				rows.Close()
+				return err
+			}
+			ev.LastSeen = time.Unix(seen, 0).UTC()
+			events = append(events, ev)
+			args = append(args, ev.UserID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		query := "UPDATE user_status SET status = 'offline' WHERE status = 'online' AND last_seen < " +
+			s.placeholders(1, 1) + " AND user_id IN (" + s.placeholders(2, len(events)) + ")"
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range events {
+		events[i].Time = now
+	}
+	return events, nil
+}
+
+// Offline marks userID offline now and emits their OfflineEvent. Without
+// a detector there is no status column to mark, so an online user's
+// last_seen is moved back by the online window instead: they are offline
+// at once, but show as last seen that much earlier
+func (s *SQLStore) Offline(ctx context.Context, userID string) error {
+	if err := ValidUserID(userID); err != nil {
+		return err
+	}
+	if s.coalescer != nil {
+		// A buffered heartbeat flushed after this would bring the user back
+		// online; drop it and keep flushes out until the update is done
+		s.coalescer.flushLock.Lock()
+		defer s.coalescer.flushLock.Unlock()
+		s.coalescer.drop(userID)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	ctx = pool.WithHolder(ctx, "presence offline "+userID)
+	if s.offline == nil {
+		cutoff := now.Add(-s.onlineWindow).Unix()
+		return s.writes.With(ctx, func(conn *sql.DB) error {
+			_, err := conn.ExecContext(ctx, backdateUpdates[s.driverName], cutoff, userID, cutoff)
+			return err
+		})
+	}
+	var marked bool
+	err := s.writes.With(ctx, func(conn *sql.DB) error {
+		res, err := conn.ExecContext(ctx, offlineUpdates[s.driverName], now.Unix(), userID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		marked = n > 0
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if marked {
+		s.offline.emit([]OfflineEvent{{UserID: userID, LastSeen: now, Time: now}})
+	}
+	return nil
+}
+
+// emit delivers events to every subscriber
+func (d *OfflineDetector) emit(events []OfflineEvent) {
+	if len(events) == 0 {
+		return
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, ev := range events {
+		for _, fn := range d.subs {
+			fn(ev)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package presence
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// publishTimeout bounds handing one change to the backend
+const publishTimeout = 2 * time.Second
+
+// confirmTimeout bounds re-reading the store before announcing users away
+// or offline
+const confirmTimeout = 2 * time.Second
+
+// ChangeBackend carries status changes between instances. Every change
+// published by any instance is delivered to every instance's Subscribe,
+// its own included. RedisChanges is one on Redis Pub/Sub
+type ChangeBackend interface {
+	Publish(ctx context.Context, change StatusChange) error
+	// Subscribe calls fn for each change until ctx ends
+	Subscribe(ctx context.Context, fn func(StatusChange)) error
+}
+
+// Publisher is a Store that announces online, away and offline transitions
+// to subscribers, so components such as chat or notifications can react to
+// them without polling the database. A user goes online with their first
+// heartbeat, away once a heartbeat hasn't come within the away threshold,
+// back online with the next one, and offline on Offline or once a
+// heartbeat hasn't come within the online window. Transitions are those
+// of the heartbeats this instance serves, but away and offline are
+// confirmed against the store first: a user whose heartbeats moved to
+// another instance, as non-sticky HTTP heartbeats may, is left to that
+// instance to announce rather than announced offline here. With a
+// backend, changes reach subscribers on every instance; without one,
+// only this instance's. Create one with NewPublisher
+type Publisher struct {
+	Store
+	onlineWindow time.Duration
+	awayAfter    time.Duration // Zero never announces users away
+	backend      ChangeBackend
+	logger       *slog.Logger
+
+	mu     sync.Mutex
+	online map[string]onlineUser // Each user online here
+
+	// Kept up with each transition, for metrics that never count users
+	users       [StateNeverSeen + 1]atomic.Int64 // Users here per state: online or away
+	transitions [StateNeverSeen + 1]atomic.Int64 // Transitions into each state
+
+	subsMu sync.RWMutex
+	subs   map[int]chan StatusChange
+	next   int
+
+	cancel  context.CancelFunc
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// onlineUser is a user online here
+type onlineUser struct {
+	seen time.Time // Last heartbeat
+	away bool      // Announced away
+}
+
+// state is the user's state here, as one of online users if online
+func (u onlineUser) state(online bool) State {
+	switch {
+	case !online:
+		return StateOffline
+	case u.away:
+		return StateAway
+	default:
+		return StateOnline
+	}
+}
+
+// NewPublisher wraps store in a Publisher, announcing users away after
+// awayAfter without a heartbeat; zero never does. backend may be nil to
+// keep changes in-process. A nil logger uses slog's default
+func NewPublisher(store Store, onlineWindow, awayAfter time.Duration, backend ChangeBackend, logger *slog.Logger) *Publisher {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Publisher{
+		Store:        store,
+		onlineWindow: onlineWindow,
+		awayAfter:    awayAfter,
+		backend:      backend,
+		logger:       logger,
+		online:       make(map[string]onlineUser),
+		subs:         make(map[int]chan StatusChange),
+		cancel:       cancel,
+		stopped:      make(chan struct{}),
+	}
+	go p.expire(ctx)
+	if backend != nil {
+		go p.receive(ctx)
+	}
+	return p
+}
+
+// Subscribe returns a channel receiving every status change, buffered to
+// hold buffer of them. Changes arriving while the buffer is full are
+// dropped rather than holding up heartbeats. The returned function
+// unsubscribes and closes the channel
+func (p *Publisher) Subscribe(buffer int) (<-chan StatusChange, func()) {
+	ch := make(chan StatusChange, buffer)
+	p.subsMu.Lock()
+	id := p.next
+	p.next++
+	p.subs[id] = ch
+	p.subsMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			p.subsMu.Lock()
+			delete(p.subs, id) // No send is in flight once this returns
+			p.subsMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Heartbeat records the heartbeat, announcing the user online unless they
+// already were and weren't away
+func (p *Publisher) Heartbeat(ctx context.Context, userID string) (time.Time, error) {
+	seen, err := p.Store.Heartbeat(ctx, userID)
+	if err != nil {
+		return seen, err
+	}
+	p.mu.Lock()
+	prev, wasOnline := p.online[userID]
+	p.online[userID] = onlineUser{seen: seen}
+	if !wasOnline || prev.away {
+		p.count(prev.state(wasOnline), StateOnline)
+	}
+	p.mu.Unlock()
+	if !wasOnline || prev.away {
+		p.publish(StatusChange{Status: Status{UserID: userID, Online: true, LastSeen: seen}, State: StateOnline, Time: time.Now()})
+	}
+	return seen, nil
+}
+
+// Offline records the disconnect, announcing the user offline if they
+// were online here
+func (p *Publisher) Offline(ctx context.Context, userID string) error {
+	if err := p.Store.Offline(ctx, userID); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	prev, wasOnline := p.online[userID]
+	delete(p.online, userID)
+	if wasOnline {
+		p.count(prev.state(true), StateOffline)
+	}
+	p.mu.Unlock()
+	if wasOnline {
+		now := time.Now()
+		p.publish(StatusChange{Status: Status{UserID: userID, LastSeen: now.Truncate(time.Second)}, State: StateOffline, Time: now})
+	}
+	return nil
+}
+
+// Close stops announcing changes and closes every subscription
+func (p *Publisher) Close() {
+	p.once.Do(func() {
+		p.cancel()
+		<-p.stopped
+		p.subsMu.Lock()
+		for id, ch := range p.subs {
+			delete(p.subs, id)
+			close(ch)
+		}
+		p.subsMu.Unlock()
+	})
+}
+
+// expire announces users whose heartbeats stopped away, then offline,
+// checking a few times per threshold. Each is confirmed against the store
+// first; a user the store can't be read for is checked again next time
+func (p *Publisher) expire(ctx context.Context) {
+	defer close(p.stopped)
+	check := p.onlineWindow
+	if p.awayAfter > 0 {
+		check = min(check, p.awayAfter)
+	}
+	ticker := time.NewTicker(max(check/4, 100*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		for _, change := range p.expired(ctx, time.Now()) {
+			p.publish(change)
+		}
+	}
+}
+
+// expired moves the users whose heartbeats stopped as of now away or
+// offline, returning the changes to announce
+func (p *Publisher) expired(ctx context.Context, now time.Time) []StatusChange {
+	p.mu.Lock()
+	due := make(map[string]onlineUser)
+	var ids []string
+	for id, u := range p.online {
+		age := now.Sub(u.seen)
+		if age >= p.onlineWindow || (p.awayAfter > 0 && age >= p.awayAfter && !u.away) {
+			due[id] = u
+			ids = append(ids, id)
+		}
+	}
+	p.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Re-read outside p.mu so heartbeats aren't held up by the store
+	readCtx, cancel := context.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+	results, err := BatchGetStatus(readCtx, p.Store, ids)
+	if err != nil {
+		p.logger.Warn("Failed to confirm expired users", "users", len(ids), "error", err)
+		return nil
+	}
+
+	var changes []StatusChange
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range results {
+		u := due[r.UserID]
+		if r.Err != nil {
+			p.logger.Warn("Failed to confirm expired user", "user_id", r.UserID, "error", r.Err)
+			continue
+		}
+		if cur, ok := p.online[r.UserID]; !ok || cur != u {
+			continue // A heartbeat or Offline here since
+		}
+		switch age := now.Sub(u.seen); {
+		case r.LastSeen.After(u.seen):
+			// Heartbeating through another instance, which announces them
+			// from now on
+			delete(p.online, r.UserID)
+			p.users[u.state(true)].Add(-1)
+		case age >= p.onlineWindow:
+			if r.Online {
+				continue // Still online by the store's clock; next time
+			}
+			delete(p.online, r.UserID)
+			p.count(u.state(true), StateOffline)
+			changes = append(changes, StatusChange{Status: Status{UserID: r.UserID, LastSeen: u.seen}, State: StateOffline, Time: now})
+		default:
+			p.online[r.UserID] = onlineUser{seen: u.seen, away: true}
+			p.count(StateOnline, StateAway)
+			changes = append(changes, StatusChange{Status: Status{UserID: r.UserID, Online: true, LastSeen: u.seen}, State: StateAway, Time: now})
+		}
+	}
+	return changes
+}
+
+// count moves a user from one state to another in the metrics. Must be
+// called with p.mu held
+func (p *Publisher) count(from, to State) {
+	if from != StateOffline {
+		p.users[from].Add(-1)
+	}
+	if to != StateOffline {
+		p.users[to].Add(1)
+	}
+	p.transitions[to].Add(1)
+}
+
+// EnableMetrics registers gauges of the users online and away, and counters
+// of the transitions into each state, whose rate is transitions per second.
+// They are kept up as users change state rather than counted from the
+// store, so a scrape costs nothing however many users there are. Like the
+// transitions, they cover this instance's users: sum them across instances
+func (p *Publisher) EnableMetrics(registry prometheus.Registerer, namespace string) error {
+	var metrics []prometheus.Collector
+	for _, state := range []State{StateOnline, StateAway} {
+		state := state
+		metrics = append(metrics, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "users",
+			Help:        "Users currently in each state, online or away.",
+			ConstLabels: prometheus.Labels{"state": state.String()},
+		}, func() float64 { return float64(p.users[state].Load()) }))
+	}
+	for _, state := range []State{StateOnline, StateAway, StateOffline} {
+		state := state
+		metrics = append(metrics, prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "transitions_total",
+			Help:        "Users going online, away or offline.",
+			ConstLabels: prometheus.Labels{"to": state.String()},
+		}, func() float64 { return float64(p.transitions[state].Load()) }))
+	}
+	for _, m := range metrics {
+		if err := registry.Register(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish hands change to the backend, or straight to the subscribers
+// without one
+func (p *Publisher) publish(change StatusChange) {
+	if p.backend == nil {
+		p.deliver(change)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := p.backend.Publish(ctx, change); err != nil {
+		p.logger.Warn("Failed to publish status change", "user_id", change.UserID, "state", change.State, "error", err)
+	}
+}
+
+// receive delivers the backend's changes until Close, resubscribing after
+// a failure
+func (p *Publisher) receive(ctx context.Context) {
+	for {
+		err := p.backend.Subscribe(ctx, p.deliver)
+		if ctx.Err() != nil {
+			return
+		}
+		p.logger.Warn("Status change subscription failed, resubscribing", "error", err)
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver sends change to every subscriber with room for it
+func (p *Publisher) deliver(change StatusChange) {
+	p.subsMu.RLock()
+	defer p.subsMu.RUnlock()
+	for _, ch := range p.subs {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces the presence keys
+const redisKeyPrefix = "presence:"
+
+// RedisStore keeps each user's last heartbeat in Redis, as Unix seconds
+// under a key that SET with EX expires after the online window: a user is
+// online exactly while their key exists, with no clock comparison and
+// nothing to clean up. Statuses are read from Redis alone; durable, if set,
+// also records every heartbeat and supplies last_seen for users whose key
+// has expired
+type RedisStore struct {
+	client       redis.Cmdable
+	onlineWindow time.Duration
+	durable      Store
+}
+
+// NewRedisStore creates a RedisStore on client, which may be a cluster
+// client. durable, e.g. a SQLStore, keeps last_seen beyond the online
+// window; nil keeps nothing once a key expires
+func NewRedisStore(client redis.Cmdable, onlineWindow time.Duration, durable Store) *RedisStore {
+	// EX counts whole seconds
+	if onlineWindow < time.Second {
+		onlineWindow = time.Second
+	}
+	return &RedisStore{client: client, onlineWindow: onlineWindow.Truncate(time.Second), durable: durable}
+}
+
+// Heartbeat records that userID is online, in Redis and then in the
+// durable store. A durable failure is returned even though the user
+// already shows as online, so the client retries until last_seen is kept
+func (s *RedisStore) Heartbeat(ctx context.Context, userID string) (time.Time, error) {
+	if err := ValidUserID(userID); err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now().Truncate(time.Second)
+	if err := s.client.Set(ctx, redisKeyPrefix+userID, now.Unix(), s.onlineWindow).Err(); err != nil {
+		return time.Time{}, fmt.Errorf("presence: redis: %w", err)
+	}
+	if s.durable != nil {
+		if _, err := s.durable.Heartbeat(ctx, userID); err != nil {
+			return now, err
+		}
+	}
+	return now, nil
+}
+
+// Offline deletes userID's key, so they are offline at once, and passes
+// the disconnect on to the durable store
+func (s *RedisStore) Offline(ctx context.Context, userID string) error {
+	if err := ValidUserID(userID); err != nil {
+		return err
+	}
+	if err := s.client.Del(ctx, redisKeyPrefix+userID).Err(); err != nil {
+		return fmt.Errorf("presence: redis: %w", err)
+	}
+	if s.durable != nil {
+		return s.durable.Offline(ctx, userID)
+	}
+	return nil
+}
+
+// Status reports whether userID is online
+func (s *RedisStore) Status(ctx context.Context, userID string) (Status, error) {
+	statuses, err := s.BatchStatus(ctx, []string{userID})
+	if err != nil {
+		return Status{}, err
+	}
+	return statuses[0], nil
+}
+
+// BatchStatus reports whether each of userIDs is online, in their order,
+// with one MGET. On a cluster, whose MGETs can't span slots, it pipelines
+// a GET per user instead, which the client groups by node
+func (s *RedisStore) BatchStatus(ctx context.Context, userIDs []string) ([]Status, error) {
+	if len(userIDs) > MaxBatch {
+		return nil, fmt.Errorf("%w: at most %d users per batch", ErrInvalidUserID, MaxBatch)
+	}
+	for _, id := range userIDs {
+		if err := ValidUserID(id); err != nil {
+			return nil, err
+		}
+	}
+	if len(userIDs) == 0 {
+		return []Status{}, nil
+	}
+
+	values, err := s.get(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("presence: redis: %w", err)
+	}
+
+	statuses := make([]Status, len(userIDs))
+	var expired []string
+	for i, id := range userIDs {
+		statuses[i] = Status{UserID: id}
+		val, ok := values[i].(string)
+		if !ok {
+			expired = append(expired, id)
+			continue
+		}
+		seen, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("presence: redis: key %s%s: %w", redisKeyPrefix, id, err)
+		}
+		statuses[i].Online = true
+		statuses[i].LastSeen = time.Unix(seen, 0).UTC()
+	}
+	if len(expired) == 0 || s.durable == nil {
+		return statuses, nil
+	}
+
+	// An expired key means offline, whatever the durable store's clock
+	// comparison says; it only supplies when the user was last seen
+	last, err := s.durable.BatchStatus(ctx, expired)
+	// From a sharded store, a failed shard only loses its users' last_seen
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		last, err = partial.Statuses, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lastSeen := make(map[string]time.Time, len(last))
+	for _, st := range last {
+		lastSeen[st.UserID] = st.LastSeen
+	}
+	for i := range statuses {
+		if !statuses[i].Online {
+			statuses[i].LastSeen = lastSeen[statuses[i].UserID]
+		}
+	}
+	return statuses, nil
+}
+
+// get reads the keys of userIDs, returning nil for those that have expired
+func (s *RedisStore) get(ctx context.Context, userIDs []string) ([]any, error) {
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = redisKeyPrefix + id
+	}
+	if _, ok := s.client.(*redis.ClusterClient); !ok {
+		return s.client.MGet(ctx, keys...).Result()
+	}
+
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	values := make([]any, len(cmds))
+	for i, cmd := range cmds {
+		if val, err := cmd.Result(); err == nil {
+			values[i] = val
+		}
+	}
+	return values, nil
+}
+
+// RedisChanges is a ChangeBackend on Redis Pub/Sub. Pub/Sub doesn't keep
+// messages, so a subscriber that is disconnected misses the changes
+// published meanwhile
+type RedisChanges struct {
+	client  redis.UniversalClient
+	channel string
+}
+
+// redisChange is a StatusChange on the wire
+type redisChange struct {
+	UserID   string    `json:"user_id"`
+	Online   bool      `json:"online"`
+	State    string    `json:"state"` // Unset by instances from before away
+	LastSeen time.Time `json:"last_seen"`
+	Time     time.Time `json:"time"`
+}
+
+// NewRedisChanges carries status changes over channel on client
+func NewRedisChanges(client redis.UniversalClient, channel string) *RedisChanges {
+	return &RedisChanges{client: client, channel: channel}
+}
+
+// Publish sends change to every subscribed instance
+func (b *RedisChanges) Publish(ctx context.Context, change StatusChange) error {
+	msg, err := json.Marshal(redisChange{UserID: change.UserID, Online: change.Online, State: change.State.String(), LastSeen: change.LastSeen, Time: change.Time})
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, msg).Err()
+}
+
+// Subscribe calls fn for each change published on the channel until ctx
+// ends. The client reconnects the subscription by itself
+func (b *RedisChanges) Subscribe(ctx context.Context, fn func(StatusChange)) error {
+	sub := b.client.Subscribe(ctx, b.channel)
+	defer sub.Close()
+	// Fail now, rather than waiting on a channel that never delivers
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("presence: redis: %w", err)
+	}
+	msgs := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return errors.New("presence: redis: subscription closed")
+			}
+			var c redisChange
+			if err := json.Unmarshal([]byte(msg.Payload), &c); err != nil {
+				continue // Not ours
+			}
+			state := parseState(c.State)
+			if state == 0 {
+				state = StateOffline
+				if c.Online {
+					state = StateOnline
+				}
+			}
+			fn(StatusChange{Status: Status{UserID: c.UserID, Online: c.Online, LastSeen: c.LastSeen}, State: state, Time: c.Time})
+		}
+	}
+}
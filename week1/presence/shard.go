@@ -0,0 +1,277 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// shardVnodes is how many points each shard has on the hash ring. More
+// points spread users more evenly; 128 keeps shards within a few percent
+const shardVnodes = 128
+
+// shardUnhealthyAfter is how many failures in a row mark a shard unhealthy
+const shardUnhealthyAfter = 3
+
+// Shard is one database of a ShardedStore
+type Shard struct {
+	// Name places the shard on the hash ring. Keep names stable: renaming a
+	// shard moves its users. Adding a shard moves only about 1/n of them
+	Name  string
+	Store Store
+}
+
+// ShardHealth is a shard's recent record, as tracked by ShardedStore
+type ShardHealth struct {
+	Name                string     `json:"name"`
+	Healthy             bool       `json:"healthy"` // Fewer than 3 failures in a row
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int64      `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+}
+
+// PartialError is returned by a Store's BatchStatus when only some users
+// couldn't be read. BatchGetStatus then fails just those users
+type PartialError struct {
+	Statuses []Status         // In request order; entries of failed users are zero
+	Errs     map[string]error // Why each failed user couldn't be read
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("presence: %d users unreadable", len(e.Errs))
+}
+
+// ShardedStore spreads users across several stores, typically SQLStores on
+// separate databases, by consistent hashing of user_id. Single-user calls
+// go to the user's shard; BatchStatus scatters to every shard involved at
+// once and gathers the replies, failing only the users of shards that
+// failed. Each shard's failures are tracked for Health
+type ShardedStore struct {
+	shards []*shardState
+	ring   []ringPoint // Sorted by hash
+}
+
+// shardState is a shard with its health counters
+type shardState struct {
+	Shard
+
+	requests    atomic.Int64
+	failures    atomic.Int64
+	consecutive atomic.Int64
+
+	mu          sync.Mutex
+	lastErr     error
+	lastFailure time.Time
+}
+
+// ringPoint is one of a shard's points on the hash ring
+type ringPoint struct {
+	hash  uint64
+	shard *shardState
+}
+
+// NewShardedStore creates a ShardedStore over shards, whose names must be
+// unique
+func NewShardedStore(shards ...Shard) (*ShardedStore, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("presence: no shards")
+	}
+	s := &ShardedStore{}
+	names := make(map[string]bool, len(shards))
+	for _, sh := range shards {
+		if names[sh.Name] {
+			return nil, fmt.Errorf("presence: duplicate shard %q", sh.Name)
+		}
+		names[sh.Name] = true
+		st := &shardState{Shard: sh}
+		s.shards = append(s.shards, st)
+		for i := 0; i < shardVnodes; i++ {
+			s.ring = append(s.ring, ringPoint{hash: xxhash.Sum64String(sh.Name + "#" + strconv.Itoa(i)), shard: st})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+	return s, nil
+}
+
+// ShardFor returns the name of the shard holding userID
+func (s *ShardedStore) ShardFor(userID string) string {
+	return s.route(userID).Name
+}
+
+// route finds userID's shard: the first ring point at or after its hash
+func (s *ShardedStore) route(userID string) *shardState {
+	h := xxhash.Sum64String(userID)
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+	if i == len(s.ring) {
+		i = 0 // Wrap around
+	}
+	return s.ring[i].shard
+}
+
+// Heartbeat records the heartbeat on userID's shard
+func (s *ShardedStore) Heartbeat(ctx context.Context, userID string) (time.Time, error) {
+	if err := ValidUserID(userID); err != nil {
+		return time.Time{}, err
+	}
+	sh := s.route(userID)
+	seen, err := sh.Store.Heartbeat(ctx, userID)
+	sh.record(err)
+	return seen, err
+}
+
+// Offline records the disconnect on userID's shard
+func (s *ShardedStore) Offline(ctx context.Context, userID string) error {
+	if err := ValidUserID(userID); err != nil {
+		return err
+	}
+	sh := s.route(userID)
+	err := sh.Store.Offline(ctx, userID)
+	sh.record(err)
+	return err
+}
+
+// Status reads userID's status from their shard
+func (s *ShardedStore) Status(ctx context.Context, userID string) (Status, error) {
+	if err := ValidUserID(userID); err != nil {
+		return Status{}, err
+	}
+	sh := s.route(userID)
+	st, err := sh.Store.Status(ctx, userID)
+	sh.record(err)
+	return st, err
+}
+
+// BatchStatus reads userIDs from their shards in parallel, one batch per
+// shard. If some shards fail, the error is a *PartialError holding the
+// other shards' statuses
+func (s *ShardedStore) BatchStatus(ctx context.Context, userIDs []string) ([]Status, error) {
+	if len(userIDs) > MaxBatch {
+		return nil, fmt.Errorf("%w: at most %d users per batch", ErrInvalidUserID, MaxBatch)
+	}
+	for _, id := range userIDs {
+		if err := ValidUserID(id); err != nil {
+			return nil, err
+		}
+	}
+
+	// Scatter: each shard gets its users, remembering where they go back
+	type part struct {
+		ids       []string
+		positions []int
+	}
+	parts := make(map[*shardState]*part)
+	for i, id := range userIDs {
+		sh := s.route(id)
+		p := parts[sh]
+		if p == nil {
+			p = &part{}
+			parts[sh] = p
+		}
+		p.ids = append(p.ids, id)
+		p.positions = append(p.positions, i)
+	}
+
+	statuses := make([]Status, len(userIDs))
+	var mu sync.Mutex
+	var partial *PartialError
+	var wg sync.WaitGroup
+	for sh, p := range parts {
+		wg.Add(1)
+		go func(sh *shardState, p *part) {
+			defer wg.Done()
+			got, err := sh.Store.BatchStatus(ctx, p.ids)
+			sh.record(err)
+			// Gather: every goroutine writes only its own users' entries
+			if err == nil {
+				for j, i := range p.positions {
+					statuses[i] = got[j]
+				}
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if partial == nil {
+				partial = &PartialError{Errs: make(map[string]error)}
+			}
+			for _, id := range p.ids {
+				partial.Errs[id] = fmt.Errorf("shard %s: %w", sh.Name, err)
+			}
+		}(sh, p)
+	}
+	wg.Wait()
+	if partial != nil {
+		partial.Statuses = statuses
+		return nil, partial
+	}
+	return statuses, nil
+}
+
+// Health reports each shard's record, in the order given to NewShardedStore
+func (s *ShardedStore) Health() []ShardHealth {
+	health := make([]ShardHealth, len(s.shards))
+	for i, sh := range s.shards {
+		h := ShardHealth{
+			Name:                sh.Name,
+			Requests:            sh.requests.Load(),
+			Failures:            sh.failures.Load(),
+			ConsecutiveFailures: sh.consecutive.Load(),
+		}
+		h.Healthy = h.ConsecutiveFailures < shardUnhealthyAfter
+		sh.mu.Lock()
+		if sh.lastErr != nil {
+			h.LastError = sh.lastErr.Error()
+			last := sh.lastFailure
+			h.LastFailure = &last
+		}
+		sh.mu.Unlock()
+		health[i] = h
+	}
+	return health
+}
+
+// HealthHandler serves Health as JSON, with a 503 while any shard is
+// unhealthy
+func (s *ShardedStore) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := s.Health()
+		status := http.StatusOK
+		for _, h := range health {
+			if !h.Healthy {
+				status = http.StatusServiceUnavailable
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(health)
+	})
+}
+
+// record counts a call's outcome. Invalid input and callers giving up
+// say nothing about the shard, so they don't count
+func (sh *shardState) record(err error) {
+	if errors.Is(err, ErrInvalidUserID) || errors.Is(err, context.Canceled) {
+		return
+	}
+	sh.requests.Add(1)
+	if err == nil {
+		sh.consecutive.Store(0)
+		return
+	}
+	sh.failures.Add(1)
+	sh.consecutive.Add(1)
+	sh.mu.Lock()
+	sh.lastErr = err
+	sh.lastFailure = time.Now()
+	sh.mu.Unlock()
+}
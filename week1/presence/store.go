@@ -0,0 +1,234 @@
+package presence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/system-design/week1/pool"
+)
+
+// MaxUserIDLength matches the user_status.user_id column
+const MaxUserIDLength = 64
+
+// MaxBatch is the most users one BatchStatus call may ask about
+const MaxBatch = 100
+
+// ErrInvalidUserID is returned for user IDs that can't be stored
+var ErrInvalidUserID = errors.New("invalid user_id")
+
+// heartbeatUpserts record a heartbeat for each driver, adding the user on
+// their first one
+var heartbeatUpserts = map[string]string{
+	"mysql":    "INSERT INTO user_status (user_id, last_seen) VALUES (?, ?) ON DUPLICATE KEY UPDATE last_seen = VALUES(last_seen)",
+	"postgres": "INSERT INTO user_status (user_id, last_seen) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET last_seen = EXCLUDED.last_seen",
+	"sqlite":   "INSERT INTO user_status (user_id, last_seen) VALUES (?, ?) ON CONFLICT (user_id) DO UPDATE SET last_seen = excluded.last_seen",
+}
+
+// Acquirer runs fn with a connection and returns it afterwards, as
+// Pool.With and Partition.With do
+type Acquirer interface {
+	With(ctx context.Context, fn func(conn *sql.DB) error) error
+}
+
+// Store records heartbeats and answers who is online. SQLStore keeps them
+// durably in user_status; RedisStore keeps them as expiring keys
+type Store interface {
+	// Heartbeat records that userID is online and returns the time recorded
+	Heartbeat(ctx context.Context, userID string) (time.Time, error)
+	// Status reports whether userID is online
+	Status(ctx context.Context, userID string) (Status, error)
+	// BatchStatus reports whether each of userIDs is online, in their order
+	BatchStatus(ctx context.Context, userIDs []string) ([]Status, error)
+	// Offline records that userID went offline now, e.g. as their last
+	// connection closed, instead of waiting out the online window
+	Offline(ctx context.Context, userID string) error
+}
+
+// SQLStore keeps user_status, holding each user's last heartbeat as Unix
+// seconds. Heartbeats are written to the split pool's primary, through
+// writes so they can be capped to a partition; statuses are read from its
+// replicas
+type SQLStore struct {
+	split        *pool.SplitPool
+	writes       Acquirer
+	driverName   string
+	onlineWindow time.Duration
+	upsert       string
+
+	coalescer *Coalescer       // Set by Coalesce; buffers heartbeats instead
+	offline   *OfflineDetector // Set by DetectOffline; keeps the status column
+}
+
+// Status is whether a user is online
+type Status struct {
+	UserID   string
+	Online   bool
+	LastSeen time.Time // Zero for users never seen
+}
+
+// NewSQLStore creates a SQLStore on split for the given database/sql driver
+// (mysql, postgres or sqlite). writes is where heartbeats get their
+// connection, e.g. a partition of split.Primary(); nil uses the primary
+// itself. A user is online while their last heartbeat is within
+// onlineWindow
+func NewSQLStore(split *pool.SplitPool, writes Acquirer, driverName string, onlineWindow time.Duration) (*SQLStore, error) {
+	upsert, ok := heartbeatUpserts[driverName]
+	if !ok {
+		return nil, fmt.Errorf("presence: unsupported driver %q", driverName)
+	}
+	if writes == nil {
+		writes = split.Primary()
+	}
+	return &SQLStore{split: split, writes: writes, driverName: driverName, onlineWindow: onlineWindow, upsert: upsert}, nil
+}
+
+// ValidUserID checks that id fits user_status and can appear in a URL path
+func ValidUserID(id string) error {
+	switch {
+	case id == "":
+		return fmt.Errorf("%w: user_id is required", ErrInvalidUserID)
+	case len(id) > MaxUserIDLength:
+		return fmt.Errorf("%w: longer than %d bytes", ErrInvalidUserID, MaxUserIDLength)
+	case strings.Contains(id, "/"):
+		return fmt.Errorf("%w: must not contain /", ErrInvalidUserID)
+	}
+	return nil
+}
+
+// Heartbeat records that userID is online and returns the time recorded
+func (s *SQLStore) Heartbeat(ctx context.Context, userID string) (time.Time, error) {
+	if err := ValidUserID(userID); err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now().Truncate(time.Second)
+	if s.coalescer != nil {
+		return now, s.coalescer.Heartbeat(userID, now)
+	}
+	ctx = pool.WithHolder(ctx, "presence heartbeat "+userID)
+	err := s.writes.With(ctx, func(conn *sql.DB) error {
+		// Prepared once per pooled connection, then reused
+		stmt, err := s.split.Primary().Stmt(ctx, conn, s.upsert)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.ExecContext(ctx, userID, now.Unix())
+		return err
+	})
+	return now, err
+}
+
+// Status reports whether userID is online
+func (s *SQLStore) Status(ctx context.Context, userID string) (Status, error) {
+	statuses, err := s.BatchStatus(ctx, []string{userID})
+	if err != nil {
+		return Status{}, err
+	}
+	return statuses[0], nil
+}
+
+// BatchStatus reports whether each of userIDs is online, in their order,
+// with one query
+func (s *SQLStore) BatchStatus(ctx context.Context, userIDs []string) ([]Status, error) {
+	if len(userIDs) > MaxBatch {
+		return nil, fmt.Errorf("%w: at most %d users per batch", ErrInvalidUserID, MaxBatch)
+	}
+	args := make([]any, len(userIDs))
+	for i, id := range userIDs {
+		if err := ValidUserID(id); err != nil {
+			return nil, err
+		}
+		args[i] = id
+	}
+	if len(userIDs) == 0 {
+		return []Status{}, nil
+	}
+
+	lastSeen := make(map[string]int64, len(userIDs))
+	conn, err := s.split.GetReadConnection(pool.WithHolder(ctx, "presence status"))
+	if err != nil {
+		return nil, err
+	}
+	defer s.split.PutConnection(conn)
+	rows, err := conn.QueryContext(ctx, s.statusQuery(len(userIDs)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	offline := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		var seen int64
+		dest := []any{&id, &seen}
+		var status string
+		if s.offline != nil {
+			dest = append(dest, &status)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		lastSeen[id] = seen
+		offline[id] = status == StatusOffline
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stored := lastSeen
+	if s.coalescer != nil {
+		// Heartbeats still buffered are fresher than what the replicas hold
+		stored = make(map[string]int64, len(lastSeen))
+		for id, seen := range lastSeen {
+			stored[id] = seen
+		}
+		s.coalescer.overlay(userIDs, lastSeen)
+	}
+	now := time.Now()
+	statuses := make([]Status, len(userIDs))
+	for i, id := range userIDs {
+		statuses[i] = Status{UserID: id}
+		seen, ok := lastSeen[id]
+		if !ok {
+			continue
+		}
+		statuses[i].LastSeen = time.Unix(seen, 0).UTC()
+		if s.offline != nil {
+			// A buffered heartbeat newer than the row brings its user back
+			statuses[i].Online = !offline[id] || seen > stored[id]
+		} else {
+			statuses[i].Online = now.Sub(statuses[i].LastSeen) < s.onlineWindow
+		}
+	}
+	return statuses, nil
+}
+
+// statusQuery reads the last heartbeat of n users, and their status once
+// the detector keeps it
+func (s *SQLStore) statusQuery(n int) string {
+	columns := "user_id, last_seen"
+	if s.offline != nil {
+		columns += ", status"
+	}
+	return "SELECT " + columns + " FROM user_status WHERE user_id IN (" + s.placeholders(1, n) + ")"
+}
+
+// placeholders lists n of the driver's placeholders, numbered from first
+// where the driver numbers them
+func (s *SQLStore) placeholders(first, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if s.driverName == "postgres" {
+			b.WriteString("$" + strconv.Itoa(first+i))
+		} else {
+			b.WriteString("?")
+		}
+	}
+	return b.String()
+}
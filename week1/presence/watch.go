@@ -0,0 +1,237 @@
+package presence
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// StatusChange reports that a user went online, away or offline
+type StatusChange struct {
+	Status
+	State State     // online, away or offline
+	Time  time.Time // When the change was noticed
+}
+
+// Watcher tells subscribers when the users they watch go online, away or
+// offline. It polls the store for every watched user at once each
+// interval, so it sees heartbeats served by any instance and works the
+// same over every Store; a thousand watchers of one user cost what one
+// does. Create one with NewWatcher
+type Watcher struct {
+	store      Store
+	thresholds Thresholds // Tell online users from away ones
+	interval   time.Duration
+	logger     *slog.Logger
+
+	mu     sync.Mutex
+	subs   map[*watch]struct{}
+	refs   map[string]int   // Subscriptions per watched user
+	known  map[string]State // Last polled state per watched user
+	closed bool
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// watch is one subscription
+type watch struct {
+	users map[string]bool
+	ch    chan StatusChange
+}
+
+// NewWatcher starts a Watcher polling store every interval, with users
+// going away per th. Polls see a user go away within an interval of
+// th.Away passing. A nil logger uses slog's default
+func NewWatcher(store Store, th Thresholds, interval time.Duration, logger *slog.Logger) *Watcher {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	w := &Watcher{
+		store:      store,
+		thresholds: th,
+		interval:   interval,
+		logger:     logger,
+		subs:       make(map[*watch]struct{}),
+		refs:       make(map[string]int),
+		known:      make(map[string]State),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// Watch returns the current statuses of userIDs, as BatchGetStatus does,
+// and subscribes to their changes from then on, delivered on the returned
+// channel until cancel is called. A change racing the read may be sent
+// although current already shows it. A subscriber that falls buffer
+// changes behind has its channel closed rather than silently missing
+// some, so it can start over; Close closes every channel
+func (w *Watcher) Watch(ctx context.Context, userIDs []string, buffer int) (current []StatusResult, changes <-chan StatusChange, cancel func(), err error) {
+	ch, cancel := w.subscribe(userIDs, buffer)
+	// Subscribed first, so no change after the read is missed
+	current, err = BatchGetStatus(ctx, w.store, userIDs)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, err
+	}
+	// The first poll compares against these, rather than taking its own
+	// read as the baseline and missing a change since
+	now := time.Now()
+	w.mu.Lock()
+	for _, res := range current {
+		if _, ok := w.known[res.UserID]; !ok && res.Err == nil && w.refs[res.UserID] > 0 {
+			w.known[res.UserID] = w.state(res.Status, now)
+		}
+	}
+	w.mu.Unlock()
+	return current, ch, cancel, nil
+}
+
+// subscribe registers a subscription to changes of userIDs
+func (w *Watcher) subscribe(userIDs []string, buffer int) (<-chan StatusChange, func()) {
+	sub := &watch{users: make(map[string]bool, len(userIDs)), ch: make(chan StatusChange, buffer)}
+	for _, id := range userIDs {
+		sub.users[id] = true
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+	w.subs[sub] = struct{}{}
+	for id := range sub.users {
+		w.refs[id]++
+	}
+	w.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.drop(sub)
+		})
+	}
+}
+
+// drop removes sub and closes its channel, if still subscribed. Must be
+// called with w.mu held
+func (w *Watcher) drop(sub *watch) {
+	if _, ok := w.subs[sub]; !ok {
+		return
+	}
+	delete(w.subs, sub)
+	close(sub.ch)
+	for id := range sub.users {
+		if w.refs[id]--; w.refs[id] == 0 {
+			delete(w.refs, id)
+			delete(w.known, id)
+		}
+	}
+}
+
+// Close stops polling and closes every subscription
+func (w *Watcher) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	for sub := range w.subs {
+		w.drop(sub)
+	}
+	w.mu.Unlock()
+	close(w.stop)
+	<-w.stopped
+}
+
+// loop polls every interval until Close
+func (w *Watcher) loop() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+		w.poll(ctx)
+		cancel()
+	}
+}
+
+// state is st's state as of now. Recently seen and never seen users count
+// as offline: neither is a change for a user to go through
+func (w *Watcher) state(st Status, now time.Time) State {
+	switch s := w.thresholds.State(st, now); s {
+	case StateRecentlySeen, StateNeverSeen:
+		return StateOffline
+	default:
+		return s
+	}
+}
+
+// poll reads every watched user's status and delivers the changes. A user
+// without a baseline, whose Watch read failed, only gets one
+func (w *Watcher) poll(ctx context.Context) {
+	w.mu.Lock()
+	users := make([]string, 0, len(w.refs))
+	for id := range w.refs {
+		users = append(users, id)
+	}
+	w.mu.Unlock()
+	if len(users) == 0 {
+		return
+	}
+
+	var results []StatusResult
+	for start := 0; start < len(users); start += MaxBulkLookup {
+		res, err := BatchGetStatus(ctx, w.store, users[start:min(start+MaxBulkLookup, len(users))])
+		if err != nil {
+			w.logger.Warn("Status watch poll failed", "error", err)
+			return
+		}
+		results = append(results, res...)
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	failed := 0
+	for _, res := range results {
+		if res.Err != nil {
+			failed++ // Keep the last status; the next poll retries
+			continue
+		}
+		if _, watched := w.refs[res.UserID]; !watched {
+			continue // Unsubscribed while polling
+		}
+		state := w.state(res.Status, now)
+		prev, ok := w.known[res.UserID]
+		w.known[res.UserID] = state
+		if !ok || prev == state {
+			continue
+		}
+		change := StatusChange{Status: res.Status, State: state, Time: now}
+		for sub := range w.subs {
+			if !sub.users[res.UserID] {
+				continue
+			}
+			select {
+			case sub.ch <- change:
+			default:
+				w.drop(sub) // Too far behind to deliver every change
+			}
+		}
+	}
+	if failed > 0 {
+		w.logger.Warn("Status watch poll missed users", "failed", failed, "watched", len(users))
+	}
+}
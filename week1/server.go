@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/system-design/week1/pool"
+	"github.com/system-design/week1/presence"
+)
+
+// heartbeatServer is the online/offline indicator's HTTP API, and
+// optionally its gRPC service, over a presence.Store
+type heartbeatServer struct {
+	store        presence.Store
+	thresholds   presence.Thresholds // Tell away users apart, and describe /v1/last_seen's
+	onlineWindow time.Duration       // Paces the sockets' pings, with thresholds.Away
+	logger       *slog.Logger
+
+	sockets socketHub
+	watcher *presence.Watcher // Feeds /v1/status/stream
+}
+
+// heartbeatRequest is the body of POST /v1/heartbeat
+type heartbeatRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// statusResponse is the body of GET /v1/status/{user_id}, and an entry of
+// POST /v1/statuses
+type statusResponse struct {
+	UserID   string     `json:"user_id"`
+	Online   bool       `json:"online"`
+	State    string     `json:"state,omitempty"`     // online, away, recently_seen, offline or never_seen; unset with Error
+	LastSeen *time.Time `json:"last_seen,omitempty"` // Unset for users never seen
+	Error    string     `json:"error,omitempty"`     // Why a bulk entry couldn't be read
+}
+
+// statusesRequest is the body of POST /v1/statuses
+type statusesRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// statusesResponse is the reply to POST /v1/statuses, in request order
+type statusesResponse struct {
+	Statuses []statusResponse `json:"statuses"`
+}
+
+// lastSeenResponse is the body of GET /v1/last_seen/{user_id}
+type lastSeenResponse struct {
+	UserID   string     `json:"user_id"`
+	LastSeen *time.Time `json:"last_seen,omitempty"` // Unset for users never seen
+	State    string     `json:"state"`               // online, away, recently_seen, offline or never_seen
+	Display  string     `json:"display"`             // e.g. "last seen 5m ago"
+}
+
+// handler routes the API
+func (s *heartbeatServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/heartbeat", s.handleHeartbeat)
+	mux.HandleFunc("/v1/status/", s.handleStatus)
+	mux.HandleFunc("/v1/status/stream", s.handleStatusStream)
+	mux.HandleFunc("/v1/statuses", s.handleStatuses)
+	mux.HandleFunc("/v1/last_seen/", s.handleLastSeen)
+	mux.HandleFunc("/v1/connect", s.handleConnect)
+	return mux
+}
+
+// handleHeartbeat records that a user is online
+func (s *heartbeatServer) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var req heartbeatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+	if _, err := s.store.Heartbeat(ctx, req.UserID); err != nil {
+		s.fail(w, r, "Heartbeat update failed", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleStatus reports whether a user is online. Unknown users are offline
+// rather than not found, as user_status only holds users that have been seen
+func (s *heartbeatServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	userID := strings.TrimPrefix(r.URL.Path, "/v1/status/")
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+	st, err := s.store.Status(ctx, userID)
+	if err != nil {
+		s.fail(w, r, "Status read failed", err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, toStatusResponse(st, s.thresholds.State(st, time.Now())))
+}
+
+// handleStatuses reports whether each of up to presence.MaxBulkLookup users
+// is online, such as a contact list. Users whose status can't be read carry
+// an error rather than failing the whole reply
+func (s *heartbeatServer) handleStatuses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var req statusesRequest
+	// Room for MaxBulkLookup quoted IDs of the longest length
+	limit := int64(presence.MaxBulkLookup*(presence.MaxUserIDLength+3) + 1<<10)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+	results, err := presence.BatchGetStatus(ctx, s.store, req.UserIDs)
+	if err != nil {
+		s.fail(w, r, "Bulk status read failed", err)
+		return
+	}
+	resp := statusesResponse{Statuses: make([]statusResponse, len(results))}
+	describe := s.bulkErrors(r, "Bulk status read failed")
+	now := time.Now()
+	for i, res := range results {
+		if res.Err != nil {
+			resp.Statuses[i] = statusResponse{UserID: res.UserID, Error: describe(res.Err)}
+			continue
+		}
+		resp.Statuses[i] = toStatusResponse(res.Status, s.thresholds.State(res.Status, now))
+	}
+	writeAPIJSON(w, http.StatusOK, resp)
+}
+
+// bulkErrors returns a function giving what a bulk reply says about a user
+// whose status couldn't be read. It classifies each distinct error once, so
+// a failed chunk shared by many users is logged once
+func (s *heartbeatServer) bulkErrors(r *http.Request, msg string) func(error) string {
+	messages := make(map[string]string)
+	return func(err error) string {
+		public, ok := messages[err.Error()]
+		if !ok {
+			_, publicErr := s.classify(r, msg, err)
+			public = publicErr.Error()
+			messages[err.Error()] = public
+		}
+		return public
+	}
+}
+
+// handleLastSeen reports when a user was last seen, with the state and
+// text to show for it
+func (s *heartbeatServer) handleLastSeen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	userID := strings.TrimPrefix(r.URL.Path, "/v1/last_seen/")
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+	ls, err := presence.GetLastSeen(ctx, s.store, userID, s.thresholds)
+	if err != nil {
+		s.fail(w, r, "Last seen read failed", err)
+		return
+	}
+	resp := lastSeenResponse{UserID: ls.UserID, State: ls.State.String(), Display: ls.Display}
+	if !ls.LastSeen.IsZero() {
+		resp.LastSeen = &ls.LastSeen
+	}
+	writeAPIJSON(w, http.StatusOK, resp)
+}
+
+// fail answers a request that the store failed. Errors meaning the pool is
+// saturated or unavailable are 503s with a Retry-After, so clients back off
+// instead of retrying into the overload
+func (s *heartbeatServer) fail(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	status, public := s.classify(r, msg, err)
+	switch status {
+	case 0:
+		// The client went away; nobody reads the response
+	case http.StatusServiceUnavailable:
+		w.Header().Set("Retry-After", "1")
+		fallthrough
+	default:
+		writeAPIError(w, status, public)
+	}
+}
+
+// classify logs a store error and returns the status and error a client
+// is told about it, or a zero status when the client went away
+func (s *heartbeatServer) classify(r *http.Request, msg string, err error) (int, error) {
+	switch {
+	case errors.Is(err, presence.ErrInvalidUserID):
+		return http.StatusBadRequest, err
+	case errors.Is(err, pool.ErrAcquireTimeout),
+		errors.Is(err, pool.ErrPoolExhausted),
+		errors.Is(err, pool.ErrCircuitOpen),
+		errors.Is(err, pool.ErrPoolPaused),
+		errors.Is(err, pool.ErrPoolClosed),
+		errors.Is(err, presence.ErrBacklogFull),
+		errors.Is(err, presence.ErrCoalescerClosed),
+		errors.Is(err, context.DeadlineExceeded):
+		s.logger.Warn(msg, "path", r.URL.Path, "error", err)
+		return http.StatusServiceUnavailable, errors.New("service busy, retry later")
+	case errors.Is(err, context.Canceled):
+		s.logger.Debug(msg, "path", r.URL.Path, "error", err)
+		return 0, err
+	default:
+		s.logger.Error(msg, "path", r.URL.Path, "error", err)
+		return http.StatusInternalServerError, errors.New("internal error")
+	}
+}
+
+// serve runs the HTTP API on httpAddr and the gRPC service on grpcAddr,
+// either of which may be empty, until SIGINT or SIGTERM or one of them
+// fails. It then stops accepting requests and gives those in flight up to
+// shutdownTimeout to finish
+func (s *heartbeatServer) serve(httpAddr, grpcAddr string, shutdownTimeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 2)
+
+	var srv *http.Server
+	if httpAddr != "" {
+		srv = &http.Server{
+			Addr:              httpAddr,
+			Handler:           s.handler(),
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      2 * requestTimeout,
+			IdleTimeout:       time.Minute,
+		}
+		srv.RegisterOnShutdown(s.sockets.closeAll)
+		srv.RegisterOnShutdown(s.watcher.Close) // Ends the status streams
+		go func() { errs <- srv.ListenAndServe() }()
+		s.logger.Info("Serving heartbeat API", "addr", httpAddr)
+	}
+	var grpcSrv *grpc.Server
+	if grpcAddr != "" {
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			if srv != nil {
+				srv.Close()
+			}
+			return err
+		}
+		grpcSrv = grpc.NewServer()
+		presenceSrv := presence.NewServer(s.store, s.logger)
+		presenceSrv.Thresholds = s.thresholds
+		presenceSrv.Register(grpcSrv)
+		go func() { errs <- grpcSrv.Serve(lis) }()
+		s.logger.Info("Serving presence gRPC service", "addr", grpcAddr)
+	}
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+	s.logger.Info("Shutting down heartbeat API")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if grpcSrv != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcSrv.Stop()
+		}
+	}
+	if srv != nil {
+		err = errors.Join(err, srv.Shutdown(shutdownCtx))
+	}
+	return err
+}
+
+// writeAPIJSON writes v as a JSON response
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes an error as a JSON response
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, map[string]string{"error": err.Error()})
+}
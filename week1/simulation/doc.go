@@ -0,0 +1,13 @@
+// Package simulation hammers the generic pool with thousands of virtual
+// goroutines making seeded random acquisitions, returns, discards, broken
+// connections and dial failures against a fake database, checking after
+// each step and at the end that no connection is issued twice, the pool
+// stays within its size bounds and no connection is lost or closed twice.
+// Each virtual goroutine draws its steps from its own random source, so a
+// seed replays the same program, though the Go scheduler still picks the
+// interleaving; run it under the race detector to catch more:
+//
+//	go test -race ./simulation
+//	go test ./simulation -sim.seed=42 -sim.runs=20
+//	go test ./simulation -fuzz=FuzzPool
+package simulation
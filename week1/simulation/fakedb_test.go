@@ -0,0 +1,109 @@
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// errDialFailed is the error of dials a virtual goroutine chose to fail
+var errDialFailed = errors.New("fake database refused the connection")
+
+// fakeConn is a connection to the fake database
+type fakeConn struct {
+	id     int64
+	holder atomic.Int64 // Virtual goroutine holding it, 0 if none
+	broken atomic.Bool  // Fails validation once set
+	closed atomic.Bool
+}
+
+// fakeDB dials fakeConns and counts the ones that are open. Problems it
+// spots, like a connection closed twice, are recorded as violations
+type fakeDB struct {
+	dialed  atomic.Int64
+	live    atomic.Int64 // Dialed and not yet closed
+	maxLive atomic.Int64
+
+	mu         sync.Mutex
+	conns      []*fakeConn
+	violations []string
+}
+
+type failDialKey struct{}
+
+// withFailedDial returns a context whose dials fail with errDialFailed
+func withFailedDial(ctx context.Context) context.Context {
+	return context.WithValue(ctx, failDialKey{}, true)
+}
+
+// dial is the pool's Factory
+func (db *fakeDB) dial(ctx context.Context) (*fakeConn, error) {
+	if fail, _ := ctx.Value(failDialKey{}).(bool); fail {
+		return nil, errDialFailed
+	}
+	c := &fakeConn{id: db.dialed.Add(1)}
+	live := db.live.Add(1)
+	for {
+		peak := db.maxLive.Load()
+		if live <= peak || db.maxLive.CompareAndSwap(peak, live) {
+			break
+		}
+	}
+	db.mu.Lock()
+	db.conns = append(db.conns, c)
+	db.mu.Unlock()
+	return c, nil
+}
+
+// validate is the pool's Validate
+func (db *fakeDB) validate(ctx context.Context, c *fakeConn) error {
+	if c.closed.Load() {
+		db.violation("conn %d validated after it was closed", c.id)
+	}
+	if c.broken.Load() {
+		return fmt.Errorf("fake conn %d is broken", c.id)
+	}
+	return nil
+}
+
+// close is the pool's Close
+func (db *fakeDB) close(c *fakeConn) error {
+	if !c.closed.CompareAndSwap(false, true) {
+		db.violation("conn %d closed twice", c.id)
+		return nil
+	}
+	if h := c.holder.Load(); h != 0 {
+		db.violation("conn %d closed while virtual goroutine %d holds it", c.id, h)
+	}
+	db.live.Add(-1)
+	return nil
+}
+
+// violation records a broken invariant
+func (db *fakeDB) violation(format string, args ...any) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.violations = append(db.violations, fmt.Sprintf(format, args...))
+}
+
+// Violations returns the broken invariants recorded so far
+func (db *fakeDB) Violations() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.violations...)
+}
+
+// open returns the connections that haven't been closed
+func (db *fakeDB) open() []*fakeConn {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var open []*fakeConn
+	for _, c := range db.conns {
+		if !c.closed.Load() {
+			open = append(open, c)
+		}
+	}
+	return open
+}
@@ -0,0 +1,129 @@
+package simulation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/system-design/week1/pool"
+)
+
+// FuzzPool runs a sequence of pool operations on one goroutine, decoded from
+// the fuzzer's bytes, against a model of which connections are held. With
+// no concurrency the outcome of every operation is known, so any difference
+// from the model is a bug: the first byte sizes the pool, each following
+// byte is one operation
+func FuzzPool(f *testing.F) {
+	f.Add([]byte{3, 0, 0, 0, 0, 1, 1, 1, 3})
+	f.Add([]byte{1, 0, 4, 0, 2, 0, 3, 1})
+	f.Add([]byte{4, 0, 0, 2, 3, 0, 4, 4, 0, 1, 3, 5})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		if len(ops) == 0 {
+			return
+		}
+		size := int(ops[0]%8) + 1
+		db := &fakeDB{}
+		p, err := pool.New(pool.Config[*fakeConn]{
+			Factory:  db.dial,
+			Validate: db.validate,
+			Close:    db.close,
+			Settings: pool.Settings{MaxConns: size, ValidateOnCheckout: true, LazyConnect: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+
+		var held []*fakeConn
+		returned := make(map[*fakeConn]bool)  // Returned and maybe idle again
+		discarded := make(map[*fakeConn]bool) // Closed by Discard
+		pick := func(b byte) int { return int(b>>3) % len(held) }
+		release := func(i int) *fakeConn {
+			c := held[i]
+			held = append(held[:i], held[i+1:]...)
+			return c
+		}
+
+		for i, op := range ops[1:] {
+			switch op % 6 {
+			case 0, 5: // Acquire
+				c, ok := p.TryGet()
+				if ok != (len(held) < size) {
+					t.Fatalf("op %d: TryGet ok=%v with %d of %d held", i, ok, len(held), size)
+				}
+				if !ok {
+					break
+				}
+				if c.broken.Load() || c.closed.Load() || discarded[c] {
+					t.Fatalf("op %d: TryGet returned unusable conn %d", i, c.id)
+				}
+				for _, h := range held {
+					if h == c {
+						t.Fatalf("op %d: conn %d issued twice", i, c.id)
+					}
+				}
+				delete(returned, c)
+				held = append(held, c)
+			case 1: // Return
+				if len(held) == 0 {
+					break
+				}
+				c := release(pick(op))
+				if err := p.Put(c); err != nil {
+					t.Fatalf("op %d: Put: %v", i, err)
+				}
+				returned[c] = true
+			case 2: // Discard
+				if len(held) == 0 {
+					break
+				}
+				c := release(pick(op))
+				if err := p.Discard(c); err != nil {
+					t.Fatalf("op %d: Discard: %v", i, err)
+				}
+				discarded[c] = true
+			case 3: // Return broken; the next checkout must replace it
+				if len(held) == 0 {
+					break
+				}
+				c := release(pick(op))
+				c.broken.Store(true)
+				if err := p.Put(c); err != nil {
+					t.Fatalf("op %d: Put broken: %v", i, err)
+				}
+				returned[c] = true
+			case 4: // Return a connection again
+				for c := range returned {
+					if err := p.Put(c); c.closed.Load() {
+						if !errors.Is(err, pool.ErrForeignConnection) {
+							t.Fatalf("op %d: Put of closed conn %d: got %v, want ErrForeignConnection", i, c.id, err)
+						}
+					} else if !errors.Is(err, pool.ErrDoubleReturn) {
+						t.Fatalf("op %d: second Put of conn %d: got %v, want ErrDoubleReturn", i, c.id, err)
+					}
+					break
+				}
+				for c := range discarded {
+					if err := p.Put(c); !errors.Is(err, pool.ErrForeignConnection) {
+						t.Fatalf("op %d: Put of discarded conn %d: got %v, want ErrForeignConnection", i, c.id, err)
+					}
+					break
+				}
+			}
+
+			st := p.Stats()
+			if st.InUseConns != len(held) {
+				t.Fatalf("op %d: pool reports %d in use, model holds %d", i, st.InUseConns, len(held))
+			}
+			if st.TotalConns > size {
+				t.Fatalf("op %d: pool has %d connections, MaxConns is %d", i, st.TotalConns, size)
+			}
+			if open := len(db.open()); open != st.TotalConns {
+				t.Fatalf("op %d: pool tracks %d connections but %d are open", i, st.TotalConns, open)
+			}
+		}
+		if v := db.Violations(); len(v) > 0 {
+			t.Fatal(v)
+		}
+	})
+}
@@ -0,0 +1,262 @@
+package simulation
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/system-design/week1/pool"
+)
+
+var (
+	seed       = flag.Int64("sim.seed", 1, "seed of the first simulation run")
+	runs       = flag.Int("sim.runs", 1, "simulation runs per scenario, with consecutive seeds")
+	goroutines = flag.Int("sim.goroutines", 2000, "virtual goroutines per run (a tenth with -short)")
+	steps      = flag.Int("sim.steps", 50, "steps each virtual goroutine takes")
+)
+
+// scenario is a pool configuration to simulate
+type scenario struct {
+	name     string
+	settings pool.Settings
+	validate bool // Probe connections, so broken ones are caught
+	// closeAfter is the fraction of all steps after which a virtual
+	// goroutine closes the pool under everyone else (0 = never)
+	closeAfter float64
+}
+
+var scenarios = []scenario{
+	{name: "fixed", settings: pool.Settings{MinConns: 4, MaxConns: 8}},
+	{name: "validate", validate: true, settings: pool.Settings{MaxConns: 4, ValidateOnCheckout: true}},
+	{name: "overflow", settings: pool.Settings{MinConns: 2, MaxConns: 4, Overflow: 4, MaxWaiters: 64, MaxConnUses: 5}},
+	{name: "lifo", settings: pool.Settings{MaxConns: 6, LIFOWaiters: true, MaxConnLifetime: 2 * time.Millisecond}},
+	{name: "close", settings: pool.Settings{MinConns: 8, MaxConns: 8}, closeAfter: 0.5},
+}
+
+func TestSimulation(t *testing.T) {
+	for _, sc := range scenarios {
+		sc := sc
+		t.Run(sc.name, func(t *testing.T) {
+			for i := 0; i < *runs; i++ {
+				s := *seed + int64(i)
+				if violations := simulate(t, sc, s); len(violations) > 0 {
+					for _, v := range violations {
+						t.Error(v)
+					}
+					t.Fatalf("%d invariant violations; replay with -run 'TestSimulation/%s$' -sim.seed=%d", len(violations), sc.name, s)
+				}
+			}
+		})
+	}
+}
+
+// sim is one run of a scenario
+type sim struct {
+	scenario
+	pool     *pool.Pool[*fakeConn]
+	db       *fakeDB
+	capacity int // Most connections the pool may have open
+
+	held    atomic.Int64 // Connections held by virtual goroutines
+	steps   atomic.Int64 // Steps taken so far
+	closeAt int64        // Step that closes the pool, 0 for none
+	closed  atomic.Bool
+}
+
+// simulate runs sc with the given seed and returns the invariants it broke
+func simulate(t *testing.T, sc scenario, seed int64) []string {
+	t.Helper()
+	n := *goroutines
+	if testing.Short() {
+		n /= 10
+	}
+
+	db := &fakeDB{}
+	cfg := pool.Config[*fakeConn]{Factory: db.dial, Close: db.close, Settings: sc.settings}
+	if sc.validate {
+		cfg.Validate = db.validate
+	}
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	p, err := pool.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	s := &sim{scenario: sc, pool: p, db: db, capacity: sc.settings.MaxConns + sc.settings.Overflow}
+	if sc.closeAfter > 0 {
+		s.closeAt = int64(sc.closeAfter * float64(n**steps))
+	}
+
+	done := make(chan struct{})
+	monitored := make(chan struct{})
+	go func() {
+		defer close(monitored)
+		s.monitor(done)
+	}()
+
+	var wg sync.WaitGroup
+	for id := 1; id <= n; id++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed*1_000_003 + id))
+			for i := 0; i < *steps; i++ {
+				s.step(id, rng)
+			}
+		}(int64(id))
+	}
+	wg.Wait()
+	close(done)
+	<-monitored
+
+	s.checkQuiescent()
+	p.Close()
+	deadline := time.Now().Add(time.Second)
+	for len(db.open()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if open := db.open(); len(open) > 0 {
+		db.violation("%d connections still open after Close", len(open))
+	}
+	if peak := db.maxLive.Load(); peak > int64(s.capacity) {
+		db.violation("%d connections were open at once, capacity is %d", peak, s.capacity)
+	}
+	return db.Violations()
+}
+
+// step is one random action of virtual goroutine id
+func (s *sim) step(id int64, rng *rand.Rand) {
+	if n := s.steps.Add(1); n == s.closeAt {
+		s.closed.Store(true)
+		s.pool.Close()
+		return
+	}
+
+	if rng.Intn(10) == 0 {
+		if c, ok := s.pool.TryGet(); ok {
+			s.use(id, rng, c)
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(1+rng.Intn(20))*time.Millisecond)
+	defer cancel()
+	if rng.Intn(20) == 0 {
+		ctx = withFailedDial(ctx)
+	}
+	c, err := s.pool.Get(ctx)
+	if err != nil {
+		s.checkAcquireError(id, err)
+		return
+	}
+	s.use(id, rng, c)
+}
+
+// use holds a connection for a moment and hands it back: returned, returned
+// broken or discarded
+func (s *sim) use(id int64, rng *rand.Rand, c *fakeConn) {
+	if c.closed.Load() {
+		s.db.violation("virtual goroutine %d was handed closed conn %d", id, c.id)
+	}
+	if !c.holder.CompareAndSwap(0, id) {
+		s.db.violation("conn %d issued to virtual goroutine %d while %d holds it", c.id, id, c.holder.Load())
+		return
+	}
+	if s.settings.ValidateOnCheckout && c.broken.Load() {
+		s.db.violation("virtual goroutine %d was handed broken conn %d despite validation", id, c.id)
+	}
+	if held := s.held.Add(1); held > int64(s.capacity) {
+		s.db.violation("%d connections held at once, capacity is %d", held, s.capacity)
+	}
+
+	if rng.Intn(4) == 0 {
+		time.Sleep(time.Duration(rng.Intn(200)) * time.Microsecond)
+	} else {
+		runtime.Gosched()
+	}
+
+	s.held.Add(-1)
+	if !c.holder.CompareAndSwap(id, 0) {
+		s.db.violation("conn %d changed hands while virtual goroutine %d held it", c.id, id)
+	}
+	var err error
+	switch r := rng.Intn(100); {
+	case r < 10:
+		err = s.pool.Discard(c)
+	case r < 20:
+		c.broken.Store(true)
+		err = s.pool.Put(c)
+	default:
+		err = s.pool.Put(c)
+	}
+	if err != nil {
+		s.db.violation("virtual goroutine %d failed to return conn %d: %v", id, c.id, err)
+	}
+}
+
+// checkAcquireError records errors an acquisition should never fail with
+func (s *sim) checkAcquireError(id int64, err error) {
+	switch {
+	case errors.Is(err, pool.ErrAcquireTimeout), errors.Is(err, context.DeadlineExceeded):
+	case errors.Is(err, pool.ErrPoolClosed) && s.closed.Load():
+	case errors.Is(err, pool.ErrPoolExhausted) && s.settings.MaxWaiters > 0:
+	// A failed dial, possibly while replacing a broken connection
+	case strings.Contains(err.Error(), errDialFailed.Error()):
+	default:
+		s.db.violation("virtual goroutine %d: unexpected acquire error: %v", id, err)
+	}
+}
+
+// monitor checks the pool's size bounds until done is closed
+func (s *sim) monitor(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		st := s.pool.Stats()
+		if st.TotalConns > s.capacity {
+			s.db.violation("pool reports %d connections, capacity is %d", st.TotalConns, s.capacity)
+		}
+		if st.InUseConns < 0 || st.IdleConns < 0 {
+			s.db.violation("pool reports negative counts: %s", statsString(st))
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+// checkQuiescent checks, once every virtual goroutine has finished, that
+// every connection is back in the pool and its counts match the database's
+func (s *sim) checkQuiescent() {
+	if s.closed.Load() {
+		return
+	}
+	st := s.pool.Stats()
+	if st.InUseConns != 0 || st.Waiters != 0 {
+		s.db.violation("connections still in use with every virtual goroutine done: %s", statsString(st))
+	}
+	if open := len(s.db.open()); st.TotalConns != open {
+		s.db.violation("pool tracks %d connections but %d are open: %s", st.TotalConns, open, statsString(st))
+	}
+	if n := st.ConnsCreated - st.ConnsDestroyed; n != int64(st.TotalConns) {
+		s.db.violation("%d connections created and %d destroyed, but %d remain: %s", st.ConnsCreated, st.ConnsDestroyed, st.TotalConns, statsString(st))
+	}
+	if n := s.db.dialed.Load(); n != st.ConnsCreated {
+		s.db.violation("database dialed %d connections, pool created %d", n, st.ConnsCreated)
+	}
+}
+
+// statsString summarizes the counts in st
+func statsString(st pool.PoolStats) string {
+	return fmt.Sprintf("total=%d idle=%d in_use=%d waiters=%d created=%d destroyed=%d",
+		st.TotalConns, st.IdleConns, st.InUseConns, st.Waiters, st.ConnsCreated, st.ConnsDestroyed)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/system-design/week1/presence"
+)
+
+// streamKeepAlive is how often an idle status stream sends a comment, well
+// inside the usual proxy idle timeouts of a minute or more
+const streamKeepAlive = 15 * time.Second
+
+// streamBuffer is how many changes a stream may fall behind before it is
+// cut off for the client to reconnect
+const streamBuffer = 64
+
+// handleStatusStream serves GET /v1/status/stream?users=a,b,c as Server-Sent
+// Events: a status event for each user at once, then one whenever a user
+// goes online, away or offline. A stream cut off for falling behind, or by
+// shutdown, ends; EventSource clients reconnect and get fresh statuses
+func (s *heartbeatServer) handleStatusStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var users []string
+	if q := r.URL.Query().Get("users"); q != "" {
+		users = strings.Split(q, ",")
+	}
+	if len(users) == 0 {
+		writeAPIError(w, http.StatusBadRequest, errors.New("users is required"))
+		return
+	}
+	if len(users) > presence.MaxBulkLookup {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("at most %d users per stream", presence.MaxBulkLookup))
+		return
+	}
+	for _, id := range users {
+		if err := presence.ValidUserID(id); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx, cancelRead := context.WithTimeout(r.Context(), requestTimeout)
+	results, changes, cancel, err := s.watcher.Watch(ctx, users, streamBuffer)
+	cancelRead()
+	if err != nil {
+		s.fail(w, r, "Status stream read failed", err)
+		return
+	}
+	defer cancel()
+
+	// The server's WriteTimeout would end the stream
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx buffering the events
+	w.WriteHeader(http.StatusOK)
+	describe := s.bulkErrors(r, "Status stream read failed")
+	now := time.Now()
+	for _, res := range results {
+		if res.Err != nil {
+			writeStatusEvent(w, statusResponse{UserID: res.UserID, Error: describe(res.Err)})
+			continue
+		}
+		writeStatusEvent(w, toStatusResponse(res.Status, s.thresholds.State(res.Status, now)))
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			writeStatusEvent(w, toStatusResponse(change.Status, change.State))
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// toStatusResponse converts a Status in the given state to its JSON body
+func toStatusResponse(st presence.Status, state presence.State) statusResponse {
+	resp := statusResponse{UserID: st.UserID, Online: st.Online, State: state.String()}
+	if !st.LastSeen.IsZero() {
+		resp.LastSeen = &st.LastSeen
+	}
+	return resp
+}
+
+// writeStatusEvent writes one status event
+func writeStatusEvent(w http.ResponseWriter, st statusResponse) {
+	data, _ := json.Marshal(st)
+	fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+}
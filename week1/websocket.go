@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// socketWriteWait bounds writing a ping or close frame
+const socketWriteWait = 5 * time.Second
+
+// minSocketPing is the shortest time between a socket's pings, however
+// short the online window
+const minSocketPing = 100 * time.Millisecond
+
+// upgrader accepts presence sockets. The default origin check rejects
+// browsers on other sites
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  256,
+	WriteBufferSize: 256,
+}
+
+// socketHub tracks the open presence sockets, so a user with several
+// devices goes offline only when the last one disconnects, and shutdown
+// can close them all
+type socketHub struct {
+	mu      sync.Mutex
+	users   map[string]int // Open sockets per user
+	conns   map[*websocket.Conn]struct{}
+	closing bool
+}
+
+// add registers conn for userID, or reports false once closeAll has run
+func (h *socketHub) add(userID string, conn *websocket.Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	if h.users == nil {
+		h.users = make(map[string]int)
+		h.conns = make(map[*websocket.Conn]struct{})
+	}
+	h.users[userID]++
+	h.conns[conn] = struct{}{}
+	return true
+}
+
+// remove unregisters conn, reporting whether it was userID's last socket
+// and the user should go offline. Sockets closed by shutdown don't take
+// their users offline: the clients reconnect to another instance
+func (h *socketHub) remove(userID string, conn *websocket.Conn) (last bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, conn)
+	h.users[userID]--
+	if h.users[userID] > 0 {
+		return false
+	}
+	delete(h.users, userID)
+	return !h.closing
+}
+
+// closeAll tells every client the server is going away and closes their
+// sockets. http.Server.Shutdown doesn't wait for hijacked connections, so
+// serve registers this to run with it
+func (h *socketHub) closeAll() {
+	h.mu.Lock()
+	h.closing = true
+	conns := make([]*websocket.Conn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mu.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, conn := range conns {
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(socketWriteWait))
+		conn.Close()
+	}
+}
+
+// handleConnect upgrades GET /v1/connect?user_id=... to a WebSocket, and
+// keeps the user online for as long as it stays open: no heartbeat POSTs
+// needed. The server pings every third of the online window, refreshing
+// the user's heartbeat as it does, and hangs up on a client that misses
+// two pongs. When the user's last socket closes, they go offline at once:
+// the store's Offline marks them, with or without -detect-offline
+func (s *heartbeatServer) handleConnect(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	_, err := s.store.Heartbeat(ctx, userID)
+	cancel()
+	if err != nil {
+		// Before the upgrade, so the client sees why
+		s.fail(w, r, "Socket heartbeat failed", err)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade has replied with the error
+	}
+	if !s.sockets.add(userID, conn) {
+		conn.Close()
+		return
+	}
+	s.logger.Debug("Presence socket opened", "user_id", userID, "remote", r.RemoteAddr)
+
+	s.keepAlive(userID, conn)
+
+	conn.Close()
+	if !s.sockets.remove(userID, conn) {
+		return
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := s.store.Offline(ctx, userID); err != nil {
+		s.logger.Warn("Failed to mark disconnected user offline", "user_id", userID, "error", err)
+	}
+	s.logger.Debug("Presence socket closed", "user_id", userID)
+}
+
+// keepAlive pings conn and refreshes userID's heartbeat until the socket
+// closes or stops answering
+func (s *heartbeatServer) keepAlive(userID string, conn *websocket.Conn) {
+	interval := s.onlineWindow / 3
+	if away := s.thresholds.Away; away > 0 {
+		// Beat often enough that a connected user never shows as away
+		interval = min(interval, away/2)
+	}
+	interval = max(interval, minSocketPing)
+	pongWait := 2 * interval
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	// Reading processes pongs and the client's close; messages are ignored
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+		if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		if _, err := s.store.Heartbeat(ctx, userID); err != nil {
+			// The socket is fine; the next tick tries again
+			s.logger.Warn("Socket heartbeat failed", "user_id", userID, "error", err)
+		}
+		cancel()
+	}
+}